@@ -23,8 +23,17 @@ func main() {
 	// Initialize flags
 	serverAddrFlag := flag.String("server", "http://localhost:8080", "Server address")
 	symbolsFlag := flag.String("symbols", "btc-usdt", "Comma-separated list of symbols to subscribe to")
+	intervalMillisFlag := flag.Int64("interval", 0, "Candle interval in milliseconds. Uses the server default when unset")
+	modeFlag := flag.String("mode", "consolidated", "Candles to stream: consolidated, per-source or all")
+	exchangesFlag := flag.String("exchanges", "", "Comma-separated list of exchanges to aggregate. Uses every exchange when unset")
 	flag.Parse()
 
+	mode, ok := candlesv1.CandleMode_value["CANDLE_MODE_"+strings.ToUpper(strings.ReplaceAll(*modeFlag, "-", "_"))]
+	if !ok {
+		log.Printf("Invalid mode: %s", *modeFlag)
+		return
+	}
+
 	client := candlesv1connect.NewCandlesServiceClient(
 		http.DefaultClient,
 		*serverAddrFlag,
@@ -32,9 +41,18 @@ func main() {
 	)
 
 	symbols := strings.Split(*symbolsFlag, ",")
+	var exchanges []string
+	if *exchangesFlag != "" {
+		exchanges = strings.Split(*exchangesFlag, ",")
+	}
 	stream, err := client.StreamCandles(
 		ctx,
-		connect.NewRequest(&candlesv1.StreamCandlesRequest{Symbols: symbols}),
+		connect.NewRequest(&candlesv1.StreamCandlesRequest{
+			Symbols:        symbols,
+			IntervalMillis: *intervalMillisFlag,
+			Mode:           candlesv1.CandleMode(mode),
+			Exchanges:      exchanges,
+		}),
 	)
 	if err != nil {
 		log.Println(err)
@@ -44,13 +62,18 @@ func main() {
 	log.Println("Connected to Candles Service")
 	for stream.Receive() {
 		candle := stream.Msg()
-		log.Println("Timestamp:", time.Unix(candle.Timestamp, 0).String())
+		log.Println("Timestamp:", time.UnixMilli(candle.Timestamp).String())
 		log.Println("Symbol:", candle.Symbol)
+		if candle.Source != "" {
+			log.Println("Source:", candle.Source)
+		}
 		log.Println("Open:", candle.Open)
 		log.Println("Close:", candle.Close)
 		log.Println("High:", candle.High)
 		log.Println("Low:", candle.Low)
 		log.Println("Volume:", candle.Volume)
+		log.Println("Revision:", candle.Revision)
+		log.Println("Final:", candle.Final)
 		log.Println("")
 	}
 	log.Println("Stream closed")
@@ -1,22 +1,149 @@
 package cmd
 
 import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/caarlos0/env/v11"
 )
 
 type Config struct {
-	WSConnectionMaxRetries int    `env:"WS_CONNECTION_MAX_RETRIES" envDefault:"10"`
-	WSConnectionTimeout    int    `env:"WS_CONNECTION_TIMEOUT" envDefault:"30000"`
-	TradeStreamBufferSize  int    `env:"TRADE_STREAM_BUFFER_SIZE" envDefault:"1000"`
-	MaxTradesPerInterval   int    `env:"MAX_TRADES_PER_INTERVAL" envDefault:"10000"`
-	ServerPort             int    `env:"SERVER_PORT" envDefault:"8080"`
-	BinanceAddress         string `env:"BINANCE_ADDRESS" envDefault:"stream.binance.com"`
-	BinancePort            int    `env:"BINANCE_PORT" envDefault:"9443"`
-	BybitAddress           string `env:"BYBIT_ADDRESS" envDefault:"stream.bybit.com"`
-	OkxAddress             string `env:"OKX_ADDRESS" envDefault:"ws.okx.com"`
-	OkxPort                int    `env:"OKX_PORT" envDefault:"8443"`
+	WSConnectionMaxRetries  int      `env:"WS_CONNECTION_MAX_RETRIES" envDefault:"10"`
+	WSConnectionTimeout     int      `env:"WS_CONNECTION_TIMEOUT" envDefault:"30000"`
+	WSSubscribeAckTimeout   int      `env:"WS_SUBSCRIBE_ACK_TIMEOUT" envDefault:"5000"`
+	WSReconnectInitialDelay int      `env:"WS_RECONNECT_INITIAL_DELAY" envDefault:"1000"`
+	WSReconnectMaxDelay     int      `env:"WS_RECONNECT_MAX_DELAY" envDefault:"60000"`
+	WSReconnectMultiplier   float64  `env:"WS_RECONNECT_MULTIPLIER" envDefault:"2"`
+	WSReconnectJitter       float64  `env:"WS_RECONNECT_JITTER" envDefault:"0.2"`
+	WSCircuitProbeInterval  int      `env:"WS_CIRCUIT_PROBE_INTERVAL" envDefault:"300000"`
+	TradeStreamBufferSize   int      `env:"TRADE_STREAM_BUFFER_SIZE" envDefault:"1000"`
+	MaxTradesPerInterval    int      `env:"MAX_TRADES_PER_INTERVAL" envDefault:"10000"`
+	CandleAllowedLateness   int      `env:"CANDLE_ALLOWED_LATENESS" envDefault:"2000"`
+	CandleStorePath         string   `env:"CANDLE_STORE_PATH" envDefault:"candles.db"`
+	ServerPort              int      `env:"SERVER_PORT" envDefault:"8080"`
+	AdminAddress            string   `env:"ADMIN_ADDRESS" envDefault:"localhost:8081"`
+	LogLevel                string   `env:"LOG_LEVEL" envDefault:"info"`
+	TraceExporter           string   `env:"TRACE_EXPORTER" envDefault:"none"`
+	TraceFilePath           string   `env:"TRACE_FILE_PATH" envDefault:"traces.json"`
+	EnabledExchanges        []string `env:"ENABLED_EXCHANGES" envDefault:"binance,bybit,okx"`
+	ReadinessMinExchanges   int      `env:"READINESS_MIN_EXCHANGES" envDefault:"1"`
+	ReadinessMaxTradeAge    int      `env:"READINESS_MAX_TRADE_AGE" envDefault:"30000"`
+	ReadinessSymbols        []string `env:"READINESS_SYMBOLS" envDefault:"btc-usdt"` // Exchanges rejecting every one are not checked for readiness
+	KlineBackfillWindow     int      `env:"KLINE_BACKFILL_WINDOW" envDefault:"600000"`
+	TapeDir                 string   `env:"TAPE_DIR" envDefault:"tapes"`
+	TapeFrames              bool     `env:"TAPE_FRAMES" envDefault:"false"`
+	TapeTrades              bool     `env:"TAPE_TRADES" envDefault:"false"`
+	TapeMaxFileSize         int64    `env:"TAPE_MAX_FILE_SIZE" envDefault:"67108864"`
+	TapeMaxFileAge          int      `env:"TAPE_MAX_FILE_AGE" envDefault:"3600000"`
+	TapeDiskBudget          int64    `env:"TAPE_DISK_BUDGET" envDefault:"1073741824"`
+	// Registry name -> settings of the exchange, see ExchangeConfig
+	Exchanges map[string]ExchangeConfig `env:"-"`
+	// Variables replaced by the EXCHANGE_ ones that are set, see deprecatedVariables
+	Deprecated []string `env:"-"`
+}
+
+// Variable replaced by the EXCHANGE_ ones -> its replacement
+var deprecatedVariables = map[string]string{
+	"BINANCE_ADDRESS": "EXCHANGE_BINANCE_WS_ADDRESS",
+	"BINANCE_PORT":    "EXCHANGE_BINANCE_WS_ADDRESS",
+	"BYBIT_ADDRESS":   "EXCHANGE_BYBIT_WS_ADDRESS",
+	"OKX_ADDRESS":     "EXCHANGE_OKX_WS_ADDRESS",
+	"OKX_PORT":        "EXCHANGE_OKX_WS_ADDRESS",
+}
+
+// Settings of a single exchange, set with variables prefixed with EXCHANGE_ and its registry name, e.g. EXCHANGE_BYBIT_WS_ADDRESS.
+// Each adapter reads the endpoints of its registry name, and defaults unset endpoints to the public ones of the exchange
+type ExchangeConfig struct {
+	// Host and port of the websocket endpoint
+	WsAddress string `env:"WS_ADDRESS"`
+	RestURL   string `env:"REST_URL"`
+	// Endpoints of the perpetual market, for exchanges serving it from other hosts
+	PerpWsAddress string `env:"PERP_WS_ADDRESS"`
+	PerpRestURL   string `env:"PERP_REST_URL"`
+	// Reconnect policy, e.g. EXCHANGE_BYBIT_RECONNECT_MAX_DELAY
+	Reconnect ReconnectOverrides
+}
+
+// Returns the settings of the exchange with the given registry name, matched case-insensitively.
+// Endpoints that are not set are taken from defaults
+func (c *Config) Exchange(name string, defaults ExchangeConfig) ExchangeConfig {
+	endpoints := c.Exchanges[strings.ToLower(name)]
+	return ExchangeConfig{
+		WsAddress:     cmp.Or(endpoints.WsAddress, defaults.WsAddress),
+		RestURL:       cmp.Or(endpoints.RestURL, defaults.RestURL),
+		PerpWsAddress: cmp.Or(endpoints.PerpWsAddress, defaults.PerpWsAddress),
+		PerpRestURL:   cmp.Or(endpoints.PerpRestURL, defaults.PerpRestURL),
+		Reconnect:     endpoints.Reconnect,
+	}
+}
+
+// Reconnect policy of the connections to an exchange
+type ReconnectConfig struct {
+	// Consecutive failed attempts after which the circuit opens
+	MaxRetries int
+	// Delays in milliseconds
+	InitialDelay  int
+	MaxDelay      int
+	Multiplier    float64
+	Jitter        float64
+	ProbeInterval int
+}
+
+// Reconnect policy of a single exchange, see ExchangeConfig. Unset fields default to the WS_ ones
+type ReconnectOverrides struct {
+	MaxRetries    *int     `env:"RECONNECT_MAX_RETRIES"`
+	InitialDelay  *int     `env:"RECONNECT_INITIAL_DELAY"`
+	MaxDelay      *int     `env:"RECONNECT_MAX_DELAY"`
+	Multiplier    *float64 `env:"RECONNECT_MULTIPLIER"`
+	Jitter        *float64 `env:"RECONNECT_JITTER"`
+	ProbeInterval *int     `env:"CIRCUIT_PROBE_INTERVAL"`
+}
+
+// Returns the reconnect policy of the exchange with the given registry name, matched case-insensitively
+func (c *Config) Reconnect(exchange string) ReconnectConfig {
+	policy := ReconnectConfig{
+		MaxRetries:    c.WSConnectionMaxRetries,
+		InitialDelay:  c.WSReconnectInitialDelay,
+		MaxDelay:      c.WSReconnectMaxDelay,
+		Multiplier:    c.WSReconnectMultiplier,
+		Jitter:        c.WSReconnectJitter,
+		ProbeInterval: c.WSCircuitProbeInterval,
+	}
+
+	overrides := c.Exchanges[strings.ToLower(exchange)].Reconnect
+	override(&policy.MaxRetries, overrides.MaxRetries)
+	override(&policy.InitialDelay, overrides.InitialDelay)
+	override(&policy.MaxDelay, overrides.MaxDelay)
+	override(&policy.Multiplier, overrides.Multiplier)
+	override(&policy.Jitter, overrides.Jitter)
+	override(&policy.ProbeInterval, overrides.ProbeInterval)
+	return policy
+}
+
+// Returns an error if the EXCHANGE_ variables name an exchange that is not registered, e.g. a misspelled one,
+// or if a variable they replaced is set, as its settings would silently be ignored
+func (c *Config) CheckExchanges(registered []string) error {
+	if len(c.Deprecated) > 0 {
+		variable := c.Deprecated[0]
+		return fmt.Errorf("%s is no longer supported, set %s instead", variable, deprecatedVariables[variable])
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Exchanges)) {
+		if !slices.Contains(registered, name) {
+			return fmt.Errorf("exchange %q of the EXCHANGE_%s_ variables is not registered, must be one of %v", name, strings.ToUpper(name), registered)
+		}
+	}
+	return nil
+}
+
+func override[T any](value *T, override *T) {
+	if override != nil {
+		*value = *override
+	}
 }
 
 var (
@@ -29,10 +156,56 @@ func (c *Config) Load() error {
 	if err := env.Parse(&cfg); err != nil {
 		return err
 	}
+	exchanges, err := parseExchanges(os.Environ())
+	if err != nil {
+		return err
+	}
+	cfg.Exchanges = exchanges
+	cfg.Deprecated = parseDeprecated(os.Environ())
 	*c = cfg
 	return nil
 }
 
+// Parses the ExchangeConfig of every exchange named by an EXCHANGE_<NAME>_ variable of environ, keyed by the lower-case name
+func parseExchanges(environ []string) (map[string]ExchangeConfig, error) {
+	exchanges := map[string]ExchangeConfig{}
+	for _, variable := range environ {
+		key, _, _ := strings.Cut(variable, "=")
+		rest, ok := strings.CutPrefix(key, "EXCHANGE_")
+		if !ok {
+			continue
+		}
+		name, _, ok := strings.Cut(rest, "_")
+		if !ok || name == "" {
+			continue
+		}
+		if _, ok := exchanges[strings.ToLower(name)]; ok {
+			continue
+		}
+
+		var endpoints ExchangeConfig
+		opts := env.Options{Prefix: "EXCHANGE_" + name + "_", Environment: env.ToMap(environ)}
+		if err := env.ParseWithOptions(&endpoints, opts); err != nil {
+			return nil, err
+		}
+		exchanges[strings.ToLower(name)] = endpoints
+	}
+	return exchanges, nil
+}
+
+// Returns the sorted names of the deprecatedVariables set in environ
+func parseDeprecated(environ []string) []string {
+	var deprecated []string
+	for _, variable := range environ {
+		key, _, _ := strings.Cut(variable, "=")
+		if _, ok := deprecatedVariables[key]; ok {
+			deprecated = append(deprecated, key)
+		}
+	}
+	slices.Sort(deprecated)
+	return deprecated
+}
+
 func GetConfig() *Config {
 	once.Do(func() {
 		instance = &Config{}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExchanges(t *testing.T) {
+	exchanges, err := parseExchanges([]string{
+		"EXCHANGE_BYBIT_WS_ADDRESS=localhost:18080",
+		"EXCHANGE_BYBIT_REST_URL=http://localhost:18081",
+		"EXCHANGE_BINANCE_PERP_REST_URL=http://localhost:18082",
+		"ENABLED_EXCHANGES=binance,bybit",
+		"EXCHANGE_=ignored",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("Expected 2 exchanges, got %v", exchanges)
+	}
+	if bybit := exchanges["bybit"]; bybit != (ExchangeConfig{WsAddress: "localhost:18080", RestURL: "http://localhost:18081"}) {
+		t.Errorf("Unexpected bybit endpoints %+v", bybit)
+	}
+
+	cfg := &Config{Exchanges: exchanges}
+	defaults := ExchangeConfig{WsAddress: "stream.binance.com:9443", RestURL: "https://api.binance.com", PerpRestURL: "https://fapi.binance.com"}
+	expected := ExchangeConfig{WsAddress: "stream.binance.com:9443", RestURL: "https://api.binance.com", PerpRestURL: "http://localhost:18082"}
+	if binance := cfg.Exchange("Binance", defaults); binance != expected {
+		t.Errorf("Expected the set endpoints over the defaults, got %+v", binance)
+	}
+	if kraken := cfg.Exchange("kraken", defaults); kraken != defaults {
+		t.Errorf("Expected the defaults of an exchange without variables, got %+v", kraken)
+	}
+}
+
+func TestConfig_Reconnect(t *testing.T) {
+	exchanges, err := parseExchanges([]string{
+		"EXCHANGE_BYBIT_RECONNECT_MAX_DELAY=5000",
+		"EXCHANGE_BYBIT_CIRCUIT_PROBE_INTERVAL=60000",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := &Config{WSConnectionMaxRetries: 10, WSReconnectMaxDelay: 60000, WSCircuitProbeInterval: 300000, Exchanges: exchanges}
+
+	if policy := cfg.Reconnect("Bybit"); policy.MaxRetries != 10 || policy.MaxDelay != 5000 || policy.ProbeInterval != 60000 {
+		t.Errorf("Expected the overrides over the defaults, got %+v", policy)
+	}
+	if policy := cfg.Reconnect("okx"); policy.MaxDelay != 60000 || policy.ProbeInterval != 300000 {
+		t.Errorf("Expected the defaults of an exchange without overrides, got %+v", policy)
+	}
+}
+
+func TestConfig_CheckExchanges(t *testing.T) {
+	exchanges, err := parseExchanges([]string{"EXCHANGE_BYBIT_RECONNECT_MAX_DELAY=5000"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := &Config{Exchanges: exchanges}
+	if err := cfg.CheckExchanges([]string{"binance", "bybit"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := cfg.CheckExchanges([]string{"binance"}); err == nil {
+		t.Error("Expected an error for an exchange that is not registered")
+	}
+}
+
+func TestConfig_CheckExchanges_Deprecated(t *testing.T) {
+	cfg := &Config{Deprecated: parseDeprecated([]string{"ENABLED_EXCHANGES=binance", "OKX_PORT=8443", "BINANCE_ADDRESS=localhost"})}
+	err := cfg.CheckExchanges([]string{"binance", "okx"})
+	if err == nil || !strings.Contains(err.Error(), "EXCHANGE_BINANCE_WS_ADDRESS") {
+		t.Errorf("Expected an error naming the replacement of BINANCE_ADDRESS, got %v", err)
+	}
+}
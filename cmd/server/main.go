@@ -2,20 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/otelconnect"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 
 	// generated by protoc-gen-go
+	"hermeneutic-candles/cmd"
 	"hermeneutic-candles/gen/proto/candles/v1/candlesv1connect" // generated by protoc-gen-connect-go
 	"hermeneutic-candles/internal/candles"
+	"hermeneutic-candles/internal/candlestore"
+	"hermeneutic-candles/internal/exchange"
+	_ "hermeneutic-candles/internal/exchange/all" // registers the exchange adapters
+	"hermeneutic-candles/internal/exchange/replay"
+	"hermeneutic-candles/internal/health"
+	"hermeneutic-candles/internal/logging"
+	"hermeneutic-candles/internal/tape"
+	"hermeneutic-candles/internal/tracing"
 )
 
 func main() {
@@ -24,13 +42,116 @@ func main() {
 
 	// Initialize flags
 	intervalMillisFlag := flag.Int("interval", 5000, "Candle interval in milliseconds")
+	allowedIntervalsFlag := flag.String("allowed-intervals", "1000,60000,300000", "Comma-separated list of candle intervals in milliseconds that clients may request")
+	replayFlag := flag.String("replay", "", "Directory of a trade tape to replay instead of connecting to the exchanges")
+	replaySpeedFlag := flag.Float64("replay-speed", 0, "Playback speed of the replayed tape, e.g. 1 for real time. 0 plays as fast as possible")
+	replayTradesFlag := flag.Bool("replay-trades", false, "Replay the normalized trades of the tape instead of parsing its frames")
+	replayStoreFlag := flag.String("replay-store", "", "Candle store of the replay, kept apart from CANDLE_STORE_PATH. Candles of the replay are not stored when empty")
 	flag.Parse()
 
+	cfg := cmd.GetConfig()
+	if err := logging.Setup(cfg.LogLevel); err != nil {
+		fatal("Invalid LOG_LEVEL", err)
+	}
+	if err := cfg.CheckExchanges(exchange.Registered()); err != nil {
+		fatal("Invalid exchange variables", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter, cfg.TraceFilePath)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	allowedIntervals, err := parseIntervals(*allowedIntervalsFlag)
+	if err != nil {
+		fatal("Invalid --allowed-intervals", err)
+	}
+
+	// A replay never writes to the store of the live candles, whose history its candles would replace
+	storePath := cfg.CandleStorePath
+	if *replayFlag != "" {
+		storePath = *replayStoreFlag
+	}
+	var store *candlestore.Store
+	if storePath != "" {
+		store, err = candlestore.Open(storePath)
+		if err != nil {
+			fatal("Failed to open candle store", err)
+		}
+		defer store.Close()
+	}
+
+	// Replaces the exchanges with the replay of a trade tape, on the virtual clock of the replay
+	var source *replay.Source
+	var serviceOpts []candles.Option
+	if *replayFlag != "" {
+		// The clock keeps running after the tape until the candles of the longest interval are final
+		longestInterval := slices.Max(append([]int{*intervalMillisFlag}, allowedIntervals...))
+		source, err = replay.NewSource(replay.Options{
+			Dir:    *replayFlag,
+			Speed:  *replaySpeedFlag,
+			Trades: *replayTradesFlag,
+			Tail:   time.Duration(longestInterval+cfg.CandleAllowedLateness) * time.Millisecond,
+		})
+		if err != nil {
+			fatal("Failed to open trade tape", err)
+		}
+		defer source.Close()
+		serviceOpts = append(serviceOpts, candles.WithAdapters(source.Lookup), candles.WithClock(source.Clock()))
+	}
+
 	mux := http.NewServeMux()
-	candlesService := candles.NewCandlesService(*intervalMillisFlag)
+	candlesService, err := candles.NewCandlesService(*intervalMillisFlag, allowedIntervals, store, serviceOpts...)
+	if err != nil {
+		fatal("Failed to create candles service", err)
+	}
+	defer candlesService.Close()
 
-	path, handler := candlesv1connect.NewCandlesServiceHandler(candlesService)
+	// A replay is neither recorded nor kept alive, so it starts with the first client stream
+	var recorder *tape.Recorder
+	if source == nil {
+		recorder = tape.NewRecorder(tape.Options{
+			Dir:         cfg.TapeDir,
+			MaxFileSize: cfg.TapeMaxFileSize,
+			MaxFileAge:  time.Duration(cfg.TapeMaxFileAge) * time.Millisecond,
+			DiskBudget:  cfg.TapeDiskBudget,
+			Frames:      cfg.TapeFrames,
+			Trades:      cfg.TapeTrades,
+			Clock:       candlesService.Clock(),
+		})
+		defer recorder.Close()
+		candlesService.SetRecorder(recorder)
+
+		if err := candlesService.KeepAlive(cfg.ReadinessSymbols); err != nil {
+			fatal("Invalid READINESS_SYMBOLS", err)
+		}
+	} else {
+		go func() {
+			if err := source.Run(ctx); err != nil {
+				slog.Error("Failed to replay trade tape", "error", err)
+			}
+		}()
+	}
+	checker := health.NewChecker(health.Rules{
+		MinExchanges: cfg.ReadinessMinExchanges,
+		MaxTradeAge:  time.Duration(cfg.ReadinessMaxTradeAge) * time.Millisecond,
+	}, candlesService.ReadinessStatus, candlesService.Clock(), candlesv1connect.CandlesServiceName)
+
+	otelInterceptor, err := otelconnect.NewInterceptor(otelconnect.WithoutServerPeerAttributes())
+	if err != nil {
+		fatal("Failed to create tracing interceptor", err)
+	}
+	path, handler := candlesv1connect.NewCandlesServiceHandler(candlesService, connect.WithInterceptors(otelInterceptor))
 	mux.Handle(path, handler)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(grpchealth.NewHandler(checker))
+	mux.HandleFunc("/healthz", checker.HandleHealthz)
+	mux.HandleFunc("/readyz", checker.HandleReadyz)
 
 	server := &http.Server{
 		// TODO: move to config file
@@ -38,26 +159,68 @@ func main() {
 		Handler: h2c.NewHandler(mux, &http2.Server{}),
 	}
 
+	// Recording is switched on the admin listener, which is kept off the public port
+	var adminServer *http.Server
+	if recorder != nil {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/tape", recorder)
+		adminServer = &http.Server{Addr: cfg.AdminAddress, Handler: adminMux}
+
+		go func() {
+			slog.Info("Starting admin server", "addr", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("Failed to start admin server", err)
+			}
+		}()
+	}
+
 	go func() {
-		log.Println("Starting server on :8080")
-		log.Printf("Flags: intervalMillis=%d\n", *intervalMillisFlag)
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		slog.Info("Starting server", "addr", server.Addr, "interval_ms", *intervalMillisFlag, "allowed_intervals_ms", allowedIntervals)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
 		}
 	}()
 
 	<-ctx.Done()
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	// Create new context for shutdown with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
 	// Graceful shutdown
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Admin server forced to shutdown", "error", err)
+		}
+	}
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
 		return
 	}
 
-	log.Println("Server stopped gracefully")
+	slog.Info("Server stopped gracefully")
+}
+
+// Logs the error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// Parses a comma-separated list of intervals in milliseconds
+func parseIntervals(s string) ([]int, error) {
+	var intervals []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		interval, err := strconv.Atoi(part)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval: %s", part)
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals, nil
 }
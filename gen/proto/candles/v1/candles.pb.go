@@ -21,6 +21,209 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Selects which candles are streamed for each symbol and interval
+type CandleMode int32
+
+const (
+	CandleMode_CANDLE_MODE_UNSPECIFIED  CandleMode = 0 // Same as CANDLE_MODE_CONSOLIDATED
+	CandleMode_CANDLE_MODE_CONSOLIDATED CandleMode = 1 // A single candle consolidating the trades of all exchanges
+	CandleMode_CANDLE_MODE_PER_SOURCE   CandleMode = 2 // A candle per exchange
+	CandleMode_CANDLE_MODE_ALL          CandleMode = 3 // The consolidated candle followed by a candle per exchange
+)
+
+// Enum value maps for CandleMode.
+var (
+	CandleMode_name = map[int32]string{
+		0: "CANDLE_MODE_UNSPECIFIED",
+		1: "CANDLE_MODE_CONSOLIDATED",
+		2: "CANDLE_MODE_PER_SOURCE",
+		3: "CANDLE_MODE_ALL",
+	}
+	CandleMode_value = map[string]int32{
+		"CANDLE_MODE_UNSPECIFIED":  0,
+		"CANDLE_MODE_CONSOLIDATED": 1,
+		"CANDLE_MODE_PER_SOURCE":   2,
+		"CANDLE_MODE_ALL":          3,
+	}
+)
+
+func (x CandleMode) Enum() *CandleMode {
+	p := new(CandleMode)
+	*p = x
+	return p
+}
+
+func (x CandleMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CandleMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_candles_v1_candles_proto_enumTypes[0].Descriptor()
+}
+
+func (CandleMode) Type() protoreflect.EnumType {
+	return &file_proto_candles_v1_candles_proto_enumTypes[0]
+}
+
+func (x CandleMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CandleMode.Descriptor instead.
+func (CandleMode) EnumDescriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{0}
+}
+
+type SubscribeCandlesRequest_Action int32
+
+const (
+	SubscribeCandlesRequest_ACTION_UNSPECIFIED SubscribeCandlesRequest_Action = 0
+	SubscribeCandlesRequest_ACTION_ADD         SubscribeCandlesRequest_Action = 1 // Start streaming candles of the symbols
+	SubscribeCandlesRequest_ACTION_REMOVE      SubscribeCandlesRequest_Action = 2 // Stop streaming candles of the symbols
+)
+
+// Enum value maps for SubscribeCandlesRequest_Action.
+var (
+	SubscribeCandlesRequest_Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "ACTION_ADD",
+		2: "ACTION_REMOVE",
+	}
+	SubscribeCandlesRequest_Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"ACTION_ADD":         1,
+		"ACTION_REMOVE":      2,
+	}
+)
+
+func (x SubscribeCandlesRequest_Action) Enum() *SubscribeCandlesRequest_Action {
+	p := new(SubscribeCandlesRequest_Action)
+	*p = x
+	return p
+}
+
+func (x SubscribeCandlesRequest_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SubscribeCandlesRequest_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_candles_v1_candles_proto_enumTypes[1].Descriptor()
+}
+
+func (SubscribeCandlesRequest_Action) Type() protoreflect.EnumType {
+	return &file_proto_candles_v1_candles_proto_enumTypes[1]
+}
+
+func (x SubscribeCandlesRequest_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SubscribeCandlesRequest_Action.Descriptor instead.
+func (SubscribeCandlesRequest_Action) EnumDescriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type SymbolStatus_State int32
+
+const (
+	SymbolStatus_STATE_UNSPECIFIED SymbolStatus_State = 0
+	SymbolStatus_STATE_REJECTED    SymbolStatus_State = 1 // The exchange refused to stream the symbol, e.g. an unknown pair. Candles of the symbol do not include its trades
+)
+
+// Enum value maps for SymbolStatus_State.
+var (
+	SymbolStatus_State_name = map[int32]string{
+		0: "STATE_UNSPECIFIED",
+		1: "STATE_REJECTED",
+	}
+	SymbolStatus_State_value = map[string]int32{
+		"STATE_UNSPECIFIED": 0,
+		"STATE_REJECTED":    1,
+	}
+)
+
+func (x SymbolStatus_State) Enum() *SymbolStatus_State {
+	p := new(SymbolStatus_State)
+	*p = x
+	return p
+}
+
+func (x SymbolStatus_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SymbolStatus_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_candles_v1_candles_proto_enumTypes[2].Descriptor()
+}
+
+func (SymbolStatus_State) Type() protoreflect.EnumType {
+	return &file_proto_candles_v1_candles_proto_enumTypes[2]
+}
+
+func (x SymbolStatus_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SymbolStatus_State.Descriptor instead.
+func (SymbolStatus_State) EnumDescriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type ExchangeStatus_State int32
+
+const (
+	ExchangeStatus_STATE_UNSPECIFIED  ExchangeStatus_State = 0
+	ExchangeStatus_STATE_IDLE         ExchangeStatus_State = 1 // Not streaming, no symbols of the exchange are subscribed
+	ExchangeStatus_STATE_CONNECTING   ExchangeStatus_State = 2 // Connecting, or waiting to reconnect with an exponential backoff
+	ExchangeStatus_STATE_CONNECTED    ExchangeStatus_State = 3
+	ExchangeStatus_STATE_CIRCUIT_OPEN ExchangeStatus_State = 4 // Failed to connect repeatedly. The exchange is probed at the probe interval until it connects again
+)
+
+// Enum value maps for ExchangeStatus_State.
+var (
+	ExchangeStatus_State_name = map[int32]string{
+		0: "STATE_UNSPECIFIED",
+		1: "STATE_IDLE",
+		2: "STATE_CONNECTING",
+		3: "STATE_CONNECTED",
+		4: "STATE_CIRCUIT_OPEN",
+	}
+	ExchangeStatus_State_value = map[string]int32{
+		"STATE_UNSPECIFIED":  0,
+		"STATE_IDLE":         1,
+		"STATE_CONNECTING":   2,
+		"STATE_CONNECTED":    3,
+		"STATE_CIRCUIT_OPEN": 4,
+	}
+)
+
+func (x ExchangeStatus_State) Enum() *ExchangeStatus_State {
+	p := new(ExchangeStatus_State)
+	*p = x
+	return p
+}
+
+func (x ExchangeStatus_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExchangeStatus_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_candles_v1_candles_proto_enumTypes[3].Descriptor()
+}
+
+func (ExchangeStatus_State) Type() protoreflect.EnumType {
+	return &file_proto_candles_v1_candles_proto_enumTypes[3]
+}
+
+func (x ExchangeStatus_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ExchangeStatus_State.Descriptor instead.
+func (ExchangeStatus_State) EnumDescriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{7, 0}
+}
+
 type StreamCandlesResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
@@ -30,6 +233,10 @@ type StreamCandlesResponse struct {
 	Low           float64                `protobuf:"fixed64,5,opt,name=low,proto3" json:"low,omitempty"`            // Lowest price during the period
 	Close         float64                `protobuf:"fixed64,6,opt,name=close,proto3" json:"close,omitempty"`        // Closing price
 	Volume        float64                `protobuf:"fixed64,7,opt,name=volume,proto3" json:"volume,omitempty"`      // Volume of trades during the period
+	Revision      int32                  `protobuf:"varint,8,opt,name=revision,proto3" json:"revision,omitempty"`   // Incremented each time the candle is amended by late trades
+	Final         bool                   `protobuf:"varint,9,opt,name=final,proto3" json:"final,omitempty"`         // The candle will no longer change
+	Source        string                 `protobuf:"bytes,10,opt,name=source,proto3" json:"source,omitempty"`       // Exchange the candle was built from. Empty for the consolidated candle of all exchanges
+	Sources       []string               `protobuf:"bytes,11,rep,name=sources,proto3" json:"sources,omitempty"`     // Exchanges whose trades contributed to the candle, ordered by name
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -113,11 +320,42 @@ func (x *StreamCandlesResponse) GetVolume() float64 {
 	return 0
 }
 
+func (x *StreamCandlesResponse) GetRevision() int32 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *StreamCandlesResponse) GetFinal() bool {
+	if x != nil {
+		return x.Final
+	}
+	return false
+}
+
+func (x *StreamCandlesResponse) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *StreamCandlesResponse) GetSources() []string {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
 type StreamCandlesRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Symbols       []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"` // Symbol for which to fetch candles
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Symbols        []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`                                      // Symbol for which to fetch candles
+	IntervalMillis int64                  `protobuf:"varint,2,opt,name=interval_millis,json=intervalMillis,proto3" json:"interval_millis,omitempty"` // Candle interval in milliseconds. Defaults to the server interval when unset
+	Mode           CandleMode             `protobuf:"varint,3,opt,name=mode,proto3,enum=proto.candles.v1.CandleMode" json:"mode,omitempty"`
+	Exchanges      []string               `protobuf:"bytes,4,rep,name=exchanges,proto3" json:"exchanges,omitempty"` // Exchanges to aggregate trades from, matched case-insensitively. Defaults to all exchanges when empty
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *StreamCandlesRequest) Reset() {
@@ -157,11 +395,628 @@ func (x *StreamCandlesRequest) GetSymbols() []string {
 	return nil
 }
 
+func (x *StreamCandlesRequest) GetIntervalMillis() int64 {
+	if x != nil {
+		return x.IntervalMillis
+	}
+	return 0
+}
+
+func (x *StreamCandlesRequest) GetMode() CandleMode {
+	if x != nil {
+		return x.Mode
+	}
+	return CandleMode_CANDLE_MODE_UNSPECIFIED
+}
+
+func (x *StreamCandlesRequest) GetExchanges() []string {
+	if x != nil {
+		return x.Exchanges
+	}
+	return nil
+}
+
+type SubscribeCandlesRequest struct {
+	state          protoimpl.MessageState         `protogen:"open.v1"`
+	Action         SubscribeCandlesRequest_Action `protobuf:"varint,1,opt,name=action,proto3,enum=proto.candles.v1.SubscribeCandlesRequest_Action" json:"action,omitempty"`
+	Symbols        []string                       `protobuf:"bytes,2,rep,name=symbols,proto3" json:"symbols,omitempty"`                                      // Symbols to add to or remove from the stream
+	IntervalMillis int64                          `protobuf:"varint,3,opt,name=interval_millis,json=intervalMillis,proto3" json:"interval_millis,omitempty"` // Candle interval in milliseconds. Only read from the first message. Defaults to the server interval when unset
+	Mode           CandleMode                     `protobuf:"varint,4,opt,name=mode,proto3,enum=proto.candles.v1.CandleMode" json:"mode,omitempty"`          // Only read from the first message
+	Exchanges      []string                       `protobuf:"bytes,5,rep,name=exchanges,proto3" json:"exchanges,omitempty"`                                  // Exchanges to aggregate trades from. Only read from the first message. Defaults to all exchanges when empty
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SubscribeCandlesRequest) Reset() {
+	*x = SubscribeCandlesRequest{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeCandlesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeCandlesRequest) ProtoMessage() {}
+
+func (x *SubscribeCandlesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeCandlesRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeCandlesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubscribeCandlesRequest) GetAction() SubscribeCandlesRequest_Action {
+	if x != nil {
+		return x.Action
+	}
+	return SubscribeCandlesRequest_ACTION_UNSPECIFIED
+}
+
+func (x *SubscribeCandlesRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+func (x *SubscribeCandlesRequest) GetIntervalMillis() int64 {
+	if x != nil {
+		return x.IntervalMillis
+	}
+	return 0
+}
+
+func (x *SubscribeCandlesRequest) GetMode() CandleMode {
+	if x != nil {
+		return x.Mode
+	}
+	return CandleMode_CANDLE_MODE_UNSPECIFIED
+}
+
+func (x *SubscribeCandlesRequest) GetExchanges() []string {
+	if x != nil {
+		return x.Exchanges
+	}
+	return nil
+}
+
+// Status of a symbol of the stream on one of its exchanges
+type SymbolStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"` // Symbol in the format of StreamCandlesResponse.symbol, e.g. btcusdt
+	Source        string                 `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"` // Exchange the status applies to
+	State         SymbolStatus_State     `protobuf:"varint,3,opt,name=state,proto3,enum=proto.candles.v1.SymbolStatus_State" json:"state,omitempty"`
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"` // Reason given by the exchange
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SymbolStatus) Reset() {
+	*x = SymbolStatus{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SymbolStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SymbolStatus) ProtoMessage() {}
+
+func (x *SymbolStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SymbolStatus.ProtoReflect.Descriptor instead.
+func (*SymbolStatus) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SymbolStatus) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *SymbolStatus) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *SymbolStatus) GetState() SymbolStatus_State {
+	if x != nil {
+		return x.State
+	}
+	return SymbolStatus_STATE_UNSPECIFIED
+}
+
+func (x *SymbolStatus) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type SubscribeCandlesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*SubscribeCandlesResponse_Candle
+	//	*SubscribeCandlesResponse_Status
+	//	*SubscribeCandlesResponse_ExchangeStatus
+	Event         isSubscribeCandlesResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeCandlesResponse) Reset() {
+	*x = SubscribeCandlesResponse{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeCandlesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeCandlesResponse) ProtoMessage() {}
+
+func (x *SubscribeCandlesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeCandlesResponse.ProtoReflect.Descriptor instead.
+func (*SubscribeCandlesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubscribeCandlesResponse) GetEvent() isSubscribeCandlesResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *SubscribeCandlesResponse) GetCandle() *StreamCandlesResponse {
+	if x != nil {
+		if x, ok := x.Event.(*SubscribeCandlesResponse_Candle); ok {
+			return x.Candle
+		}
+	}
+	return nil
+}
+
+func (x *SubscribeCandlesResponse) GetStatus() *SymbolStatus {
+	if x != nil {
+		if x, ok := x.Event.(*SubscribeCandlesResponse_Status); ok {
+			return x.Status
+		}
+	}
+	return nil
+}
+
+func (x *SubscribeCandlesResponse) GetExchangeStatus() *ExchangeStatus {
+	if x != nil {
+		if x, ok := x.Event.(*SubscribeCandlesResponse_ExchangeStatus); ok {
+			return x.ExchangeStatus
+		}
+	}
+	return nil
+}
+
+type isSubscribeCandlesResponse_Event interface {
+	isSubscribeCandlesResponse_Event()
+}
+
+type SubscribeCandlesResponse_Candle struct {
+	Candle *StreamCandlesResponse `protobuf:"bytes,1,opt,name=candle,proto3,oneof"`
+}
+
+type SubscribeCandlesResponse_Status struct {
+	Status *SymbolStatus `protobuf:"bytes,2,opt,name=status,proto3,oneof"` // The status of a symbol changed
+}
+
+type SubscribeCandlesResponse_ExchangeStatus struct {
+	ExchangeStatus *ExchangeStatus `protobuf:"bytes,3,opt,name=exchange_status,json=exchangeStatus,proto3,oneof"` // The connection state of an exchange streaming the symbols changed
+}
+
+func (*SubscribeCandlesResponse_Candle) isSubscribeCandlesResponse_Event() {}
+
+func (*SubscribeCandlesResponse_Status) isSubscribeCandlesResponse_Event() {}
+
+func (*SubscribeCandlesResponse_ExchangeStatus) isSubscribeCandlesResponse_Event() {}
+
+type GetCandlesRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Symbol         string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`                                        // Symbol for which to fetch candles
+	IntervalMillis int64                  `protobuf:"varint,2,opt,name=interval_millis,json=intervalMillis,proto3" json:"interval_millis,omitempty"` // Candle interval in milliseconds. Defaults to the server interval when unset
+	From           int64                  `protobuf:"varint,3,opt,name=from,proto3" json:"from,omitempty"`                                           // Start of the range in milliseconds since epoch, inclusive
+	To             int64                  `protobuf:"varint,4,opt,name=to,proto3" json:"to,omitempty"`                                               // End of the range in milliseconds since epoch, exclusive
+	PageSize       int32                  `protobuf:"varint,5,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`                   // Maximum number of candles to return. Defaults to 500, capped at 1000
+	PageToken      string                 `protobuf:"bytes,6,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`                 // Token from a previous response to fetch the next page
+	Source         string                 `protobuf:"bytes,7,opt,name=source,proto3" json:"source,omitempty"`                                        // Exchange to fetch candles of, matched case-insensitively. Fetches the consolidated candles when unset
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GetCandlesRequest) Reset() {
+	*x = GetCandlesRequest{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCandlesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCandlesRequest) ProtoMessage() {}
+
+func (x *GetCandlesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCandlesRequest.ProtoReflect.Descriptor instead.
+func (*GetCandlesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetCandlesRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *GetCandlesRequest) GetIntervalMillis() int64 {
+	if x != nil {
+		return x.IntervalMillis
+	}
+	return 0
+}
+
+func (x *GetCandlesRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *GetCandlesRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *GetCandlesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *GetCandlesRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *GetCandlesRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type GetCandlesResponse struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	Candles       []*StreamCandlesResponse `protobuf:"bytes,1,rep,name=candles,proto3" json:"candles,omitempty"`                                    // Candles ordered by timestamp
+	NextPageToken string                   `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // Token to fetch the next page. Empty when there are no more candles
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCandlesResponse) Reset() {
+	*x = GetCandlesResponse{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCandlesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCandlesResponse) ProtoMessage() {}
+
+func (x *GetCandlesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCandlesResponse.ProtoReflect.Descriptor instead.
+func (*GetCandlesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetCandlesResponse) GetCandles() []*StreamCandlesResponse {
+	if x != nil {
+		return x.Candles
+	}
+	return nil
+}
+
+func (x *GetCandlesResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+// Connection state of an exchange
+type ExchangeStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchange      string                 `protobuf:"bytes,1,opt,name=exchange,proto3" json:"exchange,omitempty"`
+	State         ExchangeStatus_State   `protobuf:"varint,2,opt,name=state,proto3,enum=proto.candles.v1.ExchangeStatus_State" json:"state,omitempty"`
+	Failures      int32                  `protobuf:"varint,3,opt,name=failures,proto3" json:"failures,omitempty"`                          // Consecutive failed connection attempts
+	NextAttempt   int64                  `protobuf:"varint,4,opt,name=next_attempt,json=nextAttempt,proto3" json:"next_attempt,omitempty"` // Time of the next connection attempt in milliseconds since epoch. Zero unless waiting to reconnect
+	LastMessage   int64                  `protobuf:"varint,5,opt,name=last_message,json=lastMessage,proto3" json:"last_message,omitempty"` // Time of the last message received in milliseconds since epoch. Zero if no message was received yet
+	Market        string                 `protobuf:"bytes,6,opt,name=market,proto3" json:"market,omitempty"`                               // Market of the connection, e.g. spot or perp. Empty when the status covers every market of the exchange
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExchangeStatus) Reset() {
+	*x = ExchangeStatus{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExchangeStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExchangeStatus) ProtoMessage() {}
+
+func (x *ExchangeStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExchangeStatus.ProtoReflect.Descriptor instead.
+func (*ExchangeStatus) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ExchangeStatus) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
+
+func (x *ExchangeStatus) GetState() ExchangeStatus_State {
+	if x != nil {
+		return x.State
+	}
+	return ExchangeStatus_STATE_UNSPECIFIED
+}
+
+func (x *ExchangeStatus) GetFailures() int32 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *ExchangeStatus) GetNextAttempt() int64 {
+	if x != nil {
+		return x.NextAttempt
+	}
+	return 0
+}
+
+func (x *ExchangeStatus) GetLastMessage() int64 {
+	if x != nil {
+		return x.LastMessage
+	}
+	return 0
+}
+
+func (x *ExchangeStatus) GetMarket() string {
+	if x != nil {
+		return x.Market
+	}
+	return ""
+}
+
+type GetExchangeStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetExchangeStatusRequest) Reset() {
+	*x = GetExchangeStatusRequest{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetExchangeStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetExchangeStatusRequest) ProtoMessage() {}
+
+func (x *GetExchangeStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetExchangeStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetExchangeStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{8}
+}
+
+type GetExchangeStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchanges     []*ExchangeStatus      `protobuf:"bytes,1,rep,name=exchanges,proto3" json:"exchanges,omitempty"` // In the order of the enabled exchanges
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetExchangeStatusResponse) Reset() {
+	*x = GetExchangeStatusResponse{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetExchangeStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetExchangeStatusResponse) ProtoMessage() {}
+
+func (x *GetExchangeStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetExchangeStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetExchangeStatusResponse) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetExchangeStatusResponse) GetExchanges() []*ExchangeStatus {
+	if x != nil {
+		return x.Exchanges
+	}
+	return nil
+}
+
+type StreamExchangeStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchanges     []string               `protobuf:"bytes,1,rep,name=exchanges,proto3" json:"exchanges,omitempty"` // Exchanges to stream the status of, matched case-insensitively. Defaults to all exchanges when empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamExchangeStatusRequest) Reset() {
+	*x = StreamExchangeStatusRequest{}
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamExchangeStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamExchangeStatusRequest) ProtoMessage() {}
+
+func (x *StreamExchangeStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_candles_v1_candles_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamExchangeStatusRequest.ProtoReflect.Descriptor instead.
+func (*StreamExchangeStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_candles_v1_candles_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StreamExchangeStatusRequest) GetExchanges() []string {
+	if x != nil {
+		return x.Exchanges
+	}
+	return nil
+}
+
 var File_proto_candles_v1_candles_proto protoreflect.FileDescriptor
 
 const file_proto_candles_v1_candles_proto_rawDesc = "" +
 	"\n" +
-	"\x1eproto/candles/v1/candles.proto\x12\x10proto.candles.v1\"\xb5\x01\n" +
+	"\x1eproto/candles/v1/candles.proto\x12\x10proto.candles.v1\"\x99\x02\n" +
 	"\x15StreamCandlesResponse\x12\x16\n" +
 	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x1c\n" +
 	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x12\n" +
@@ -169,11 +1024,85 @@ const file_proto_candles_v1_candles_proto_rawDesc = "" +
 	"\x04high\x18\x04 \x01(\x01R\x04high\x12\x10\n" +
 	"\x03low\x18\x05 \x01(\x01R\x03low\x12\x14\n" +
 	"\x05close\x18\x06 \x01(\x01R\x05close\x12\x16\n" +
-	"\x06volume\x18\a \x01(\x01R\x06volume\"0\n" +
+	"\x06volume\x18\a \x01(\x01R\x06volume\x12\x1a\n" +
+	"\brevision\x18\b \x01(\x05R\brevision\x12\x14\n" +
+	"\x05final\x18\t \x01(\bR\x05final\x12\x16\n" +
+	"\x06source\x18\n" +
+	" \x01(\tR\x06source\x12\x18\n" +
+	"\asources\x18\v \x03(\tR\asources\"\xa9\x01\n" +
 	"\x14StreamCandlesRequest\x12\x18\n" +
-	"\asymbols\x18\x01 \x03(\tR\asymbols2t\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\x12'\n" +
+	"\x0finterval_millis\x18\x02 \x01(\x03R\x0eintervalMillis\x120\n" +
+	"\x04mode\x18\x03 \x01(\x0e2\x1c.proto.candles.v1.CandleModeR\x04mode\x12\x1c\n" +
+	"\texchanges\x18\x04 \x03(\tR\texchanges\"\xbb\x02\n" +
+	"\x17SubscribeCandlesRequest\x12H\n" +
+	"\x06action\x18\x01 \x01(\x0e20.proto.candles.v1.SubscribeCandlesRequest.ActionR\x06action\x12\x18\n" +
+	"\asymbols\x18\x02 \x03(\tR\asymbols\x12'\n" +
+	"\x0finterval_millis\x18\x03 \x01(\x03R\x0eintervalMillis\x120\n" +
+	"\x04mode\x18\x04 \x01(\x0e2\x1c.proto.candles.v1.CandleModeR\x04mode\x12\x1c\n" +
+	"\texchanges\x18\x05 \x03(\tR\texchanges\"C\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\x0e\n" +
+	"\n" +
+	"ACTION_ADD\x10\x01\x12\x11\n" +
+	"\rACTION_REMOVE\x10\x02\"\xc6\x01\n" +
+	"\fSymbolStatus\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x16\n" +
+	"\x06source\x18\x02 \x01(\tR\x06source\x12:\n" +
+	"\x05state\x18\x03 \x01(\x0e2$.proto.candles.v1.SymbolStatus.StateR\x05state\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"2\n" +
+	"\x05State\x12\x15\n" +
+	"\x11STATE_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eSTATE_REJECTED\x10\x01\"\xed\x01\n" +
+	"\x18SubscribeCandlesResponse\x12A\n" +
+	"\x06candle\x18\x01 \x01(\v2'.proto.candles.v1.StreamCandlesResponseH\x00R\x06candle\x128\n" +
+	"\x06status\x18\x02 \x01(\v2\x1e.proto.candles.v1.SymbolStatusH\x00R\x06status\x12K\n" +
+	"\x0fexchange_status\x18\x03 \x01(\v2 .proto.candles.v1.ExchangeStatusH\x00R\x0eexchangeStatusB\a\n" +
+	"\x05event\"\xcc\x01\n" +
+	"\x11GetCandlesRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12'\n" +
+	"\x0finterval_millis\x18\x02 \x01(\x03R\x0eintervalMillis\x12\x12\n" +
+	"\x04from\x18\x03 \x01(\x03R\x04from\x12\x0e\n" +
+	"\x02to\x18\x04 \x01(\x03R\x02to\x12\x1b\n" +
+	"\tpage_size\x18\x05 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x06 \x01(\tR\tpageToken\x12\x16\n" +
+	"\x06source\x18\a \x01(\tR\x06source\"\x7f\n" +
+	"\x12GetCandlesResponse\x12A\n" +
+	"\acandles\x18\x01 \x03(\v2'.proto.candles.v1.StreamCandlesResponseR\acandles\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xd7\x02\n" +
+	"\x0eExchangeStatus\x12\x1a\n" +
+	"\bexchange\x18\x01 \x01(\tR\bexchange\x12<\n" +
+	"\x05state\x18\x02 \x01(\x0e2&.proto.candles.v1.ExchangeStatus.StateR\x05state\x12\x1a\n" +
+	"\bfailures\x18\x03 \x01(\x05R\bfailures\x12!\n" +
+	"\fnext_attempt\x18\x04 \x01(\x03R\vnextAttempt\x12!\n" +
+	"\flast_message\x18\x05 \x01(\x03R\vlastMessage\x12\x16\n" +
+	"\x06market\x18\x06 \x01(\tR\x06market\"q\n" +
+	"\x05State\x12\x15\n" +
+	"\x11STATE_UNSPECIFIED\x10\x00\x12\x0e\n" +
+	"\n" +
+	"STATE_IDLE\x10\x01\x12\x14\n" +
+	"\x10STATE_CONNECTING\x10\x02\x12\x13\n" +
+	"\x0fSTATE_CONNECTED\x10\x03\x12\x16\n" +
+	"\x12STATE_CIRCUIT_OPEN\x10\x04\"\x1a\n" +
+	"\x18GetExchangeStatusRequest\"[\n" +
+	"\x19GetExchangeStatusResponse\x12>\n" +
+	"\texchanges\x18\x01 \x03(\v2 .proto.candles.v1.ExchangeStatusR\texchanges\";\n" +
+	"\x1bStreamExchangeStatusRequest\x12\x1c\n" +
+	"\texchanges\x18\x01 \x03(\tR\texchanges*x\n" +
+	"\n" +
+	"CandleMode\x12\x1b\n" +
+	"\x17CANDLE_MODE_UNSPECIFIED\x10\x00\x12\x1c\n" +
+	"\x18CANDLE_MODE_CONSOLIDATED\x10\x01\x12\x1a\n" +
+	"\x16CANDLE_MODE_PER_SOURCE\x10\x02\x12\x13\n" +
+	"\x0fCANDLE_MODE_ALL\x10\x032\x95\x04\n" +
 	"\x0eCandlesService\x12b\n" +
-	"\rStreamCandles\x12&.proto.candles.v1.StreamCandlesRequest\x1a'.proto.candles.v1.StreamCandlesResponse0\x01B4Z2hermeneutic-candles/gen/proto/candles/v1;candlesv1b\x06proto3"
+	"\rStreamCandles\x12&.proto.candles.v1.StreamCandlesRequest\x1a'.proto.candles.v1.StreamCandlesResponse0\x01\x12m\n" +
+	"\x10SubscribeCandles\x12).proto.candles.v1.SubscribeCandlesRequest\x1a*.proto.candles.v1.SubscribeCandlesResponse(\x010\x01\x12W\n" +
+	"\n" +
+	"GetCandles\x12#.proto.candles.v1.GetCandlesRequest\x1a$.proto.candles.v1.GetCandlesResponse\x12l\n" +
+	"\x11GetExchangeStatus\x12*.proto.candles.v1.GetExchangeStatusRequest\x1a+.proto.candles.v1.GetExchangeStatusResponse\x12i\n" +
+	"\x14StreamExchangeStatus\x12-.proto.candles.v1.StreamExchangeStatusRequest\x1a .proto.candles.v1.ExchangeStatus0\x01B4Z2hermeneutic-candles/gen/proto/candles/v1;candlesv1b\x06proto3"
 
 var (
 	file_proto_candles_v1_candles_proto_rawDescOnce sync.Once
@@ -187,19 +1116,51 @@ func file_proto_candles_v1_candles_proto_rawDescGZIP() []byte {
 	return file_proto_candles_v1_candles_proto_rawDescData
 }
 
-var file_proto_candles_v1_candles_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_candles_v1_candles_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_proto_candles_v1_candles_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_candles_v1_candles_proto_goTypes = []any{
-	(*StreamCandlesResponse)(nil), // 0: proto.candles.v1.StreamCandlesResponse
-	(*StreamCandlesRequest)(nil),  // 1: proto.candles.v1.StreamCandlesRequest
+	(CandleMode)(0),                     // 0: proto.candles.v1.CandleMode
+	(SubscribeCandlesRequest_Action)(0), // 1: proto.candles.v1.SubscribeCandlesRequest.Action
+	(SymbolStatus_State)(0),             // 2: proto.candles.v1.SymbolStatus.State
+	(ExchangeStatus_State)(0),           // 3: proto.candles.v1.ExchangeStatus.State
+	(*StreamCandlesResponse)(nil),       // 4: proto.candles.v1.StreamCandlesResponse
+	(*StreamCandlesRequest)(nil),        // 5: proto.candles.v1.StreamCandlesRequest
+	(*SubscribeCandlesRequest)(nil),     // 6: proto.candles.v1.SubscribeCandlesRequest
+	(*SymbolStatus)(nil),                // 7: proto.candles.v1.SymbolStatus
+	(*SubscribeCandlesResponse)(nil),    // 8: proto.candles.v1.SubscribeCandlesResponse
+	(*GetCandlesRequest)(nil),           // 9: proto.candles.v1.GetCandlesRequest
+	(*GetCandlesResponse)(nil),          // 10: proto.candles.v1.GetCandlesResponse
+	(*ExchangeStatus)(nil),              // 11: proto.candles.v1.ExchangeStatus
+	(*GetExchangeStatusRequest)(nil),    // 12: proto.candles.v1.GetExchangeStatusRequest
+	(*GetExchangeStatusResponse)(nil),   // 13: proto.candles.v1.GetExchangeStatusResponse
+	(*StreamExchangeStatusRequest)(nil), // 14: proto.candles.v1.StreamExchangeStatusRequest
 }
 var file_proto_candles_v1_candles_proto_depIdxs = []int32{
-	1, // 0: proto.candles.v1.CandlesService.StreamCandles:input_type -> proto.candles.v1.StreamCandlesRequest
-	0, // 1: proto.candles.v1.CandlesService.StreamCandles:output_type -> proto.candles.v1.StreamCandlesResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: proto.candles.v1.StreamCandlesRequest.mode:type_name -> proto.candles.v1.CandleMode
+	1,  // 1: proto.candles.v1.SubscribeCandlesRequest.action:type_name -> proto.candles.v1.SubscribeCandlesRequest.Action
+	0,  // 2: proto.candles.v1.SubscribeCandlesRequest.mode:type_name -> proto.candles.v1.CandleMode
+	2,  // 3: proto.candles.v1.SymbolStatus.state:type_name -> proto.candles.v1.SymbolStatus.State
+	4,  // 4: proto.candles.v1.SubscribeCandlesResponse.candle:type_name -> proto.candles.v1.StreamCandlesResponse
+	7,  // 5: proto.candles.v1.SubscribeCandlesResponse.status:type_name -> proto.candles.v1.SymbolStatus
+	11, // 6: proto.candles.v1.SubscribeCandlesResponse.exchange_status:type_name -> proto.candles.v1.ExchangeStatus
+	4,  // 7: proto.candles.v1.GetCandlesResponse.candles:type_name -> proto.candles.v1.StreamCandlesResponse
+	3,  // 8: proto.candles.v1.ExchangeStatus.state:type_name -> proto.candles.v1.ExchangeStatus.State
+	11, // 9: proto.candles.v1.GetExchangeStatusResponse.exchanges:type_name -> proto.candles.v1.ExchangeStatus
+	5,  // 10: proto.candles.v1.CandlesService.StreamCandles:input_type -> proto.candles.v1.StreamCandlesRequest
+	6,  // 11: proto.candles.v1.CandlesService.SubscribeCandles:input_type -> proto.candles.v1.SubscribeCandlesRequest
+	9,  // 12: proto.candles.v1.CandlesService.GetCandles:input_type -> proto.candles.v1.GetCandlesRequest
+	12, // 13: proto.candles.v1.CandlesService.GetExchangeStatus:input_type -> proto.candles.v1.GetExchangeStatusRequest
+	14, // 14: proto.candles.v1.CandlesService.StreamExchangeStatus:input_type -> proto.candles.v1.StreamExchangeStatusRequest
+	4,  // 15: proto.candles.v1.CandlesService.StreamCandles:output_type -> proto.candles.v1.StreamCandlesResponse
+	8,  // 16: proto.candles.v1.CandlesService.SubscribeCandles:output_type -> proto.candles.v1.SubscribeCandlesResponse
+	10, // 17: proto.candles.v1.CandlesService.GetCandles:output_type -> proto.candles.v1.GetCandlesResponse
+	13, // 18: proto.candles.v1.CandlesService.GetExchangeStatus:output_type -> proto.candles.v1.GetExchangeStatusResponse
+	11, // 19: proto.candles.v1.CandlesService.StreamExchangeStatus:output_type -> proto.candles.v1.ExchangeStatus
+	15, // [15:20] is the sub-list for method output_type
+	10, // [10:15] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_proto_candles_v1_candles_proto_init() }
@@ -207,18 +1168,24 @@ func file_proto_candles_v1_candles_proto_init() {
 	if File_proto_candles_v1_candles_proto != nil {
 		return
 	}
+	file_proto_candles_v1_candles_proto_msgTypes[4].OneofWrappers = []any{
+		(*SubscribeCandlesResponse_Candle)(nil),
+		(*SubscribeCandlesResponse_Status)(nil),
+		(*SubscribeCandlesResponse_ExchangeStatus)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_candles_v1_candles_proto_rawDesc), len(file_proto_candles_v1_candles_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      4,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_candles_v1_candles_proto_goTypes,
 		DependencyIndexes: file_proto_candles_v1_candles_proto_depIdxs,
+		EnumInfos:         file_proto_candles_v1_candles_proto_enumTypes,
 		MessageInfos:      file_proto_candles_v1_candles_proto_msgTypes,
 	}.Build()
 	File_proto_candles_v1_candles_proto = out.File
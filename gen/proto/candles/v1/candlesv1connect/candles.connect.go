@@ -36,11 +36,29 @@ const (
 	// CandlesServiceStreamCandlesProcedure is the fully-qualified name of the CandlesService's
 	// StreamCandles RPC.
 	CandlesServiceStreamCandlesProcedure = "/proto.candles.v1.CandlesService/StreamCandles"
+	// CandlesServiceSubscribeCandlesProcedure is the fully-qualified name of the CandlesService's
+	// SubscribeCandles RPC.
+	CandlesServiceSubscribeCandlesProcedure = "/proto.candles.v1.CandlesService/SubscribeCandles"
+	// CandlesServiceGetCandlesProcedure is the fully-qualified name of the CandlesService's GetCandles
+	// RPC.
+	CandlesServiceGetCandlesProcedure = "/proto.candles.v1.CandlesService/GetCandles"
+	// CandlesServiceGetExchangeStatusProcedure is the fully-qualified name of the CandlesService's
+	// GetExchangeStatus RPC.
+	CandlesServiceGetExchangeStatusProcedure = "/proto.candles.v1.CandlesService/GetExchangeStatus"
+	// CandlesServiceStreamExchangeStatusProcedure is the fully-qualified name of the CandlesService's
+	// StreamExchangeStatus RPC.
+	CandlesServiceStreamExchangeStatusProcedure = "/proto.candles.v1.CandlesService/StreamExchangeStatus"
 )
 
 // CandlesServiceClient is a client for the proto.candles.v1.CandlesService service.
 type CandlesServiceClient interface {
+	// Streams candles of a fixed set of symbols. Only a symbol rejected by every exchange is reported, by ending the stream
+	// with INVALID_ARGUMENT. A symbol rejected by some exchanges streams from the others without a status, see SubscribeCandles
 	StreamCandles(context.Context, *connect.Request[v1.StreamCandlesRequest]) (*connect.ServerStreamForClient[v1.StreamCandlesResponse], error)
+	SubscribeCandles(context.Context) *connect.BidiStreamForClient[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse]
+	GetCandles(context.Context, *connect.Request[v1.GetCandlesRequest]) (*connect.Response[v1.GetCandlesResponse], error)
+	GetExchangeStatus(context.Context, *connect.Request[v1.GetExchangeStatusRequest]) (*connect.Response[v1.GetExchangeStatusResponse], error)
+	StreamExchangeStatus(context.Context, *connect.Request[v1.StreamExchangeStatusRequest]) (*connect.ServerStreamForClient[v1.ExchangeStatus], error)
 }
 
 // NewCandlesServiceClient constructs a client for the proto.candles.v1.CandlesService service. By
@@ -60,12 +78,40 @@ func NewCandlesServiceClient(httpClient connect.HTTPClient, baseURL string, opts
 			connect.WithSchema(candlesServiceMethods.ByName("StreamCandles")),
 			connect.WithClientOptions(opts...),
 		),
+		subscribeCandles: connect.NewClient[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse](
+			httpClient,
+			baseURL+CandlesServiceSubscribeCandlesProcedure,
+			connect.WithSchema(candlesServiceMethods.ByName("SubscribeCandles")),
+			connect.WithClientOptions(opts...),
+		),
+		getCandles: connect.NewClient[v1.GetCandlesRequest, v1.GetCandlesResponse](
+			httpClient,
+			baseURL+CandlesServiceGetCandlesProcedure,
+			connect.WithSchema(candlesServiceMethods.ByName("GetCandles")),
+			connect.WithClientOptions(opts...),
+		),
+		getExchangeStatus: connect.NewClient[v1.GetExchangeStatusRequest, v1.GetExchangeStatusResponse](
+			httpClient,
+			baseURL+CandlesServiceGetExchangeStatusProcedure,
+			connect.WithSchema(candlesServiceMethods.ByName("GetExchangeStatus")),
+			connect.WithClientOptions(opts...),
+		),
+		streamExchangeStatus: connect.NewClient[v1.StreamExchangeStatusRequest, v1.ExchangeStatus](
+			httpClient,
+			baseURL+CandlesServiceStreamExchangeStatusProcedure,
+			connect.WithSchema(candlesServiceMethods.ByName("StreamExchangeStatus")),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // candlesServiceClient implements CandlesServiceClient.
 type candlesServiceClient struct {
-	streamCandles *connect.Client[v1.StreamCandlesRequest, v1.StreamCandlesResponse]
+	streamCandles        *connect.Client[v1.StreamCandlesRequest, v1.StreamCandlesResponse]
+	subscribeCandles     *connect.Client[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse]
+	getCandles           *connect.Client[v1.GetCandlesRequest, v1.GetCandlesResponse]
+	getExchangeStatus    *connect.Client[v1.GetExchangeStatusRequest, v1.GetExchangeStatusResponse]
+	streamExchangeStatus *connect.Client[v1.StreamExchangeStatusRequest, v1.ExchangeStatus]
 }
 
 // StreamCandles calls proto.candles.v1.CandlesService.StreamCandles.
@@ -73,9 +119,35 @@ func (c *candlesServiceClient) StreamCandles(ctx context.Context, req *connect.R
 	return c.streamCandles.CallServerStream(ctx, req)
 }
 
+// SubscribeCandles calls proto.candles.v1.CandlesService.SubscribeCandles.
+func (c *candlesServiceClient) SubscribeCandles(ctx context.Context) *connect.BidiStreamForClient[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse] {
+	return c.subscribeCandles.CallBidiStream(ctx)
+}
+
+// GetCandles calls proto.candles.v1.CandlesService.GetCandles.
+func (c *candlesServiceClient) GetCandles(ctx context.Context, req *connect.Request[v1.GetCandlesRequest]) (*connect.Response[v1.GetCandlesResponse], error) {
+	return c.getCandles.CallUnary(ctx, req)
+}
+
+// GetExchangeStatus calls proto.candles.v1.CandlesService.GetExchangeStatus.
+func (c *candlesServiceClient) GetExchangeStatus(ctx context.Context, req *connect.Request[v1.GetExchangeStatusRequest]) (*connect.Response[v1.GetExchangeStatusResponse], error) {
+	return c.getExchangeStatus.CallUnary(ctx, req)
+}
+
+// StreamExchangeStatus calls proto.candles.v1.CandlesService.StreamExchangeStatus.
+func (c *candlesServiceClient) StreamExchangeStatus(ctx context.Context, req *connect.Request[v1.StreamExchangeStatusRequest]) (*connect.ServerStreamForClient[v1.ExchangeStatus], error) {
+	return c.streamExchangeStatus.CallServerStream(ctx, req)
+}
+
 // CandlesServiceHandler is an implementation of the proto.candles.v1.CandlesService service.
 type CandlesServiceHandler interface {
+	// Streams candles of a fixed set of symbols. Only a symbol rejected by every exchange is reported, by ending the stream
+	// with INVALID_ARGUMENT. A symbol rejected by some exchanges streams from the others without a status, see SubscribeCandles
 	StreamCandles(context.Context, *connect.Request[v1.StreamCandlesRequest], *connect.ServerStream[v1.StreamCandlesResponse]) error
+	SubscribeCandles(context.Context, *connect.BidiStream[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse]) error
+	GetCandles(context.Context, *connect.Request[v1.GetCandlesRequest]) (*connect.Response[v1.GetCandlesResponse], error)
+	GetExchangeStatus(context.Context, *connect.Request[v1.GetExchangeStatusRequest]) (*connect.Response[v1.GetExchangeStatusResponse], error)
+	StreamExchangeStatus(context.Context, *connect.Request[v1.StreamExchangeStatusRequest], *connect.ServerStream[v1.ExchangeStatus]) error
 }
 
 // NewCandlesServiceHandler builds an HTTP handler from the service implementation. It returns the
@@ -91,10 +163,42 @@ func NewCandlesServiceHandler(svc CandlesServiceHandler, opts ...connect.Handler
 		connect.WithSchema(candlesServiceMethods.ByName("StreamCandles")),
 		connect.WithHandlerOptions(opts...),
 	)
+	candlesServiceSubscribeCandlesHandler := connect.NewBidiStreamHandler(
+		CandlesServiceSubscribeCandlesProcedure,
+		svc.SubscribeCandles,
+		connect.WithSchema(candlesServiceMethods.ByName("SubscribeCandles")),
+		connect.WithHandlerOptions(opts...),
+	)
+	candlesServiceGetCandlesHandler := connect.NewUnaryHandler(
+		CandlesServiceGetCandlesProcedure,
+		svc.GetCandles,
+		connect.WithSchema(candlesServiceMethods.ByName("GetCandles")),
+		connect.WithHandlerOptions(opts...),
+	)
+	candlesServiceGetExchangeStatusHandler := connect.NewUnaryHandler(
+		CandlesServiceGetExchangeStatusProcedure,
+		svc.GetExchangeStatus,
+		connect.WithSchema(candlesServiceMethods.ByName("GetExchangeStatus")),
+		connect.WithHandlerOptions(opts...),
+	)
+	candlesServiceStreamExchangeStatusHandler := connect.NewServerStreamHandler(
+		CandlesServiceStreamExchangeStatusProcedure,
+		svc.StreamExchangeStatus,
+		connect.WithSchema(candlesServiceMethods.ByName("StreamExchangeStatus")),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/proto.candles.v1.CandlesService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case CandlesServiceStreamCandlesProcedure:
 			candlesServiceStreamCandlesHandler.ServeHTTP(w, r)
+		case CandlesServiceSubscribeCandlesProcedure:
+			candlesServiceSubscribeCandlesHandler.ServeHTTP(w, r)
+		case CandlesServiceGetCandlesProcedure:
+			candlesServiceGetCandlesHandler.ServeHTTP(w, r)
+		case CandlesServiceGetExchangeStatusProcedure:
+			candlesServiceGetExchangeStatusHandler.ServeHTTP(w, r)
+		case CandlesServiceStreamExchangeStatusProcedure:
+			candlesServiceStreamExchangeStatusHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -107,3 +211,19 @@ type UnimplementedCandlesServiceHandler struct{}
 func (UnimplementedCandlesServiceHandler) StreamCandles(context.Context, *connect.Request[v1.StreamCandlesRequest], *connect.ServerStream[v1.StreamCandlesResponse]) error {
 	return connect.NewError(connect.CodeUnimplemented, errors.New("proto.candles.v1.CandlesService.StreamCandles is not implemented"))
 }
+
+func (UnimplementedCandlesServiceHandler) SubscribeCandles(context.Context, *connect.BidiStream[v1.SubscribeCandlesRequest, v1.SubscribeCandlesResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("proto.candles.v1.CandlesService.SubscribeCandles is not implemented"))
+}
+
+func (UnimplementedCandlesServiceHandler) GetCandles(context.Context, *connect.Request[v1.GetCandlesRequest]) (*connect.Response[v1.GetCandlesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("proto.candles.v1.CandlesService.GetCandles is not implemented"))
+}
+
+func (UnimplementedCandlesServiceHandler) GetExchangeStatus(context.Context, *connect.Request[v1.GetExchangeStatusRequest]) (*connect.Response[v1.GetExchangeStatusResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("proto.candles.v1.CandlesService.GetExchangeStatus is not implemented"))
+}
+
+func (UnimplementedCandlesServiceHandler) StreamExchangeStatus(context.Context, *connect.Request[v1.StreamExchangeStatusRequest], *connect.ServerStream[v1.ExchangeStatus]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("proto.candles.v1.CandlesService.StreamExchangeStatus is not implemented"))
+}
@@ -0,0 +1,330 @@
+package candles
+
+import (
+	"cmp"
+	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"hermeneutic-candles/internal/exchange"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Open, high, low, close and volume of the trades of a single source
+type ohlcv struct {
+	open   float64
+	high   float64
+	low    float64
+	close  float64
+	volume float64
+
+	// Trade timestamps of the current open and close, as trades can arrive out of order
+	openTime  time.Time
+	closeTime time.Time
+	trades    int
+	// Built from klines only, whose open and close times are the bounds of the klines rather than trade times
+	klines bool
+}
+
+func (o *ohlcv) add(trade exchange.Trade) {
+	o.merge(&ohlcv{
+		open:      trade.Price,
+		high:      trade.Price,
+		low:       trade.Price,
+		close:     trade.Price,
+		volume:    trade.Quantity,
+		openTime:  trade.Timestamp,
+		closeTime: trade.Timestamp,
+		trades:    1,
+	})
+}
+
+// Merges other into o, keeping the earliest open and the latest close
+//
+// The open and close of trades take precedence over those of klines, as the bounds of a kline precede and follow every trade
+func (o *ohlcv) merge(other *ohlcv) {
+	if o.openTime.IsZero() {
+		*o = *other
+		return
+	}
+
+	if o.klines != other.klines {
+		if o.klines {
+			o.open, o.openTime = other.open, other.openTime
+			o.close, o.closeTime = other.close, other.closeTime
+		}
+	} else {
+		if other.openTime.Before(o.openTime) {
+			o.open = other.open
+			o.openTime = other.openTime
+		}
+		if !other.closeTime.Before(o.closeTime) {
+			o.close = other.close
+			o.closeTime = other.closeTime
+		}
+	}
+	o.klines = o.klines && other.klines
+	o.high = max(o.high, other.high)
+	o.low = min(o.low, other.low)
+	o.volume += other.volume
+	o.trades += other.trades
+}
+
+// Accumulates the trades of a single symbol within [start, start+interval) into a candle
+type candleBucket struct {
+	symbol string
+	start  int64 // Bucket start in milliseconds since epoch
+
+	// Source -> trades of the source within the bucket
+	sources map[string]*ohlcv
+	trades  int
+
+	// The candle has been emitted at least once
+	emitted bool
+	// The candle was amended since it was last emitted
+	dirty    bool
+	final    bool
+	revision int32
+}
+
+func (b *candleBucket) add(trade exchange.Trade) {
+	source, ok := b.sources[trade.Source]
+	if !ok {
+		source = &ohlcv{}
+		b.sources[trade.Source] = source
+	}
+	source.add(trade)
+	b.trades++
+
+	if b.emitted {
+		b.dirty = true
+	}
+}
+
+// Replaces the trades of a source, e.g. with a kline fetched after the source was disconnected
+func (b *candleBucket) replaceSource(source string, o *ohlcv) {
+	if previous, ok := b.sources[source]; ok {
+		b.trades -= previous.trades
+	}
+	b.sources[source] = o
+	b.trades += o.trades
+
+	if b.emitted {
+		b.dirty = true
+	}
+}
+
+// Returns the candles to emit for the mode, bumping the revision if the candle was amended since it was last emitted
+//
+// The consolidated candle comes first, followed by a candle per source ordered by source
+func (b *candleBucket) emit(final bool, mode candlesv1.CandleMode) []*candlesv1.StreamCandlesResponse {
+	if b.dirty {
+		b.revision++
+		b.dirty = false
+	}
+	b.emitted = true
+	b.final = final
+
+	sources := slices.Sorted(maps.Keys(b.sources))
+	var candles []*candlesv1.StreamCandlesResponse
+
+	if mode != candlesv1.CandleMode_CANDLE_MODE_PER_SOURCE {
+		// Merge in a stable order so ties resolve the same way on every emit
+		consolidated := &ohlcv{}
+		for _, source := range sources {
+			consolidated.merge(b.sources[source])
+		}
+		candles = append(candles, b.candle(consolidated, "", sources))
+	}
+	if mode == candlesv1.CandleMode_CANDLE_MODE_PER_SOURCE || mode == candlesv1.CandleMode_CANDLE_MODE_ALL {
+		for _, source := range sources {
+			candles = append(candles, b.candle(b.sources[source], source, []string{source}))
+		}
+	}
+	return candles
+}
+
+// Returns the candle of o, built from the trades of the given sources
+func (b *candleBucket) candle(o *ohlcv, source string, sources []string) *candlesv1.StreamCandlesResponse {
+	return &candlesv1.StreamCandlesResponse{
+		Symbol:    b.symbol,
+		Timestamp: b.start,
+		Open:      o.open,
+		High:      o.high,
+		Low:       o.low,
+		Close:     o.close,
+		Volume:    o.volume,
+		Revision:  b.revision,
+		Final:     b.final,
+		Source:    source,
+		Sources:   sources,
+	}
+}
+
+type bucketKey struct {
+	symbol string
+	start  int64
+}
+
+// Assigns trades to epoch-aligned [start, start+interval) buckets by trade timestamp
+//
+// A bucket is emitted once the wall clock passes its end. Trades arriving within the allowed lateness
+// after that amend the bucket, which is emitted again with a new revision. Once the allowed lateness
+// has passed the bucket is emitted as final, and later trades for it are counted and dropped.
+//
+// Final buckets are retained for a while so a kline backfill can still correct them
+type candleBuckets struct {
+	// Selects the consolidated and per-source candles emitted for each bucket
+	mode            candlesv1.CandleMode
+	intervalMillis  int64
+	latenessMillis  int64
+	retentionMillis int64
+	buckets         map[bucketKey]*candleBucket
+	// Buckets starting before this time in milliseconds are final
+	finalUntil int64
+	// Number of trades in the buckets that are not final yet
+	trades int
+	// Number of trades dropped for arriving after their bucket was final
+	droppedLateTrades int
+}
+
+func newCandleBuckets(mode candlesv1.CandleMode, intervalMillis int, latenessMillis int, retentionMillis int) *candleBuckets {
+	return &candleBuckets{
+		mode:            mode,
+		intervalMillis:  int64(intervalMillis),
+		latenessMillis:  int64(max(latenessMillis, 0)),
+		retentionMillis: int64(max(retentionMillis, 0)),
+		buckets:         map[bucketKey]*candleBucket{},
+	}
+}
+
+// Returns the start of the bucket containing t in milliseconds since epoch
+func (c *candleBuckets) bucketStart(t time.Time) int64 {
+	ms := t.UnixMilli()
+	return ms - ms%c.intervalMillis
+}
+
+// Returns the next time after now at which a bucket closes or becomes final
+func (c *candleBuckets) nextFlush(now time.Time) time.Time {
+	nextClose := c.bucketStart(now) + c.intervalMillis
+	nextFinal := c.bucketStart(now.Add(-time.Duration(c.latenessMillis)*time.Millisecond)) + c.intervalMillis + c.latenessMillis
+	return time.UnixMilli(min(nextClose, nextFinal))
+}
+
+func (c *candleBuckets) getOrCreate(symbol string, start int64) *candleBucket {
+	key := bucketKey{symbol: symbol, start: start}
+	bucket, ok := c.buckets[key]
+	if !ok {
+		bucket = &candleBucket{symbol: symbol, start: start, sources: map[string]*ohlcv{}}
+		c.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Adds a trade to its bucket
+//
+// Returns false if the trade was dropped because its bucket is already final
+func (c *candleBuckets) add(trade exchange.Trade) bool {
+	start := c.bucketStart(trade.Timestamp)
+	if start < c.finalUntil {
+		c.droppedLateTrades++
+		return false
+	}
+
+	c.getOrCreate(trade.Symbol, start).add(trade)
+	c.trades++
+	return true
+}
+
+// Replaces the trades of the klines' source in the buckets the klines fall into
+//
+// klineInterval must evenly divide the bucket interval. Buckets older than the retention and klines without volume are skipped.
+// The open and close of a bucket come from the trades of the other sources if it has any, see ohlcv.merge
+func (c *candleBuckets) backfill(klines []exchange.Kline, klineInterval time.Duration) {
+	retainedFrom := c.finalUntil - c.retentionMillis
+
+	replacements := map[bucketKey]map[string]*ohlcv{}
+	for _, kline := range klines {
+		start := c.bucketStart(kline.Start)
+		// Klines without volume had no trades, and would create candles of buckets without trades
+		if start < retainedFrom || kline.Volume == 0 {
+			continue
+		}
+
+		key := bucketKey{symbol: kline.Symbol, start: start}
+		if replacements[key] == nil {
+			replacements[key] = map[string]*ohlcv{}
+		}
+		if replacements[key][kline.Source] == nil {
+			replacements[key][kline.Source] = &ohlcv{}
+		}
+		replacements[key][kline.Source].merge(&ohlcv{
+			open:      kline.Open,
+			high:      kline.High,
+			low:       kline.Low,
+			close:     kline.Close,
+			volume:    kline.Volume,
+			openTime:  kline.Start,
+			closeTime: kline.Start.Add(klineInterval - time.Millisecond),
+			klines:    true,
+		})
+	}
+
+	for key, sources := range replacements {
+		bucket := c.getOrCreate(key.symbol, key.start)
+		for source, o := range sources {
+			before := bucket.trades
+			bucket.replaceSource(source, o)
+			if !bucket.final {
+				c.trades += bucket.trades - before
+			}
+		}
+	}
+}
+
+// Emits the buckets that closed or became final at or before now, and the buckets amended since they were last emitted
+//
+// Returns the candles ordered by start time and symbol, with the candles of a bucket ordered as in candleBucket.emit
+func (c *candleBuckets) flush(now time.Time) []*candlesv1.StreamCandlesResponse {
+	closedUntil := c.bucketStart(now)
+	finalUntil := c.bucketStart(now.Add(-time.Duration(c.latenessMillis) * time.Millisecond))
+	if finalUntil > c.finalUntil {
+		c.finalUntil = finalUntil
+	}
+
+	var due []*candleBucket
+	for key, bucket := range c.buckets {
+		switch {
+		case bucket.final:
+			if bucket.dirty {
+				due = append(due, bucket)
+			}
+		case key.start < c.finalUntil:
+			due = append(due, bucket)
+		case key.start < closedUntil && (!bucket.emitted || bucket.dirty):
+			due = append(due, bucket)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b *candleBucket) int {
+		return cmp.Or(cmp.Compare(a.start, b.start), strings.Compare(a.symbol, b.symbol))
+	})
+
+	candles := make([]*candlesv1.StreamCandlesResponse, 0, len(due))
+	for _, bucket := range due {
+		wasFinal := bucket.final
+		candles = append(candles, bucket.emit(bucket.start < c.finalUntil, c.mode)...)
+		if bucket.final && !wasFinal {
+			c.trades -= bucket.trades
+		}
+	}
+
+	// Evict final buckets that can no longer be backfilled
+	retainedFrom := c.finalUntil - c.retentionMillis
+	for key, bucket := range c.buckets {
+		if bucket.final && key.start < retainedFrom {
+			delete(c.buckets, key)
+		}
+	}
+	return candles
+}
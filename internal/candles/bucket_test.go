@@ -0,0 +1,321 @@
+package candles
+
+import (
+	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"hermeneutic-candles/internal/exchange"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandleBuckets_BucketStart(t *testing.T) {
+	buckets := newCandleBuckets(candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, 60000, 0, 0)
+
+	tests := []struct {
+		name     string
+		input    time.Time
+		expected int64
+	}{
+		{"start of minute", time.UnixMilli(1753445760000), 1753445760000},
+		{"middle of minute", time.UnixMilli(1753445787020), 1753445760000},
+		{"end of minute", time.UnixMilli(1753445819999), 1753445760000},
+		{"start of next minute", time.UnixMilli(1753445820000), 1753445820000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := buckets.bucketStart(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected bucket start %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCandleBuckets_Flush(t *testing.T) {
+	buckets := newCandleBuckets(candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, 1000, 0, 0)
+
+	trades := []exchange.Trade{
+		// Out of order trades within the same bucket
+		{Symbol: "btcusdt", Price: 101, Quantity: 1, Timestamp: time.UnixMilli(1000500), Source: "Okx"},
+		{Symbol: "btcusdt", Price: 100, Quantity: 2, Timestamp: time.UnixMilli(1000100), Source: "Binance"},
+		{Symbol: "btcusdt", Price: 103, Quantity: 1, Timestamp: time.UnixMilli(1000900), Source: "Bybit"},
+		{Symbol: "btcusdt", Price: 99, Quantity: 1, Timestamp: time.UnixMilli(1000700), Source: "Binance"},
+		// Next bucket
+		{Symbol: "btcusdt", Price: 104, Quantity: 1, Timestamp: time.UnixMilli(1001000), Source: "Binance"},
+		// Another symbol
+		{Symbol: "ethusdt", Price: 10, Quantity: 3, Timestamp: time.UnixMilli(1000200), Source: "Binance"},
+	}
+	for _, trade := range trades {
+		if !buckets.add(trade) {
+			t.Fatalf("Expected trade at %d to be accepted", trade.Timestamp.UnixMilli())
+		}
+	}
+
+	// Nothing has closed yet
+	if candles := buckets.flush(time.UnixMilli(1000999)); len(candles) != 0 {
+		t.Fatalf("Expected no candles, got %d", len(candles))
+	}
+
+	candles := buckets.flush(time.UnixMilli(1001000))
+	if len(candles) != 2 {
+		t.Fatalf("Expected 2 candles, got %d", len(candles))
+	}
+
+	btc := candles[0]
+	if btc.Symbol != "btcusdt" {
+		t.Errorf("Expected symbol btcusdt, got %s", btc.Symbol)
+	}
+	if btc.Timestamp != 1000000 {
+		t.Errorf("Expected timestamp 1000000, got %d", btc.Timestamp)
+	}
+	if btc.Open != 100 {
+		t.Errorf("Expected open 100, got %f", btc.Open)
+	}
+	if btc.Close != 103 {
+		t.Errorf("Expected close 103, got %f", btc.Close)
+	}
+	if btc.High != 103 {
+		t.Errorf("Expected high 103, got %f", btc.High)
+	}
+	if btc.Low != 99 {
+		t.Errorf("Expected low 99, got %f", btc.Low)
+	}
+	if btc.Volume != 5 {
+		t.Errorf("Expected volume 5, got %f", btc.Volume)
+	}
+	// Without allowed lateness candles are final as soon as they close
+	if !btc.Final {
+		t.Errorf("Expected candle to be final")
+	}
+
+	if candles[1].Symbol != "ethusdt" {
+		t.Errorf("Expected symbol ethusdt, got %s", candles[1].Symbol)
+	}
+
+	// Trades for a final bucket are dropped
+	late := exchange.Trade{Symbol: "btcusdt", Price: 1, Quantity: 1, Timestamp: time.UnixMilli(1000999), Source: "Okx"}
+	if buckets.add(late) {
+		t.Errorf("Expected late trade to be dropped")
+	}
+	if buckets.droppedLateTrades != 1 {
+		t.Errorf("Expected 1 dropped late trade, got %d", buckets.droppedLateTrades)
+	}
+
+	candles = buckets.flush(time.UnixMilli(1002000))
+	if len(candles) != 1 || candles[0].Timestamp != 1001000 || candles[0].Open != 104 {
+		t.Errorf("Expected next bucket candle at 1001000 with open 104, got %v", candles)
+	}
+	if buckets.trades != 0 {
+		t.Errorf("Expected no open trades, got %d", buckets.trades)
+	}
+}
+
+func TestCandleBuckets_Mode(t *testing.T) {
+	trades := []exchange.Trade{
+		{Symbol: "btcusdt", Price: 100, Quantity: 1, Timestamp: time.UnixMilli(1000100), Source: "Okx"},
+		{Symbol: "btcusdt", Price: 102, Quantity: 2, Timestamp: time.UnixMilli(1000200), Source: "Binance"},
+		{Symbol: "btcusdt", Price: 101, Quantity: 1, Timestamp: time.UnixMilli(1000300), Source: "Okx"},
+	}
+
+	type candle struct {
+		source  string
+		sources string
+		open    float64
+		close   float64
+		volume  float64
+	}
+	consolidated := candle{source: "", sources: "Binance,Okx", open: 100, close: 101, volume: 4}
+	binance := candle{source: "Binance", sources: "Binance", open: 102, close: 102, volume: 2}
+	okx := candle{source: "Okx", sources: "Okx", open: 100, close: 101, volume: 2}
+
+	tests := []struct {
+		name     string
+		mode     candlesv1.CandleMode
+		expected []candle
+	}{
+		{
+			name:     "unspecified mode is consolidated",
+			mode:     candlesv1.CandleMode_CANDLE_MODE_UNSPECIFIED,
+			expected: []candle{consolidated},
+		},
+		{
+			name:     "consolidated",
+			mode:     candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED,
+			expected: []candle{consolidated},
+		},
+		{
+			name:     "per source",
+			mode:     candlesv1.CandleMode_CANDLE_MODE_PER_SOURCE,
+			expected: []candle{binance, okx},
+		},
+		{
+			name:     "all",
+			mode:     candlesv1.CandleMode_CANDLE_MODE_ALL,
+			expected: []candle{consolidated, binance, okx},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := newCandleBuckets(tt.mode, 1000, 0, 0)
+			for _, trade := range trades {
+				buckets.add(trade)
+			}
+
+			candles := buckets.flush(time.UnixMilli(1001000))
+			if len(candles) != len(tt.expected) {
+				t.Fatalf("Expected %d candles, got %d", len(tt.expected), len(candles))
+			}
+			for i, expected := range tt.expected {
+				got := candle{
+					source:  candles[i].Source,
+					sources: strings.Join(candles[i].Sources, ","),
+					open:    candles[i].Open,
+					close:   candles[i].Close,
+					volume:  candles[i].Volume,
+				}
+				if got != expected {
+					t.Errorf("Expected candle %d to be %+v, got %+v", i, expected, got)
+				}
+				if !candles[i].Final {
+					t.Errorf("Expected candle %d to be final", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCandleBuckets_AllowedLateness(t *testing.T) {
+	buckets := newCandleBuckets(candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, 1000, 500, 0)
+
+	trade := func(price float64, ms int64) exchange.Trade {
+		return exchange.Trade{Symbol: "btcusdt", Price: price, Quantity: 1, Timestamp: time.UnixMilli(ms), Source: "Binance"}
+	}
+
+	buckets.add(trade(100, 1000100))
+
+	if next := buckets.nextFlush(time.UnixMilli(1000100)); next.UnixMilli() != 1000500 {
+		t.Errorf("Expected next flush at 1000500, got %d", next.UnixMilli())
+	}
+	if next := buckets.nextFlush(time.UnixMilli(1000600)); next.UnixMilli() != 1001000 {
+		t.Errorf("Expected next flush at 1001000, got %d", next.UnixMilli())
+	}
+
+	// Bucket closes, but is not final yet
+	candles := buckets.flush(time.UnixMilli(1001000))
+	if len(candles) != 1 {
+		t.Fatalf("Expected 1 candle, got %d", len(candles))
+	}
+	if candles[0].Revision != 0 || candles[0].Final {
+		t.Errorf("Expected revision 0 and not final, got revision %d final %v", candles[0].Revision, candles[0].Final)
+	}
+
+	// Nothing changed, nothing to emit
+	if candles := buckets.flush(time.UnixMilli(1001200)); len(candles) != 0 {
+		t.Fatalf("Expected no candles, got %d", len(candles))
+	}
+
+	// Late trade within the allowed lateness amends the candle
+	if !buckets.add(trade(90, 1000900)) {
+		t.Fatalf("Expected late trade within allowed lateness to be accepted")
+	}
+	candles = buckets.flush(time.UnixMilli(1001300))
+	if len(candles) != 1 {
+		t.Fatalf("Expected 1 amended candle, got %d", len(candles))
+	}
+	if candles[0].Revision != 1 || candles[0].Final {
+		t.Errorf("Expected revision 1 and not final, got revision %d final %v", candles[0].Revision, candles[0].Final)
+	}
+	if candles[0].Close != 90 || candles[0].Low != 90 || candles[0].Volume != 2 {
+		t.Errorf("Expected amended close 90, low 90, volume 2, got %v", candles[0])
+	}
+
+	// Allowed lateness passes, the candle is emitted as final without a new revision
+	candles = buckets.flush(time.UnixMilli(1001500))
+	if len(candles) != 1 {
+		t.Fatalf("Expected 1 final candle, got %d", len(candles))
+	}
+	if candles[0].Revision != 1 || !candles[0].Final {
+		t.Errorf("Expected revision 1 and final, got revision %d final %v", candles[0].Revision, candles[0].Final)
+	}
+
+	// Trades beyond the allowed lateness are counted and dropped
+	if buckets.add(trade(80, 1000950)) {
+		t.Errorf("Expected trade beyond allowed lateness to be dropped")
+	}
+	if buckets.droppedLateTrades != 1 {
+		t.Errorf("Expected 1 dropped late trade, got %d", buckets.droppedLateTrades)
+	}
+}
+
+func TestCandleBuckets_Backfill(t *testing.T) {
+	buckets := newCandleBuckets(candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, 5000, 0, 60000)
+
+	trade := func(source string, price float64, ms int64) exchange.Trade {
+		return exchange.Trade{Symbol: "btcusdt", Price: price, Quantity: 1, Timestamp: time.UnixMilli(ms), Source: source}
+	}
+
+	// Okx disconnected after its first trade
+	buckets.add(trade("Binance", 100, 1000100))
+	buckets.add(trade("Okx", 101, 1000200))
+	buckets.add(trade("Binance", 102, 1004000))
+
+	candles := buckets.flush(time.UnixMilli(1005000))
+	if len(candles) != 1 || !candles[0].Final || candles[0].Volume != 3 {
+		t.Fatalf("Expected 1 final candle with volume 3, got %v", candles)
+	}
+
+	// Okx klines of the bucket replace its partial trades
+	klines := []exchange.Kline{
+		{Symbol: "btcusdt", Start: time.UnixMilli(1000000), Open: 101, High: 101, Low: 101, Close: 101, Volume: 2, Source: "Okx"},
+		{Symbol: "btcusdt", Start: time.UnixMilli(1004000), Open: 98, High: 110, Low: 98, Close: 105, Volume: 3, Source: "Okx"},
+		// Bucket that had no trades at all
+		{Symbol: "btcusdt", Start: time.UnixMilli(1005000), Open: 106, High: 106, Low: 106, Close: 106, Volume: 1, Source: "Okx"},
+		// Klines without volume had no trades, and neither create a candle nor set its prices
+		{Symbol: "btcusdt", Start: time.UnixMilli(1006000), Open: 999, High: 999, Low: 999, Close: 999, Volume: 0, Source: "Okx"},
+		{Symbol: "btcusdt", Start: time.UnixMilli(1010000), Open: 999, High: 999, Low: 999, Close: 999, Volume: 0, Source: "Okx"},
+	}
+	buckets.backfill(klines, time.Second)
+
+	candles = buckets.flush(time.UnixMilli(1010000))
+	if len(candles) != 2 {
+		t.Fatalf("Expected 2 candles, got %d", len(candles))
+	}
+
+	corrected := candles[0]
+	if corrected.Timestamp != 1000000 {
+		t.Errorf("Expected corrected candle at 1000000, got %d", corrected.Timestamp)
+	}
+	if corrected.Revision != 1 || !corrected.Final {
+		t.Errorf("Expected revision 1 and final, got revision %d final %v", corrected.Revision, corrected.Final)
+	}
+	if corrected.Volume != 7 {
+		t.Errorf("Expected volume 7, got %f", corrected.Volume)
+	}
+	if corrected.High != 110 || corrected.Low != 98 {
+		t.Errorf("Expected high 110 and low 98, got %f and %f", corrected.High, corrected.Low)
+	}
+	// The bounds of the Okx klines precede and follow every trade, so the open and close come from the Binance trades
+	if corrected.Open != 100 || corrected.Close != 102 {
+		t.Errorf("Expected open 100 and close 102, got %f and %f", corrected.Open, corrected.Close)
+	}
+
+	rebuilt := candles[1]
+	if rebuilt.Timestamp != 1005000 || rebuilt.Revision != 0 || rebuilt.Volume != 1 || rebuilt.Open != 106 || rebuilt.High != 106 || rebuilt.Close != 106 {
+		t.Errorf("Expected rebuilt candle at 1005000 with revision 0, volume 1 and the kline's open and close, got %v", rebuilt)
+	}
+
+	if candles := buckets.flush(time.UnixMilli(1015000)); len(candles) != 0 {
+		t.Errorf("Expected no candle of the kline without volume, got %v", candles)
+	}
+
+	// Klines older than the retention are ignored
+	buckets.flush(time.UnixMilli(1100000))
+	buckets.backfill([]exchange.Kline{
+		{Symbol: "btcusdt", Start: time.UnixMilli(1000000), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1, Source: "Okx"},
+	}, time.Second)
+	if candles := buckets.flush(time.UnixMilli(1100000)); len(candles) != 0 {
+		t.Errorf("Expected no candles, got %d", len(candles))
+	}
+}
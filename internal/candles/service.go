@@ -2,37 +2,95 @@ package candles
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"hermeneutic-candles/cmd"
 	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"hermeneutic-candles/internal/candlestore"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"hermeneutic-candles/internal/exchange/binance"
-	"hermeneutic-candles/internal/exchange/bybit"
-	"hermeneutic-candles/internal/exchange/okx"
+	"hermeneutic-candles/internal/metrics"
+	"hermeneutic-candles/internal/tape"
+	"hermeneutic-candles/internal/tracing"
 	"hermeneutic-candles/internal/tradestreamer"
-	"log"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CandlesService struct {
-	intervalMillis int
+	intervalMillis         int
+	allowedIntervalsMillis []int
+	// Shared by every client stream, so each exchange only holds a single upstream connection
+	tradeStreamers *tradestreamer.Aggregator
+	// Persists every emitted candle to serve GetCandles
+	store *candlestore.Store
+	// Keeps the exchanges connected without client streams
+	keepAlive       *streamSession
+	cancelKeepAlive context.CancelFunc
+	// Closes the candle buckets, the wall clock unless a tape is replayed
+	clock clock.Clock
 }
 
-func NewCandlesService(intervalMillis int) *CandlesService {
-	return &CandlesService{
-		intervalMillis: intervalMillis,
+// Option configures a CandlesService
+type Option func(*options)
+
+type options struct {
+	lookup func(name string) (exchange.AdapterFactory, bool)
+	clock  clock.Clock
+}
+
+// Creates the adapters of the exchanges with lookup instead of the exchange registry, e.g. to replay a trade tape
+func WithAdapters(lookup func(name string) (exchange.AdapterFactory, bool)) Option {
+	return func(o *options) {
+		o.lookup = lookup
 	}
 }
 
-func (s *CandlesService) StreamCandles(
-	ctx context.Context,
-	req *connect.Request[candlesv1.StreamCandlesRequest],
-	serverstream *connect.ServerStream[candlesv1.StreamCandlesResponse],
-) error {
+// Runs the candle pipeline on c instead of the wall clock, see tradestreamer.Hub.SetClock
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
+	// Time to wait after a kline closes for the exchange to publish it
+	klineSettleDelay = time.Second
+)
+
+// Creates a new CandlesService
+//
+// intervalMillis is used when a request does not specify an interval, and is always allowed.
+// allowedIntervalsMillis lists the additional intervals clients may request. Every interval must be positive.
+// store persists emitted candles, and may be nil to disable persistence and GetCandles.
+// A hub is created for each exchange enabled in the config, which must be registered in the exchange registry
+func NewCandlesService(intervalMillis int, allowedIntervalsMillis []int, store *candlestore.Store, opts ...Option) (*CandlesService, error) {
+	o := options{lookup: exchange.Lookup, clock: clock.Real()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	allowed := []int{intervalMillis}
+	for _, interval := range append([]int{intervalMillis}, allowedIntervalsMillis...) {
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid interval: %dms, must be positive", interval)
+		}
+		if !slices.Contains(allowed, interval) {
+			allowed = append(allowed, interval)
+		}
+	}
+	slices.Sort(allowed)
+
 	cfg := cmd.GetConfig()
 	if cfg.TradeStreamBufferSize <= 0 {
 		cfg.TradeStreamBufferSize = 1000 // Default buffer size if not set
@@ -41,150 +99,738 @@ func (s *CandlesService) StreamCandles(
 		cfg.MaxTradesPerInterval = 10000 // Default max trades per interval if not set
 	}
 
+	// Initialize a hub for each enabled exchange
+	tradeStreamers, err := newTradeStreamers(cfg.EnabledExchanges, cfg.TradeStreamBufferSize, o.lookup)
+	if err != nil {
+		return nil, err
+	}
+	tradeStreamers.SetClock(o.clock)
+
+	return &CandlesService{
+		intervalMillis:         intervalMillis,
+		allowedIntervalsMillis: allowed,
+		tradeStreamers:         tradeStreamers,
+		store:                  store,
+		clock:                  o.clock,
+	}, nil
+}
+
+// Creates a hub for each of the named exchanges with the adapter factory returned by lookup
+func newTradeStreamers(names []string, bufferSize int, lookup func(name string) (exchange.AdapterFactory, bool)) (*tradestreamer.Aggregator, error) {
+	var factories []exchange.AdapterFactory
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		factory, ok := lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("exchange %q is not registered, must be one of %v", name, exchange.Registered())
+		}
+		factories = append(factories, factory)
+	}
+	if len(factories) == 0 {
+		return nil, fmt.Errorf("no exchanges are enabled, must enable at least one of %v", exchange.Registered())
+	}
+
+	hubs := make([]*tradestreamer.Hub, 0, len(factories))
+	for _, factory := range factories {
+		hubs = append(hubs, tradestreamer.NewHub(factory, bufferSize))
+	}
+	return tradestreamer.NewAggregator(hubs), nil
+}
+
+// Closes the upstream exchange connections shared by all streams
+func (s *CandlesService) Close() {
+	if s.keepAlive != nil {
+		s.cancelKeepAlive()
+		s.keepAlive.close()
+	}
+	s.tradeStreamers.Close()
+}
+
+// Streams trades of the symbols from every exchange until the service is closed
+//
+// This keeps the exchanges connected while no client is streaming, so their liveness can be checked.
+// An exchange that rejects every symbol, e.g. because it does not list the pair, is left out of ReadinessStatus
+func (s *CandlesService) KeepAlive(reqSymbols []string) error {
+	symbolPairs, err := s.parseSymbols(reqSymbols)
+	if err != nil {
+		return fmt.Errorf("failed to parse symbol: %w", err)
+	}
+	if len(symbolPairs) == 0 || s.keepAlive != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.keepAlive = newStreamSession(s.tradeStreamers, cmd.GetConfig().TradeStreamBufferSize, "KeepAlive", s.clock)
+	s.cancelKeepAlive = cancel
+	s.keepAlive.add(ctx, symbolPairs)
+
+	// Discard the trades so the subscriber's buffer never fills up
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.keepAlive.sub.Trades.C():
+			case <-s.keepAlive.sub.Gaps:
+			case rejection := <-s.keepAlive.sub.Rejections:
+				s.keepAlive.logger.Warn("Symbol rejected, the exchange is left out of the readiness check unless it streams another readiness symbol",
+					"exchange", rejection.Source, "symbol", rejection.Symbol, "reason", rejection.Reason)
+				s.keepAlive.reject(rejection)
+			case <-s.keepAlive.sub.StateChanges:
+			}
+		}
+	}()
+	return nil
+}
+
+// Records the frames and trades of every exchange with the recorder
+func (s *CandlesService) SetRecorder(recorder *tape.Recorder) {
+	s.tradeStreamers.SetRecorder(recorder)
+}
+
+// Returns the clock the candles and the exchange connections are timed on
+func (s *CandlesService) Clock() clock.Clock {
+	return s.clock
+}
+
+// Returns the liveness of the connection to every exchange
+func (s *CandlesService) Status() []tradestreamer.Status {
+	return s.tradeStreamers.Status()
+}
+
+// Returns the liveness of the exchanges the readiness is checked on, i.e. every exchange but the ones that rejected
+// every symbol kept alive, since they never stream a trade while no client is streaming
+func (s *CandlesService) ReadinessStatus() []tradestreamer.Status {
+	statuses := s.Status()
+	if s.keepAlive == nil {
+		return statuses
+	}
+	return slices.DeleteFunc(statuses, func(status tradestreamer.Status) bool {
+		return s.keepAlive.rejectedBy(status.Exchange)
+	})
+}
+
+func (s *CandlesService) StreamCandles(
+	ctx context.Context,
+	req *connect.Request[candlesv1.StreamCandlesRequest],
+	serverstream *connect.ServerStream[candlesv1.StreamCandlesResponse],
+) error {
+	cfg := cmd.GetConfig()
+
+	// Canceled with an error to end the stream early
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
 	// Parse incoming symbols
 	symbolPairs, err := s.parseSymbols(req.Msg.Symbols)
 	if err != nil {
 		return fmt.Errorf("failed to parse symbol: %w", err)
 	}
 
+	intervalMillis, err := s.resolveInterval(req.Msg.IntervalMillis)
+	if err != nil {
+		return err
+	}
+
+	mode, err := s.resolveMode(req.Msg.Mode)
+	if err != nil {
+		return err
+	}
+
+	tradeStreamers, err := s.resolveExchanges(req.Msg.Exchanges)
+	if err != nil {
+		return err
+	}
+
+	metrics.ActiveStreams.WithLabelValues("StreamCandles").Inc()
+	defer metrics.ActiveStreams.WithLabelValues("StreamCandles").Dec()
+
 	// Initialize channels
-	// This channel will receive trades from the trade streamers
-	tradeChannel := make(chan exchange.Trade, cfg.TradeStreamBufferSize)
+	// This session will receive trades from the shared exchange hubs
+	session := newStreamSession(tradeStreamers, cfg.TradeStreamBufferSize, "StreamCandles", s.clock)
 	// This channel buffers candles to be sent to the client
 	candleChannel := make(chan *candlesv1.StreamCandlesResponse)
+	statusChannel := make(chan *candlesv1.SubscribeCandlesResponse)
+
+	session.logger.Info("Stream opened", "peer", req.Peer().Addr, "interval_ms", intervalMillis, "mode", mode.String())
+	defer session.logger.Info("Stream closed")
 
-	// Initialize trade streamers for each exchange
-	binanceTradeStreamer := tradestreamer.NewTradeStreamer(binance.NewAdapter(tradeChannel))
-	bybitTradeStreamer := tradestreamer.NewTradeStreamer(bybit.NewAdapter(tradeChannel))
-	okxTradeStreamer := tradestreamer.NewTradeStreamer(okx.NewAdapter(tradeChannel))
+	session.add(ctx, symbolPairs)
+	defer session.close()
 
-	tradeStreamers := tradestreamer.NewAggregator([]*tradestreamer.TradeStreamer{
-		binanceTradeStreamer,
-		bybitTradeStreamer,
-		okxTradeStreamer,
+	go s.forwardTradesToCandles(ctx, cfg, intervalMillis, mode, session, candleChannel, statusChannel)
+
+	go s.processCandleChannel(ctx, session.logger, candleChannel, statusChannel, serverstream.Send, func(res *candlesv1.SubscribeCandlesResponse) error {
+		// StreamCandles has no status responses, so a symbol no exchange streams ends the stream instead of streaming nothing.
+		// A symbol rejected by only some exchanges is not reported, and streams from the others. Clients that need
+		// the status of each symbol use SubscribeCandles, and follow the state of the exchanges with StreamExchangeStatus
+		if status := res.GetStatus(); status != nil && session.rejectedEverywhere(status.Symbol) {
+			cancel(connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("symbol %s was rejected by every exchange: %s", status.Symbol, status.Reason)))
+		}
+		return nil
 	})
 
-	go tradeStreamers.StreamTrades(ctx, symbolPairs)
+	<-ctx.Done()
+	// The stream ends without an error once the client disconnects
+	var connectErr *connect.Error
+	if errors.As(context.Cause(ctx), &connectErr) {
+		return connectErr
+	}
 
-	go s.forwardTradesToCandles(ctx, cfg, tradeChannel, candleChannel)
+	return nil
+}
 
-	go s.processCandleChannel(ctx, candleChannel, serverstream)
+// Streams candles of a set of symbols that the client can change over the lifetime of the stream
+//
+// Each request adds or removes symbols. The interval, mode and exchanges are read from the first request only
+func (s *CandlesService) SubscribeCandles(
+	ctx context.Context,
+	stream *connect.BidiStream[candlesv1.SubscribeCandlesRequest, candlesv1.SubscribeCandlesResponse],
+) error {
+	cfg := cmd.GetConfig()
 
-	<-ctx.Done()
+	req, err := stream.Receive()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	intervalMillis, err := s.resolveInterval(req.IntervalMillis)
+	if err != nil {
+		return err
+	}
 
+	mode, err := s.resolveMode(req.Mode)
+	if err != nil {
+		return err
+	}
+
+	tradeStreamers, err := s.resolveExchanges(req.Exchanges)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	metrics.ActiveStreams.WithLabelValues("SubscribeCandles").Inc()
+	defer metrics.ActiveStreams.WithLabelValues("SubscribeCandles").Dec()
+
+	session := newStreamSession(tradeStreamers, cfg.TradeStreamBufferSize, "SubscribeCandles", s.clock)
+	candleChannel := make(chan *candlesv1.StreamCandlesResponse)
+	statusChannel := make(chan *candlesv1.SubscribeCandlesResponse)
+	defer session.close()
+
+	session.logger.Info("Stream opened", "peer", stream.Peer().Addr, "interval_ms", intervalMillis, "mode", mode.String())
+	defer session.logger.Info("Stream closed")
+
+	if err := s.applySubscription(ctx, session, req); err != nil {
+		return err
+	}
+
+	go s.forwardTradesToCandles(ctx, cfg, intervalMillis, mode, session, candleChannel, statusChannel)
+
+	go s.processCandleChannel(ctx, session.logger, candleChannel, statusChannel, func(candle *candlesv1.StreamCandlesResponse) error {
+		return stream.Send(&candlesv1.SubscribeCandlesResponse{Event: &candlesv1.SubscribeCandlesResponse_Candle{Candle: candle}})
+	}, stream.Send)
+
+	for {
+		req, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			// The client is done sending changes, keep streaming until it disconnects
+			<-ctx.Done()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.applySubscription(ctx, session, req); err != nil {
+			return err
+		}
+	}
+}
+
+// Adds or removes the symbols of a SubscribeCandles request from the session
+func (s *CandlesService) applySubscription(ctx context.Context, session *streamSession, req *candlesv1.SubscribeCandlesRequest) error {
+	symbolPairs, err := s.parseSymbols(req.Symbols)
+	if err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	switch req.Action {
+	case candlesv1.SubscribeCandlesRequest_ACTION_ADD:
+		session.add(ctx, symbolPairs)
+	case candlesv1.SubscribeCandlesRequest_ACTION_REMOVE:
+		session.remove(symbolPairs)
+	default:
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid action: %s", req.Action))
+	}
 	return nil
 }
 
+// Returns a page of stored candles of a symbol within [from, to)
+func (s *CandlesService) GetCandles(
+	ctx context.Context,
+	req *connect.Request[candlesv1.GetCandlesRequest],
+) (*connect.Response[candlesv1.GetCandlesResponse], error) {
+	if s.store == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, fmt.Errorf("candle store is disabled"))
+	}
+
+	symbolPairs, err := s.parseSymbols([]string{req.Msg.Symbol})
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	intervalMillis, err := s.resolveInterval(req.Msg.IntervalMillis)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Msg.To <= req.Msg.From {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("to (%d) must be after from (%d)", req.Msg.To, req.Msg.From))
+	}
+
+	pageSize := int(req.Msg.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	from := req.Msg.From
+	if req.Msg.PageToken != "" {
+		// The page token is the timestamp of the first candle of the next page
+		from, err = strconv.ParseInt(req.Msg.PageToken, 10, 64)
+		if err != nil || from < req.Msg.From {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page token: %s", req.Msg.PageToken))
+		}
+	}
+
+	// Candles are stored under the name of their exchange, which is matched case-insensitively like the exchanges of a stream
+	source := req.Msg.Source
+	if source != "" {
+		tradeStreamers, err := s.resolveExchanges([]string{source})
+		if err != nil {
+			return nil, err
+		}
+		source = tradeStreamers.Hubs[0].Name()
+	}
+
+	candles, next, err := s.store.Range(symbolPairs[0].Key(), source, intervalMillis, from, req.Msg.To, pageSize)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	res := &candlesv1.GetCandlesResponse{Candles: candles}
+	if next != 0 {
+		res.NextPageToken = strconv.FormatInt(next, 10)
+	}
+	return connect.NewResponse(res), nil
+}
+
+// Returns the connection state of every exchange
+func (s *CandlesService) GetExchangeStatus(
+	ctx context.Context,
+	req *connect.Request[candlesv1.GetExchangeStatusRequest],
+) (*connect.Response[candlesv1.GetExchangeStatusResponse], error) {
+	statuses := s.tradeStreamers.Status()
+	res := &candlesv1.GetExchangeStatusResponse{Exchanges: make([]*candlesv1.ExchangeStatus, 0, len(statuses))}
+	for _, status := range statuses {
+		res.Exchanges = append(res.Exchanges, toExchangeStatus(status))
+	}
+	return connect.NewResponse(res), nil
+}
+
+// Streams the status of the exchanges, followed by the status of a market of an exchange whenever its state changes
+func (s *CandlesService) StreamExchangeStatus(
+	ctx context.Context,
+	req *connect.Request[candlesv1.StreamExchangeStatusRequest],
+	serverstream *connect.ServerStream[candlesv1.ExchangeStatus],
+) error {
+	tradeStreamers, err := s.resolveExchanges(req.Msg.Exchanges)
+	if err != nil {
+		return err
+	}
+
+	metrics.ActiveStreams.WithLabelValues("StreamExchangeStatus").Inc()
+	defer metrics.ActiveStreams.WithLabelValues("StreamExchangeStatus").Dec()
+
+	// Watch before reading the current status, so no state change is missed
+	sub := tradestreamer.NewSubscriber(0, s.clock)
+	tradeStreamers.Watch(sub)
+	defer tradeStreamers.Unwatch(sub)
+
+	for _, status := range tradeStreamers.Status() {
+		if err := serverstream.Send(toExchangeStatus(status)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-sub.StateChanges:
+			if err := serverstream.Send(toStateChange(change)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var exchangeStates = map[tradestreamer.ConnectionState]candlesv1.ExchangeStatus_State{
+	tradestreamer.StateIdle:        candlesv1.ExchangeStatus_STATE_IDLE,
+	tradestreamer.StateConnecting:  candlesv1.ExchangeStatus_STATE_CONNECTING,
+	tradestreamer.StateConnected:   candlesv1.ExchangeStatus_STATE_CONNECTED,
+	tradestreamer.StateCircuitOpen: candlesv1.ExchangeStatus_STATE_CIRCUIT_OPEN,
+}
+
+// Converts the status of an exchange to its protobuf form. Unset times are zero
+func toExchangeStatus(status tradestreamer.Status) *candlesv1.ExchangeStatus {
+	res := &candlesv1.ExchangeStatus{
+		Exchange: status.Exchange,
+		State:    exchangeStates[status.State],
+		Failures: int32(status.Failures),
+	}
+	if !status.NextAttempt.IsZero() {
+		res.NextAttempt = status.NextAttempt.UnixMilli()
+	}
+	if !status.LastMessage.IsZero() {
+		res.LastMessage = status.LastMessage.UnixMilli()
+	}
+	return res
+}
+
+// Converts the state change of a market to its protobuf form
+func toStateChange(change tradestreamer.StateChange) *candlesv1.ExchangeStatus {
+	status := toExchangeStatus(change.Status)
+	status.Market = change.Market.String()
+	return status
+}
+
 // Parses incoming symbols to exchange.SymbolPair format
 //
-// Ex: "btc-usdt" -> {First: "btc", Second: "usdt"}
+// Ex: "btc-usdt" -> {First: "btc", Second: "usdt"}, "btc-usdt:perp" -> {First: "btc", Second: "usdt", Market: "perp"}
 func (s *CandlesService) parseSymbols(reqSymbols []string) ([]exchange.SymbolPair, error) {
 	var symbolPairs []exchange.SymbolPair
 	for _, reqSymbol := range reqSymbols {
-		parts := strings.Split(reqSymbol, "-")
+		// The market is an optional suffix, e.g. btc-usdt:perp
+		pair, marketName, _ := strings.Cut(reqSymbol, ":")
+		market, err := exchange.ParseMarket(marketName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbol %s: %w", reqSymbol, err)
+		}
+		if market != exchange.MarketSpot && !s.tradeStreamers.SupportsMarket(market) {
+			return nil, fmt.Errorf("invalid symbol %s: no exchange supports the %s market", reqSymbol, market)
+		}
+
+		parts := strings.Split(pair, "-")
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid symbol format: %s", reqSymbol)
 		}
-		symbolPairs = append(symbolPairs, exchange.SymbolPair{First: parts[0], Second: parts[1]})
+		symbolPairs = append(symbolPairs, exchange.SymbolPair{First: parts[0], Second: parts[1], Market: market})
 	}
 	return symbolPairs, nil
 }
 
-// Forwards trades to the candles channel at a specified interval
-func (s *CandlesService) forwardTradesToCandles(ctx context.Context, cfg *cmd.Config, tradeChannel <-chan exchange.Trade, candleChannel chan<- *candlesv1.StreamCandlesResponse) {
-	ticker := time.NewTicker(time.Duration(int32(s.intervalMillis)) * time.Millisecond)
-	defer ticker.Stop()
-	tradesMu := &sync.Mutex{}
+// Resolves the candle interval requested by the client
+//
+// Returns the server default when the request does not specify one,
+// and an InvalidArgument error when the interval is not allowed
+func (s *CandlesService) resolveInterval(reqIntervalMillis int64) (int, error) {
+	if reqIntervalMillis == 0 {
+		return s.intervalMillis, nil
+	}
+	if !slices.Contains(s.allowedIntervalsMillis, int(reqIntervalMillis)) {
+		return 0, connect.NewError(
+			connect.CodeInvalidArgument,
+			fmt.Errorf("interval %dms is not allowed, must be one of %v", reqIntervalMillis, s.allowedIntervalsMillis),
+		)
+	}
+	return int(reqIntervalMillis), nil
+}
+
+// Resolves the candles requested by the client
+//
+// Returns the consolidated mode when the request does not specify one,
+// and an InvalidArgument error when the mode is unknown
+func (s *CandlesService) resolveMode(reqMode candlesv1.CandleMode) (candlesv1.CandleMode, error) {
+	switch reqMode {
+	case candlesv1.CandleMode_CANDLE_MODE_UNSPECIFIED:
+		return candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, nil
+	case candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, candlesv1.CandleMode_CANDLE_MODE_PER_SOURCE, candlesv1.CandleMode_CANDLE_MODE_ALL:
+		return reqMode, nil
+	default:
+		return 0, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown candle mode: %d", reqMode))
+	}
+}
 
-	trades := map[string][]exchange.Trade{}
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case trade := <-tradeChannel:
-			if len(trades) >= cfg.MaxTradesPerInterval {
-				// TODO: Send an alert to increase buffer size
-				log.Printf("Max trades per interval reached (%d), dropping trades", cfg.MaxTradesPerInterval)
-				continue
+// Resolves the exchanges requested by the client
+//
+// Returns every exchange when the request does not specify any,
+// and an InvalidArgument error listing the valid names when an exchange is unknown
+func (s *CandlesService) resolveExchanges(reqExchanges []string) (*tradestreamer.Aggregator, error) {
+	tradeStreamers, err := s.tradeStreamers.Select(reqExchanges)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return tradeStreamers, nil
+}
+
+// Klines fetched to rebuild the candles of a period an exchange was disconnected
+type klineBackfill struct {
+	klines   []exchange.Kline
+	interval time.Duration
+}
+
+// Groups trades into interval buckets by trade timestamp,
+// and forwards each candle to the candles channel once the clock passes the end of its bucket
+//
+// Late trades within the allowed lateness cause an amended candle with a new revision to be forwarded,
+// and each candle is forwarded a last time with the final flag once the allowed lateness has passed.
+// When an exchange reconnects, the candles of the period it was disconnected are rebuilt from its klines
+// and forwarded again as corrected candles.
+// Symbols rejected by an exchange are forwarded to the status channel.
+// Trades and candles of symbols removed from the session are skipped.
+// Each trade and bucket flush is released once processed, so a virtual clock replays the same candles on every run
+func (s *CandlesService) forwardTradesToCandles(ctx context.Context, cfg *cmd.Config, intervalMillis int, mode candlesv1.CandleMode, session *streamSession, candleChannel chan<- *candlesv1.StreamCandlesResponse, statusChannel chan<- *candlesv1.SubscribeCandlesResponse) {
+	streamStart := s.clock.Now()
+	buckets := newCandleBuckets(mode, intervalMillis, cfg.CandleAllowedLateness, cfg.KlineBackfillWindow)
+	backfillChannel := make(chan klineBackfill)
+	timer := s.clock.NewTimer(buckets.nextFlush(streamStart).Sub(streamStart))
+	defer timer.Stop()
+
+	// Consolidated candles of a subset of the exchanges are not stored, as they would overwrite the candles of every exchange
+	storesConsolidated := len(session.tradeStreamers.Hubs) == len(s.tradeStreamers.Hubs)
+
+	// The first trade and candle are recorded as events of the stream's span
+	streamSpan := trace.SpanFromContext(ctx)
+	firstTrade, firstCandle := true, true
+
+	forward := func(candles []*candlesv1.StreamCandlesResponse) bool {
+		if len(candles) == 0 {
+			return true
+		}
+		_, span := tracing.Tracer().Start(ctx, "CandlesService.emitCandles", trace.WithAttributes(
+			attribute.Int("candles", len(candles)),
+			attribute.Int("interval_ms", intervalMillis),
+		))
+		defer span.End()
+
+		if s.store != nil {
+			// Buckets that began before the stream started or the symbol was added miss the trades before it,
+			// and would overwrite the complete candles stored by other streams
+			stored := slices.DeleteFunc(slices.Clone(candles), func(candle *candlesv1.StreamCandlesResponse) bool {
+				return (!storesConsolidated && candle.Source == "") ||
+					candle.Timestamp < streamStart.UnixMilli() ||
+					!session.subscribedBefore(candle.Symbol, candle.Timestamp)
+			})
+			if err := s.store.Put(intervalMillis, stored); err != nil {
+				session.logger.Error("Failed to store candles", "error", err)
 			}
+		}
 
-			// Initialize the slice for the symbol if it doesn't exist
-			if trades[trade.Symbol] == nil {
-				trades[trade.Symbol] = []exchange.Trade{}
+		for _, candle := range candles {
+			if !session.has(candle.Symbol) {
+				continue
 			}
-			// Append the trade to the slice for the symbol
-			tradesMu.Lock()
-			trades[trade.Symbol] = append(trades[trade.Symbol], trade)
-			tradesMu.Unlock()
-
-		case <-ticker.C:
-			for symbol, t := range trades {
-				if len(t) == 0 {
-					continue
+			select {
+			case candleChannel <- candle:
+				if firstCandle {
+					streamSpan.AddEvent("first candle", trace.WithAttributes(attribute.String("symbol", candle.Symbol)))
+					firstCandle = false
 				}
-				// copy trades
-				tradesMu.Lock()
-				tc := make([]exchange.Trade, len(t))
-				copy(tc, t)
-				// reset trades
-				trades[symbol] = t[:0]
-				tradesMu.Unlock()
-
-				candle := s.tradesToCandle(tc, symbol)
-				candleChannel <- candle
+				end := time.UnixMilli(candle.Timestamp + int64(intervalMillis))
+				metrics.CandleEmitLatency.WithLabelValues(strconv.FormatBool(candle.Final)).Observe(s.clock.Now().Sub(end).Seconds())
+			case <-ctx.Done():
+				return false
 			}
 		}
+		return true
+	}
+
+	add := func(trade exchange.Trade) {
+		if !session.has(trade.Symbol) {
+			return
+		}
+		if firstTrade {
+			streamSpan.AddEvent("first trade", trace.WithAttributes(
+				attribute.String("exchange", trade.Source),
+				attribute.String("symbol", trade.Symbol),
+			))
+			firstTrade = false
+		}
+		if buckets.trades >= cfg.MaxTradesPerInterval {
+			// TODO: Send an alert to increase buffer size
+			session.logger.Warn("Max trades per interval reached, dropping trades", "max_trades", cfg.MaxTradesPerInterval, "symbols", exchange.SymbolKeys(session.list()))
+			metrics.DroppedTrades.WithLabelValues(metrics.DropReasonMaxTrades).Inc()
+			return
+		}
+
+		if !buckets.add(trade) {
+			metrics.DroppedTrades.WithLabelValues(metrics.DropReasonLate).Inc()
+		}
 	}
-}
 
-// Sends candles to the server stream
-// This is separate from the trade processing to avoid blocking, and write methods are not concurrent-safe
-func (s *CandlesService) processCandleChannel(ctx context.Context, candleChannel <-chan *candlesv1.StreamCandlesResponse, serverstream *connect.ServerStream[candlesv1.StreamCandlesResponse]) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case candle := <-candleChannel:
-			if candle == nil {
+		case trade := <-session.sub.Trades.C():
+			add(trade)
+
+		case gap := <-session.sub.Gaps:
+			// Trades before the stream started were never part of its candles
+			if gap.From.Before(streamStart) {
+				gap.From = streamStart
+			}
+			go s.backfillGap(ctx, session.logger, gap, intervalMillis, session.list(), backfillChannel)
+
+		case rejection := <-session.sub.Rejections:
+			if !session.has(rejection.Symbol) {
 				continue
 			}
-			if err := serverstream.Send(candle); err != nil {
-				log.Printf("failed to send candle: %v", err)
+			session.logger.Warn("Symbol rejected", "exchange", rejection.Source, "symbol", rejection.Symbol, "reason", rejection.Reason)
+			session.reject(rejection)
+
+			select {
+			case statusChannel <- &candlesv1.SubscribeCandlesResponse{Event: &candlesv1.SubscribeCandlesResponse_Status{Status: &candlesv1.SymbolStatus{
+				Symbol: rejection.Symbol,
+				Source: rejection.Source,
+				State:  candlesv1.SymbolStatus_STATE_REJECTED,
+				Reason: rejection.Reason,
+			}}}:
+			case <-ctx.Done():
+				return
+			}
+
+		case change := <-session.sub.StateChanges:
+			session.logger.Info("Exchange state changed", "exchange", change.Exchange, "market", change.Market.String(), "state", change.State.String())
+
+			select {
+			case statusChannel <- &candlesv1.SubscribeCandlesResponse{Event: &candlesv1.SubscribeCandlesResponse_ExchangeStatus{ExchangeStatus: toStateChange(change)}}:
+			case <-ctx.Done():
+				return
+			}
+
+		case backfill := <-backfillChannel:
+			buckets.backfill(backfill.klines, backfill.interval)
+			if !forward(buckets.flush(s.clock.Now())) {
+				return
+			}
+
+		case now := <-timer.C():
+			if buckets.droppedLateTrades > 0 {
+				session.logger.Warn("Dropped trades that arrived after the allowed lateness", "dropped", buckets.droppedLateTrades, "allowed_lateness_ms", cfg.CandleAllowedLateness)
+				buckets.droppedLateTrades = 0
+			}
+
+			forwarded := forward(buckets.flush(now))
+			// Rearming releases a virtual clock, which then cannot pass the next flush unnoticed
+			now = s.clock.Now()
+			timer.Reset(buckets.nextFlush(now).Sub(now))
+			if !forwarded {
 				return
 			}
 		}
 	}
 }
 
-// Converts a slice of trades into a candle
-func (s *CandlesService) tradesToCandle(trades []exchange.Trade, symbol string) *candlesv1.StreamCandlesResponse {
-	if len(trades) == 0 {
-		return nil
+// Fetches the klines of the symbols for the period an exchange was disconnected
+//
+// Waits for the bucket containing the reconnection to close first, so the exchange's klines are complete
+func (s *CandlesService) backfillGap(ctx context.Context, logger *slog.Logger, gap tradestreamer.Gap, intervalMillis int, symbols []exchange.SymbolPair, backfillChannel chan<- klineBackfill) {
+	// Klines of a spot-only exchange are spot klines, whatever the market of the symbol
+	fetcher, ok := s.tradeStreamers.KlineFetcher(gap.Source, gap.Market)
+	if !ok {
+		return
+	}
+	symbols = slices.DeleteFunc(symbols, func(symbol exchange.SymbolPair) bool {
+		return symbol.Market != gap.Market
+	})
+	if len(symbols) == 0 {
+		return
+	}
+	logger = logger.With("exchange", gap.Source, "symbols", exchange.SymbolKeys(symbols))
+
+	interval := time.Duration(intervalMillis) * time.Millisecond
+	klineInterval, ok := exchange.KlineIntervalFor(fetcher, interval)
+	if !ok {
+		logger.Warn("Cannot backfill gap, no kline interval divides the candle interval", "interval", interval)
+		return
 	}
 
-	open := trades[0].Price
-	high := open
-	low := open
-	close := trades[len(trades)-1].Price
-	volume := 0.0
+	// Align to the epoch like the candle buckets
+	bucketStart := func(t time.Time) time.Time {
+		ms := t.UnixMilli()
+		return time.UnixMilli(ms - ms%int64(intervalMillis))
+	}
 
-	for _, trade := range trades {
-		if trade.Price > high {
-			high = trade.Price
+	from := bucketStart(gap.From)
+	if window := s.clock.Now().Add(-time.Duration(cmd.GetConfig().KlineBackfillWindow) * time.Millisecond); from.Before(window) {
+		from = bucketStart(window)
+	}
+	// Start of the last kline of the bucket containing the reconnection
+	to := bucketStart(gap.To).Add(interval - klineInterval)
+
+	logger.Info("Backfilling candles", "from", from, "to", to)
+
+	timer := s.clock.NewTimer(to.Add(klineInterval + klineSettleDelay).Sub(s.clock.Now()))
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-ctx.Done():
+		return
+	}
+
+	for _, symbol := range symbols {
+		klines, err := fetcher.FetchKlines(ctx, symbol, klineInterval, from, to)
+		if err != nil {
+			logger.Error("Failed to backfill candles", "symbol", symbol.Key(), "error", err)
+			continue
 		}
-		if trade.Price < low {
-			low = trade.Price
+
+		select {
+		case backfillChannel <- klineBackfill{klines: klines, interval: klineInterval}:
+		case <-ctx.Done():
+			return
 		}
-		volume += trade.Quantity
 	}
+}
 
-	return &candlesv1.StreamCandlesResponse{
-		Symbol:    symbol,
-		Timestamp: time.Now().Unix(),
-		Open:      open,
-		High:      high,
-		Low:       low,
-		Close:     close,
-		Volume:    volume,
+// Sends candles, and the statuses of the symbols and exchanges, to the client stream
+// This is separate from the trade processing to avoid blocking, and write methods are not concurrent-safe
+func (s *CandlesService) processCandleChannel(
+	ctx context.Context,
+	logger *slog.Logger,
+	candleChannel <-chan *candlesv1.StreamCandlesResponse,
+	statusChannel <-chan *candlesv1.SubscribeCandlesResponse,
+	send func(*candlesv1.StreamCandlesResponse) error,
+	sendStatus func(*candlesv1.SubscribeCandlesResponse) error,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case candle := <-candleChannel:
+			if candle == nil {
+				continue
+			}
+			if err := send(candle); err != nil {
+				logger.Warn("Failed to send candle", "error", err)
+				return
+			}
+		case status := <-statusChannel:
+			if err := sendStatus(status); err != nil {
+				logger.Warn("Failed to send status", "error", err)
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,690 @@
+package candles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"hermeneutic-candles/internal/candlestore"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	_ "hermeneutic-candles/internal/exchange/all"
+	"hermeneutic-candles/internal/exchange/replay"
+	"hermeneutic-candles/internal/tape"
+	"hermeneutic-candles/internal/tradestreamer"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/gorilla/websocket"
+)
+
+func TestCandlesService_ResolveInterval(t *testing.T) {
+	service, err := NewCandlesService(5000, []int{1000, 60000}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		input       int64
+		expected    int
+		shouldError bool
+	}{
+		{
+			name:     "unset interval uses server default",
+			input:    0,
+			expected: 5000,
+		},
+		{
+			name:     "server default is always allowed",
+			input:    5000,
+			expected: 5000,
+		},
+		{
+			name:     "allowed interval",
+			input:    60000,
+			expected: 60000,
+		},
+		{
+			name:        "interval not allowed",
+			input:       2000,
+			shouldError: true,
+		},
+		{
+			name:        "negative interval",
+			input:       -1000,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.resolveInterval(tt.input)
+
+			if tt.shouldError {
+				var connectErr *connect.Error
+				if !errors.As(err, &connectErr) {
+					t.Fatalf("Expected connect error but got %v", err)
+				}
+				if connectErr.Code() != connect.CodeInvalidArgument {
+					t.Errorf("Expected code %v, got %v", connect.CodeInvalidArgument, connectErr.Code())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected interval %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestNewCandlesService_InvalidInterval(t *testing.T) {
+	if _, err := NewCandlesService(0, nil, nil); err == nil {
+		t.Errorf("Expected an error for a zero default interval")
+	}
+	if _, err := NewCandlesService(1000, []int{60000, -1}, nil); err == nil {
+		t.Errorf("Expected an error for a negative allowed interval")
+	}
+}
+
+func TestCandlesService_ParseSymbols(t *testing.T) {
+	service, err := NewCandlesService(5000, []int{1000, 60000}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    exchange.SymbolPair
+		shouldError bool
+	}{
+		{
+			name:     "spot symbol",
+			input:    "btc-usdt",
+			expected: exchange.SymbolPair{First: "btc", Second: "usdt"},
+		},
+		{
+			name:     "explicit spot market",
+			input:    "btc-usdt:spot",
+			expected: exchange.SymbolPair{First: "btc", Second: "usdt"},
+		},
+		{
+			name:     "perp market",
+			input:    "btc-usdt:perp",
+			expected: exchange.SymbolPair{First: "btc", Second: "usdt", Market: exchange.MarketPerp},
+		},
+		{
+			name:        "unknown market",
+			input:       "btc-usdt:options",
+			shouldError: true,
+		},
+		{
+			name:        "missing quote",
+			input:       "btc:perp",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.parseSymbols([]string{tt.input})
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result) != 1 || result[0] != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCandlesService_ApplySubscription(t *testing.T) {
+	service := &CandlesService{tradeStreamers: tradestreamer.NewAggregator(nil)}
+	session := newStreamSession(service.tradeStreamers, 10, "SubscribeCandles", clock.Real())
+
+	tests := []struct {
+		name        string
+		request     *candlesv1.SubscribeCandlesRequest
+		expected    []string
+		shouldError bool
+	}{
+		{
+			name: "add symbols",
+			request: &candlesv1.SubscribeCandlesRequest{
+				Action:  candlesv1.SubscribeCandlesRequest_ACTION_ADD,
+				Symbols: []string{"btc-usdt", "eth-usdt"},
+			},
+			expected: []string{"btcusdt", "ethusdt"},
+		},
+		{
+			name: "adding a subscribed symbol is a no-op",
+			request: &candlesv1.SubscribeCandlesRequest{
+				Action:  candlesv1.SubscribeCandlesRequest_ACTION_ADD,
+				Symbols: []string{"btc-usdt"},
+			},
+			expected: []string{"btcusdt", "ethusdt"},
+		},
+		{
+			name: "remove symbols",
+			request: &candlesv1.SubscribeCandlesRequest{
+				Action:  candlesv1.SubscribeCandlesRequest_ACTION_REMOVE,
+				Symbols: []string{"btc-usdt", "sol-usdt"},
+			},
+			expected: []string{"ethusdt"},
+		},
+		{
+			name: "unspecified action",
+			request: &candlesv1.SubscribeCandlesRequest{
+				Symbols: []string{"sol-usdt"},
+			},
+			expected:    []string{"ethusdt"},
+			shouldError: true,
+		},
+		{
+			name: "invalid symbol",
+			request: &candlesv1.SubscribeCandlesRequest{
+				Action:  candlesv1.SubscribeCandlesRequest_ACTION_ADD,
+				Symbols: []string{"solusdt"},
+			},
+			expected:    []string{"ethusdt"},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.applySubscription(context.Background(), session, tt.request)
+
+			if tt.shouldError {
+				var connectErr *connect.Error
+				if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeInvalidArgument {
+					t.Errorf("Expected InvalidArgument error but got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keys []string
+			for _, symbol := range session.list() {
+				keys = append(keys, symbol.Key())
+			}
+			if !slices.Equal(keys, tt.expected) {
+				t.Errorf("Expected symbols %v, got %v", tt.expected, keys)
+			}
+		})
+	}
+}
+
+func TestNewTradeStreamers(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		expected    []string
+		shouldError bool
+	}{
+		{
+			name:     "enabled exchanges",
+			input:    []string{"binance", "OKX"},
+			expected: []string{"Binance", "Okx"},
+		},
+		{
+			name:     "blank names are skipped",
+			input:    []string{" bybit ", ""},
+			expected: []string{"Bybit"},
+		},
+		{
+			name:        "unregistered exchange",
+			input:       []string{"binance", "bitstamp"},
+			shouldError: true,
+		},
+		{
+			name:        "no exchanges",
+			input:       nil,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newTradeStreamers(tt.input, 10, exchange.Lookup)
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer result.Close()
+			if !slices.Equal(result.Names(), tt.expected) {
+				t.Errorf("Expected exchanges %v, got %v", tt.expected, result.Names())
+			}
+		})
+	}
+}
+
+func TestCandlesService_GetExchangeStatus(t *testing.T) {
+	service, err := NewCandlesService(5000, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	// No symbols are subscribed, so no exchange is streaming
+	res, err := service.GetExchangeStatus(context.Background(), connect.NewRequest(&candlesv1.GetExchangeStatusRequest{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, status := range res.Msg.Exchanges {
+		names = append(names, status.Exchange)
+		if status.State != candlesv1.ExchangeStatus_STATE_IDLE || status.NextAttempt != 0 || status.LastMessage != 0 {
+			t.Errorf("Expected %s to be idle, got %v", status.Exchange, status)
+		}
+	}
+	if !slices.Equal(names, []string{"Binance", "Bybit", "Okx"}) {
+		t.Errorf("Expected the enabled exchanges in order, got %v", names)
+	}
+
+	// Times are converted to milliseconds since epoch
+	nextAttempt := time.UnixMilli(1700000000000)
+	status := toExchangeStatus(tradestreamer.Status{Exchange: "Bybit", State: tradestreamer.StateCircuitOpen, Failures: 10, NextAttempt: nextAttempt})
+	if status.State != candlesv1.ExchangeStatus_STATE_CIRCUIT_OPEN || status.Failures != 10 || status.NextAttempt != 1700000000000 || status.LastMessage != 0 {
+		t.Errorf("Unexpected status %v", status)
+	}
+}
+
+func TestCandlesService_ReadinessStatus(t *testing.T) {
+	service, err := NewCandlesService(5000, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	exchanges := func() []string {
+		var names []string
+		for _, status := range service.ReadinessStatus() {
+			names = append(names, status.Exchange)
+		}
+		return names
+	}
+	if names := exchanges(); !slices.Equal(names, []string{"Binance", "Bybit", "Okx"}) {
+		t.Errorf("Expected every exchange without keep alive symbols, got %v", names)
+	}
+
+	// The symbols are set without subscribing, so no exchange is connected
+	service.keepAlive = newStreamSession(service.tradeStreamers, 10, "KeepAlive", service.clock)
+	_, service.cancelKeepAlive = context.WithCancel(context.Background())
+	for _, symbol := range []exchange.SymbolPair{{First: "btc", Second: "usdt"}, {First: "eth", Second: "usdt"}} {
+		service.keepAlive.symbols[symbol.Key()] = symbol
+	}
+
+	service.keepAlive.reject(tradestreamer.Rejection{Source: "Okx", Symbol: "btcusdt", Reason: "unknown symbol"})
+	if names := exchanges(); !slices.Equal(names, []string{"Binance", "Bybit", "Okx"}) {
+		t.Errorf("Expected an exchange streaming one of the symbols to be checked, got %v", names)
+	}
+	service.keepAlive.reject(tradestreamer.Rejection{Source: "Okx", Symbol: "ethusdt", Reason: "unknown symbol"})
+	if names := exchanges(); !slices.Equal(names, []string{"Binance", "Bybit"}) {
+		t.Errorf("Expected the exchange that rejected every symbol to be left out, got %v", names)
+	}
+}
+
+func formatCandle(candle *candlesv1.StreamCandlesResponse) string {
+	return fmt.Sprintf("%d r%d final=%t o=%g h=%g l=%g c=%g v=%g %v",
+		candle.Timestamp, candle.Revision, candle.Final, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.Sources)
+}
+
+// Replays the tape in dir with the candle pipeline, and returns the candles of btc-usdt it forwarded
+func replayCandles(t *testing.T, dir string, speed float64) []string {
+	t.Helper()
+	source, err := replay.NewSource(replay.Options{Dir: dir, Speed: speed, Tail: 4 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open tape: %v", err)
+	}
+	defer source.Close()
+	service, err := NewCandlesService(1000, nil, nil, WithAdapters(source.Lookup), WithClock(source.Clock()))
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newStreamSession(service.tradeStreamers, 100, "StreamCandles", service.clock)
+	defer session.close()
+	candleChannel := make(chan *candlesv1.StreamCandlesResponse)
+	statusChannel := make(chan *candlesv1.SubscribeCandlesResponse, 100)
+	session.add(ctx, []exchange.SymbolPair{{First: "btc", Second: "usdt"}})
+	go service.forwardTradesToCandles(ctx, cmd.GetConfig(), 1000, candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, session, candleChannel, statusChannel)
+
+	done := make(chan error, 1)
+	go func() { done <- source.Run(ctx) }()
+
+	var candles []string
+	for {
+		select {
+		case candle := <-candleChannel:
+			candles = append(candles, formatCandle(candle))
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Failed to replay tape: %v", err)
+			}
+			return candles
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Replay timed out after %v", candles)
+		}
+	}
+}
+
+func TestCandlesService_Replay(t *testing.T) {
+	dir := t.TempDir()
+	recorder := tape.NewRecorder(tape.Options{Dir: dir, MaxFileSize: 1 << 20, MaxFileAge: time.Hour, DiskBudget: 1 << 20, Frames: true})
+	start := time.UnixMilli(1753453611000)
+	binance := func(price string, ms int64) []byte {
+		return fmt.Appendf(nil, `{"stream":"btcusdt@trade","data":{"s":"BTCUSDT","p":"%s","q":"1","T":%d}}`, price, ms)
+	}
+	bybit := func(price string, ms int64) []byte {
+		return fmt.Appendf(nil, `{"topic":"publicTrade.BTCUSDT","data":[{"s":"BTCUSDT","S":"Buy","p":"%s","v":"2","T":%d}]}`, price, ms)
+	}
+	frames := []struct {
+		exchange string
+		received time.Duration
+		frame    []byte
+	}{
+		{"Binance", 100 * time.Millisecond, binance("100", start.UnixMilli()+50)},
+		{"Bybit", 200 * time.Millisecond, bybit("101", start.UnixMilli()+150)},
+		{"Binance", 1100 * time.Millisecond, binance("102", start.UnixMilli()+1050)},
+		// Received after its bucket closed, within the allowed lateness, so the bucket is amended
+		{"Bybit", 1300 * time.Millisecond, bybit("99", start.UnixMilli()+900)},
+		{"Binance", 2500 * time.Millisecond, binance("103", start.UnixMilli()+2400)},
+	}
+	for _, f := range frames {
+		recorder.RecordFrame(f.exchange, exchange.MarketSpot, start.Add(f.received), f.frame)
+	}
+	recorder.Close()
+
+	expected := []string{
+		"1753453611000 r0 final=false o=100 h=101 l=100 c=101 v=3 [Binance Bybit]",
+		"1753453611000 r1 final=false o=100 h=101 l=99 c=99 v=5 [Binance Bybit]",
+		"1753453612000 r0 final=false o=102 h=102 l=102 c=102 v=1 [Binance]",
+		"1753453611000 r1 final=true o=100 h=101 l=99 c=99 v=5 [Binance Bybit]",
+		"1753453613000 r0 final=false o=103 h=103 l=103 c=103 v=1 [Binance]",
+		"1753453612000 r0 final=true o=102 h=102 l=102 c=102 v=1 [Binance]",
+		"1753453613000 r0 final=true o=103 h=103 l=103 c=103 v=1 [Binance]",
+	}
+	// Playing as fast as possible and in scaled real time replays the same candles
+	for _, speed := range []float64{0, 0, 20} {
+		if candles := replayCandles(t, dir, speed); !slices.Equal(candles, expected) {
+			t.Errorf("Speed %g: expected candles\n%s\ngot\n%s", speed, strings.Join(expected, "\n"), strings.Join(candles, "\n"))
+		}
+	}
+}
+
+func TestCandlesService_CloseBuckets(t *testing.T) {
+	start := time.UnixMilli(1753453611500)
+	fake := fakeclock.New(start)
+	service, err := NewCandlesService(1000, nil, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	cfg := *cmd.GetConfig()
+	cfg.CandleAllowedLateness = 2000
+
+	// Trades are sent to the session directly, without connecting to the exchanges
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newStreamSession(service.tradeStreamers, 0, "StreamCandles", service.clock)
+	session.symbols["btcusdt"] = exchange.SymbolPair{First: "btc", Second: "usdt"}
+	candleChannel := make(chan *candlesv1.StreamCandlesResponse, 10)
+	statusChannel := make(chan *candlesv1.SubscribeCandlesResponse, 10)
+	go service.forwardTradesToCandles(ctx, &cfg, 1000, candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, session, candleChannel, statusChannel)
+
+	trade := func(price float64, ms int64) {
+		session.sub.Trades.Send(exchange.Trade{Symbol: "btcusdt", Price: price, Quantity: 1, Timestamp: time.UnixMilli(ms), Source: "Binance"})
+	}
+	// Advances the clock to the next flush, and returns the candles it forwarded
+	flush := func(d time.Duration) []string {
+		t.Helper()
+		wait, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := fake.WaitForTimers(wait, 1); err != nil {
+			t.Fatalf("Expected the flush timer to be armed: %v", err)
+		}
+		fake.Advance(d)
+		// The timer is rearmed once the flush is forwarded
+		if err := fake.WaitForTimers(wait, 1); err != nil {
+			t.Fatalf("Expected the flush timer to be rearmed: %v", err)
+		}
+		var candles []string
+		for len(candleChannel) > 0 {
+			candles = append(candles, formatCandle(<-candleChannel))
+		}
+		return candles
+	}
+
+	trade(100, 1753453611200)
+	if candles, expected := flush(500*time.Millisecond), []string{"1753453611000 r0 final=false o=100 h=100 l=100 c=100 v=1 [Binance]"}; !slices.Equal(candles, expected) {
+		t.Errorf("Expected the bucket to close at its end with %v, got %v", expected, candles)
+	}
+
+	// A late trade within the allowed lateness revises the closed bucket
+	trade(99, 1753453611800)
+	if candles, expected := flush(time.Second), []string{"1753453611000 r1 final=false o=100 h=100 l=99 c=99 v=2 [Binance]"}; !slices.Equal(candles, expected) {
+		t.Errorf("Expected the revised bucket %v, got %v", expected, candles)
+	}
+
+	// The bucket is final once the allowed lateness passed, and later trades are dropped
+	if candles, expected := flush(time.Second), []string{"1753453611000 r1 final=true o=100 h=100 l=99 c=99 v=2 [Binance]"}; !slices.Equal(candles, expected) {
+		t.Errorf("Expected the final bucket %v, got %v", expected, candles)
+	}
+	trade(98, 1753453611900)
+	if candles := flush(time.Second); len(candles) != 0 {
+		t.Errorf("Expected the trade after the final bucket to be dropped, got %v", candles)
+	}
+}
+
+func TestCandlesService_StoreCompleteBuckets(t *testing.T) {
+	store, err := candlestore.Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	// The symbol is added partway through the bucket starting at 1753453611000
+	start := time.UnixMilli(1753453611500)
+	fake := fakeclock.New(start)
+	service, err := NewCandlesService(1000, nil, store, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	cfg := *cmd.GetConfig()
+	cfg.CandleAllowedLateness = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newStreamSession(service.tradeStreamers, 0, "StreamCandles", service.clock)
+	session.symbols["btcusdt"] = exchange.SymbolPair{First: "btc", Second: "usdt"}
+	session.added["btcusdt"] = start
+	candleChannel := make(chan *candlesv1.StreamCandlesResponse, 10)
+	go service.forwardTradesToCandles(ctx, &cfg, 1000, candlesv1.CandleMode_CANDLE_MODE_CONSOLIDATED, session, candleChannel, make(chan *candlesv1.SubscribeCandlesResponse, 10))
+
+	for _, ms := range []int64{1753453611600, 1753453612200} {
+		session.sub.Trades.Send(exchange.Trade{Symbol: "btcusdt", Price: 100, Quantity: 1, Timestamp: time.UnixMilli(ms), Source: "Binance"})
+		wait, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := fake.WaitForTimers(wait, 1); err != nil {
+			t.Fatalf("Expected the flush timer to be armed: %v", err)
+		}
+		cancel()
+		fake.Advance(time.UnixMilli(ms).Truncate(time.Second).Add(time.Second).Sub(fake.Now()))
+		select {
+		case <-candleChannel:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a candle for the trade at %d", ms)
+		}
+	}
+
+	// Both candles are streamed, but only the bucket the stream saw from its start is stored
+	candles, _, err := store.Range("btcusdt", "", 1000, 0, math.MaxInt64, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(candles) != 1 || candles[0].Timestamp != 1753453612000 {
+		t.Errorf("Expected only the candle at 1753453612000 to be stored, got %v", candles)
+	}
+}
+
+func TestCandlesService_GetCandlesSource(t *testing.T) {
+	store, err := candlestore.Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	service, err := NewCandlesService(1000, nil, store)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer service.Close()
+
+	candle := &candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1753453612000, Open: 100, Close: 100, Source: "Binance", Final: true}
+	if err := store.Put(1000, []*candlesv1.StreamCandlesResponse{candle}); err != nil {
+		t.Fatalf("Failed to store candle: %v", err)
+	}
+
+	// The source is matched case-insensitively to the name the candles are stored under
+	res, err := service.GetCandles(context.Background(), connect.NewRequest(&candlesv1.GetCandlesRequest{
+		Symbol: "btc-usdt", IntervalMillis: 1000, From: 0, To: math.MaxInt64, Source: "binance",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res.Msg.Candles) != 1 || res.Msg.Candles[0].Source != "Binance" {
+		t.Errorf("Expected the stored Binance candle, got %v", res.Msg.Candles)
+	}
+
+	// An unknown source is an error instead of an empty page
+	_, err = service.GetCandles(context.Background(), connect.NewRequest(&candlesv1.GetCandlesRequest{
+		Symbol: "btc-usdt", IntervalMillis: 1000, From: 0, To: math.MaxInt64, Source: "binanse",
+	}))
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown source, got %v", err)
+	}
+}
+
+// klineAdapter fetches a kline of every symbol, keyed like the adapters of spot-only exchanges key them, whatever the market
+type klineAdapter struct {
+	name string
+}
+
+func (a *klineAdapter) Name() string                            { return a.name }
+func (a *klineAdapter) GetPongChan() <-chan time.Time           { return nil }
+func (a *klineAdapter) Subscribe([]exchange.SymbolPair) error   { return nil }
+func (a *klineAdapter) Unsubscribe([]exchange.SymbolPair) error { return nil }
+func (a *klineAdapter) HandleMessage([]byte) error              { return nil }
+func (a *klineAdapter) Ping() error                             { return nil }
+func (a *klineAdapter) ConnectAndSubscribe([]exchange.SymbolPair) (*websocket.Conn, error) {
+	return nil, errors.New("not connected")
+}
+func (a *klineAdapter) KlineIntervals() []time.Duration { return []time.Duration{time.Second} }
+func (a *klineAdapter) FetchKlines(_ context.Context, symbol exchange.SymbolPair, _ time.Duration, from, _ time.Time) ([]exchange.Kline, error) {
+	return []exchange.Kline{{Symbol: symbol.Key(), Start: from, Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, Source: a.name}}, nil
+}
+
+// perpKlineAdapter also streams perpetual swaps
+type perpKlineAdapter struct {
+	klineAdapter
+}
+
+func (a *perpKlineAdapter) Markets() []exchange.Market { return []exchange.Market{exchange.MarketPerp} }
+func (a *perpKlineAdapter) SetMarket(exchange.Market)  {}
+
+func TestCandlesService_BackfillGapMarket(t *testing.T) {
+	start := time.UnixMilli(1753453611500)
+	fake := fakeclock.New(start)
+	hubs := []*tradestreamer.Hub{
+		tradestreamer.NewHub(func(chan<- exchange.Trade) exchange.ExchangeAdapter { return &klineAdapter{name: "Coinbase"} }, 10),
+		tradestreamer.NewHub(func(chan<- exchange.Trade) exchange.ExchangeAdapter {
+			return &perpKlineAdapter{klineAdapter{name: "Binance"}}
+		}, 10),
+	}
+	service := &CandlesService{tradeStreamers: tradestreamer.NewAggregator(hubs), clock: fake}
+	defer service.tradeStreamers.Close()
+
+	session := newStreamSession(service.tradeStreamers, 0, "StreamCandles", service.clock)
+	for _, symbol := range []exchange.SymbolPair{{First: "btc", Second: "usdt"}, {First: "btc", Second: "usdt", Market: exchange.MarketPerp}} {
+		session.symbols[symbol.Key()] = symbol
+	}
+
+	// Returns the symbols of the klines backfilled for a gap of the market ending now
+	backfill := func(source string, market exchange.Market) []string {
+		t.Helper()
+		gap := tradestreamer.Gap{Source: source, Market: market, From: fake.Now().Add(-2 * time.Second), To: fake.Now()}
+		backfillChannel := make(chan klineBackfill, 10)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			service.backfillGap(context.Background(), session.logger, gap, 1000, session.list(), backfillChannel)
+		}()
+
+		// Klines are fetched once the last one settled
+		wait, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		armed := make(chan error, 1)
+		go func() { armed <- fake.WaitForTimers(wait, 1) }()
+		select {
+		case <-done:
+		case err := <-armed:
+			if err != nil {
+				t.Fatalf("Expected the backfill to wait for the klines to settle: %v", err)
+			}
+			fake.Advance(3 * time.Second)
+			<-done
+		}
+
+		var symbols []string
+		for len(backfillChannel) > 0 {
+			for _, kline := range (<-backfillChannel).klines {
+				symbols = append(symbols, kline.Symbol)
+			}
+		}
+		return symbols
+	}
+
+	if symbols := backfill("Coinbase", exchange.MarketSpot); !slices.Equal(symbols, []string{"btcusdt"}) {
+		t.Errorf("Expected only the spot symbol to be backfilled from a spot gap, got %v", symbols)
+	}
+	if symbols := backfill("Coinbase", exchange.MarketPerp); len(symbols) != 0 {
+		t.Errorf("Expected no backfill from an exchange without the market, got %v", symbols)
+	}
+	if symbols := backfill("Binance", exchange.MarketPerp); !slices.Equal(symbols, []string{"btcusdt:perp"}) {
+		t.Errorf("Expected only the perp symbol to be backfilled from a perp gap, got %v", symbols)
+	}
+}
@@ -0,0 +1,178 @@
+package candles
+
+import (
+	"context"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/logging"
+	"hermeneutic-candles/internal/tradestreamer"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The symbols a client stream is subscribed to
+//
+// The symbols of a SubscribeCandles stream change over its lifetime,
+// so they are guarded and subscribed on the shared exchange hubs incrementally
+type streamSession struct {
+	tradeStreamers *tradestreamer.Aggregator
+	sub            *tradestreamer.Subscriber
+	// Logs with the stream ID, to correlate the log lines of a stream
+	logger *slog.Logger
+	// Clock the symbols are added on, and the trades are queued on
+	clock clock.Clock
+
+	mu sync.Mutex
+	// Symbol key -> subscribed symbol
+	symbols map[string]exchange.SymbolPair
+	// Symbol key -> time the symbol was subscribed on the clock
+	added map[string]time.Time
+	// Symbol key -> exchanges that rejected the symbol
+	rejections map[string]map[string]struct{}
+}
+
+// Creates a new session with a random stream ID
+//
+// rpc is the name of the RPC serving the stream, and is logged with the stream ID
+func newStreamSession(tradeStreamers *tradestreamer.Aggregator, bufferSize int, rpc string, c clock.Clock) *streamSession {
+	return &streamSession{
+		tradeStreamers: tradeStreamers,
+		sub:            tradestreamer.NewSubscriber(bufferSize, c),
+		logger:         slog.With("stream_id", logging.NewStreamID(), "rpc", rpc),
+		clock:          c,
+		symbols:        map[string]exchange.SymbolPair{},
+		added:          map[string]time.Time{},
+		rejections:     map[string]map[string]struct{}{},
+	}
+}
+
+// Subscribes to the symbols that are not subscribed yet
+//
+// ctx carries the trace of the request adding the symbols
+func (s *streamSession) add(ctx context.Context, symbols []exchange.SymbolPair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []exchange.SymbolPair
+	for _, symbol := range symbols {
+		if _, ok := s.symbols[symbol.Key()]; ok {
+			continue
+		}
+		s.symbols[symbol.Key()] = symbol
+		s.added[symbol.Key()] = s.clock.Now()
+		added = append(added, symbol)
+	}
+	if len(added) > 0 {
+		s.logger.Info("Subscribing", "exchanges", s.tradeStreamers.Names(), "symbols", exchange.SymbolKeys(added))
+		s.tradeStreamers.Subscribe(ctx, added, s.sub)
+	}
+}
+
+// Unsubscribes from the symbols that are subscribed
+func (s *streamSession) remove(symbols []exchange.SymbolPair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []exchange.SymbolPair
+	for _, symbol := range symbols {
+		if _, ok := s.symbols[symbol.Key()]; !ok {
+			continue
+		}
+		delete(s.symbols, symbol.Key())
+		delete(s.added, symbol.Key())
+		delete(s.rejections, symbol.Key())
+		removed = append(removed, symbol)
+	}
+	if len(removed) > 0 {
+		s.logger.Info("Unsubscribing", "exchanges", s.tradeStreamers.Names(), "symbols", exchange.SymbolKeys(removed))
+		s.tradeStreamers.Unsubscribe(removed, s.sub)
+	}
+}
+
+// Unsubscribes from every symbol, and drops the trades left unreceived
+func (s *streamSession) close() {
+	s.remove(s.list())
+	s.sub.Trades.Close()
+}
+
+// Returns true if the symbol with the given key is subscribed
+func (s *streamSession) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.symbols[key]
+	return ok
+}
+
+// Returns true if the symbol with the given key was subscribed before the bucket starting at start in milliseconds,
+// so the session received every trade of the bucket
+func (s *streamSession) subscribedBefore(key string, start int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added, ok := s.added[key]
+	return ok && added.UnixMilli() <= start
+}
+
+// Records that an exchange rejected a subscribed symbol
+func (s *streamSession) reject(rejection tradestreamer.Rejection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.symbols[rejection.Symbol]; !ok {
+		return
+	}
+	if s.rejections[rejection.Symbol] == nil {
+		s.rejections[rejection.Symbol] = map[string]struct{}{}
+	}
+	s.rejections[rejection.Symbol][rejection.Source] = struct{}{}
+}
+
+// Returns true if every exchange of the session that supports the market of the symbol rejected it
+func (s *streamSession) rejectedEverywhere(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol, ok := s.symbols[key]
+	if !ok || len(s.rejections[key]) == 0 {
+		return false
+	}
+	for _, name := range s.tradeStreamers.MarketNames(symbol.Market) {
+		if _, ok := s.rejections[key][name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the exchange with the given name rejected every subscribed symbol of the markets it supports
+func (s *streamSession) rejectedBy(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rejected := false
+	for key, symbol := range s.symbols {
+		if !slices.Contains(s.tradeStreamers.MarketNames(symbol.Market), name) {
+			continue
+		}
+		if _, ok := s.rejections[key][name]; !ok {
+			return false
+		}
+		rejected = true
+	}
+	return rejected
+}
+
+// Returns the subscribed symbols ordered by key
+func (s *streamSession) list() []exchange.SymbolPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := slices.Sorted(maps.Keys(s.symbols))
+	symbols := make([]exchange.SymbolPair, 0, len(keys))
+	for _, key := range keys {
+		symbols = append(symbols, s.symbols[key])
+	}
+	return symbols
+}
@@ -0,0 +1,128 @@
+package candlestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Store persists emitted candles in an embedded on-disk database
+//
+// Candles are grouped into a bucket per symbol, source and interval, and keyed by their timestamp.
+// Storing a new revision of a candle overwrites the previous one, see Put
+type Store struct {
+	db *bolt.DB
+}
+
+// Opens the store at path, creating it if it does not exist
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open candle store at %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Stores candles of the given interval
+//
+// A stored candle is only replaced by a revision at least as recent, so revisions stored out of order never move it back.
+// A final candle is only replaced by a later final revision, e.g. one corrected by a kline backfill.
+// Concurrent calls are batched into a single transaction
+func (s *Store) Put(intervalMillis int, candles []*candlesv1.StreamCandlesResponse) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		for _, candle := range candles {
+			b, err := tx.CreateBucketIfNotExists(bucketName(candle.Symbol, candle.Source, intervalMillis))
+			if err != nil {
+				return err
+			}
+			key := timestampKey(candle.Timestamp)
+			if stored := b.Get(key); stored != nil {
+				previous := &candlesv1.StreamCandlesResponse{}
+				if err := proto.Unmarshal(stored, previous); err != nil {
+					return fmt.Errorf("failed to unmarshal candle at %d: %w", candle.Timestamp, err)
+				}
+				if !supersedes(candle, previous) {
+					continue
+				}
+			}
+
+			value, err := proto.Marshal(candle)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Returns true if candle may replace the stored candle previous
+func supersedes(candle, previous *candlesv1.StreamCandlesResponse) bool {
+	if previous.Final {
+		return candle.Final && candle.Revision > previous.Revision
+	}
+	return candle.Revision >= previous.Revision
+}
+
+// Returns up to limit candles of the symbol, source and interval with a timestamp within [from, to)
+//
+// An empty source selects the consolidated candles.
+// If there are more candles in the range, the timestamp of the next candle is returned as next.
+// Otherwise next is 0
+func (s *Store) Range(symbol string, source string, intervalMillis int, from, to int64, limit int) (candles []*candlesv1.StreamCandlesResponse, next int64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName(symbol, source, intervalMillis))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(timestampKey(from)); k != nil; k, v = c.Next() {
+			timestamp := int64(binary.BigEndian.Uint64(k))
+			if timestamp >= to {
+				break
+			}
+			if len(candles) == limit {
+				next = timestamp
+				break
+			}
+
+			candle := &candlesv1.StreamCandlesResponse{}
+			if err := proto.Unmarshal(v, candle); err != nil {
+				return fmt.Errorf("failed to unmarshal candle at %d: %w", timestamp, err)
+			}
+			candles = append(candles, candle)
+		}
+		return nil
+	})
+	return candles, next, err
+}
+
+// Buckets are named symbol/interval, and symbol/interval/source for the candles of a single source
+func bucketName(symbol string, source string, intervalMillis int) []byte {
+	if source == "" {
+		return []byte(fmt.Sprintf("%s/%d", symbol, intervalMillis))
+	}
+	return []byte(fmt.Sprintf("%s/%d/%s", symbol, intervalMillis, source))
+}
+
+// Big-endian keys sort in timestamp order
+func timestampKey(timestamp int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(timestamp))
+	return key
+}
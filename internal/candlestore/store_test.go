@@ -0,0 +1,157 @@
+package candlestore
+
+import (
+	candlesv1 "hermeneutic-candles/gen/proto/candles/v1"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_PutAndRange(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	candles := []*candlesv1.StreamCandlesResponse{
+		{Symbol: "btcusdt", Timestamp: 1000, Open: 1, Close: 1},
+		{Symbol: "btcusdt", Timestamp: 2000, Open: 2, Close: 2},
+		{Symbol: "btcusdt", Timestamp: 3000, Open: 3, Close: 3},
+		{Symbol: "btcusdt", Timestamp: 4000, Open: 4, Close: 4},
+		{Symbol: "ethusdt", Timestamp: 2000, Open: 10, Close: 10},
+		{Symbol: "btcusdt", Timestamp: 3000, Open: 3, Close: 3, Source: "Binance"},
+	}
+	if err := store.Put(1000, candles); err != nil {
+		t.Fatalf("Failed to put candles: %v", err)
+	}
+
+	// A new revision overwrites the previous candle
+	amended := &candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 2000, Open: 2, Close: 2.5, Revision: 1, Final: true}
+	if err := store.Put(1000, []*candlesv1.StreamCandlesResponse{amended}); err != nil {
+		t.Fatalf("Failed to put amended candle: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		symbol     string
+		source     string
+		interval   int
+		from       int64
+		to         int64
+		limit      int
+		expected   []int64
+		expectNext int64
+	}{
+		{
+			name:     "full range",
+			symbol:   "btcusdt",
+			interval: 1000,
+			from:     0,
+			to:       10000,
+			limit:    10,
+			expected: []int64{1000, 2000, 3000, 4000},
+		},
+		{
+			name:     "from is inclusive and to is exclusive",
+			symbol:   "btcusdt",
+			interval: 1000,
+			from:     2000,
+			to:       4000,
+			limit:    10,
+			expected: []int64{2000, 3000},
+		},
+		{
+			name:       "paginated",
+			symbol:     "btcusdt",
+			interval:   1000,
+			from:       0,
+			to:         10000,
+			limit:      2,
+			expected:   []int64{1000, 2000},
+			expectNext: 3000,
+		},
+		{
+			name:     "other symbol",
+			symbol:   "ethusdt",
+			interval: 1000,
+			from:     0,
+			to:       10000,
+			limit:    10,
+			expected: []int64{2000},
+		},
+		{
+			name:     "source",
+			symbol:   "btcusdt",
+			source:   "Binance",
+			interval: 1000,
+			from:     0,
+			to:       10000,
+			limit:    10,
+			expected: []int64{3000},
+		},
+		{
+			name:     "other interval",
+			symbol:   "btcusdt",
+			interval: 60000,
+			from:     0,
+			to:       10000,
+			limit:    10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, next, err := store.Range(tt.symbol, tt.source, tt.interval, tt.from, tt.to, tt.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d candles, got %d", len(tt.expected), len(result))
+			}
+			for i, candle := range result {
+				if candle.Timestamp != tt.expected[i] {
+					t.Errorf("Expected timestamp %d, got %d", tt.expected[i], candle.Timestamp)
+				}
+			}
+			if next != tt.expectNext {
+				t.Errorf("Expected next %d, got %d", tt.expectNext, next)
+			}
+		})
+	}
+
+	result, _, _ := store.Range("btcusdt", "", 1000, 2000, 2001, 1)
+	if len(result) != 1 || result[0].Close != 2.5 || result[0].Revision != 1 || !result[0].Final {
+		t.Errorf("Expected amended candle, got %v", result)
+	}
+}
+
+func TestStore_PutKeepsLatestRevision(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	puts := []struct {
+		candle   *candlesv1.StreamCandlesResponse
+		expected float64
+	}{
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 1, Revision: 1}, 1},
+		// An older revision landing late does not move the candle back
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 2, Revision: 0}, 1},
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 3, Revision: 1, Final: true}, 3},
+		// A final candle is only replaced by a later final revision
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 4, Revision: 1}, 3},
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 5, Revision: 2}, 3},
+		{&candlesv1.StreamCandlesResponse{Symbol: "btcusdt", Timestamp: 1000, Close: 6, Revision: 2, Final: true}, 6},
+	}
+	for i, put := range puts {
+		if err := store.Put(1000, []*candlesv1.StreamCandlesResponse{put.candle}); err != nil {
+			t.Fatalf("Failed to put candle %d: %v", i, err)
+		}
+		result, _, err := store.Range("btcusdt", "", 1000, 1000, 2000, 1)
+		if err != nil || len(result) != 1 || result[0].Close != put.expected {
+			t.Errorf("Put %d: expected close %g, got %v %v", i, put.expected, result, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Time source of the candle pipeline
+//
+// The server runs on the wall clock. When a trade tape is replayed, the pipeline runs on a Virtual clock instead,
+// which advances with the tape and waits for the pipeline to process every event before it moves on.
+// The stages of the pipeline hand events on through Queues, and wait on Timers, which hold a Virtual clock
+// for their events themselves.
+// Tests advance the connections and the candle buckets by hand with the fake clock of tests/fake_clock
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+	// Creates a timer that sends the time on its channel once d has passed on the clock
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event of a Clock, see time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	// Changes the timer to expire after d. Returns false if the timer had expired or been stopped
+	Reset(d time.Duration) bool
+	// Prevents the timer from firing. Returns false if the timer had expired or been stopped
+	Stop() bool
+}
+
+// Holder is implemented by clocks that wait for the events handed to the pipeline before advancing, see Virtual
+type Holder interface {
+	// Holds the clock until n more events are released
+	Hold(n int)
+	// Releases a processed event
+	Release()
+}
+
+// Holds c until n more events are released, if c is a Holder
+//
+// Events entering the pipeline are held by their source, e.g. the trades of the replay adapters, and released
+// by their Receiver. Queues and the timers of a Virtual clock hold the clock for their own events
+func Hold(c Clock, n int) {
+	if holder, ok := c.(Holder); ok && n > 0 {
+		holder.Hold(n)
+	}
+}
+
+// Releases an event processed by the pipeline, if c is a Holder
+func Release(c Clock) {
+	if holder, ok := c.(Holder); ok {
+		holder.Release()
+	}
+}
+
+// Returns the wall clock
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,151 @@
+package clock
+
+import (
+	"context"
+	"sync"
+)
+
+// Queue is a buffered channel of the events a stage of the pipeline hands to the next one
+//
+// With a Holder clock, every event queued holds the clock until it is received, so a Virtual clock does not advance
+// while events are queued. Otherwise it is a plain buffered channel
+type Queue[T any] struct {
+	clock Clock
+	in    chan T
+	// Channel the events are received from. The events of a Holder clock are forwarded from in, and are released once received
+	out chan T
+
+	mu sync.Mutex
+	// Whether the events of a Holder clock are forwarded, from the first send on
+	forwarding bool
+	closed     bool
+	// Sends in progress, waited for before the events left are released
+	sending sync.WaitGroup
+	// Closed by Close
+	done chan struct{}
+}
+
+// Creates a Queue of the events of c, which holds up to size events
+func NewQueue[T any](c Clock, size int) *Queue[T] {
+	q := &Queue[T]{clock: c, in: make(chan T, size), done: make(chan struct{})}
+	if _, ok := c.(Holder); !ok {
+		q.out = q.in
+		return q
+	}
+	q.out = make(chan T)
+	return q
+}
+
+// Returns the channel the events are received from
+func (q *Queue[T]) C() <-chan T {
+	return q.out
+}
+
+// Queues v, and returns false if the queue is full or closed
+func (q *Queue[T]) TrySend(v T) bool {
+	return q.send(v, false)
+}
+
+// Queues v, waiting while the queue is full. Returns false if the queue is closed
+func (q *Queue[T]) Send(v T) bool {
+	return q.send(v, true)
+}
+
+func (q *Queue[T]) send(v T, wait bool) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	if q.out != q.in && !q.forwarding {
+		q.forwarding = true
+		go q.forward()
+	}
+	q.sending.Add(1)
+	q.mu.Unlock()
+	defer q.sending.Done()
+
+	// Held before sending, so the clock cannot advance between the receive and the hold
+	Hold(q.clock, 1)
+	if wait {
+		select {
+		case q.in <- v:
+			return true
+		case <-q.done:
+		}
+	} else {
+		select {
+		case q.in <- v:
+			return true
+		default:
+		}
+	}
+	Release(q.clock)
+	return false
+}
+
+// Closes the queue, and releases the events left unreceived. Later sends are dropped
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
+
+// Forwards the events of a Holder clock to the receiver, releasing each event once received
+func (q *Queue[T]) forward() {
+	for {
+		select {
+		case v := <-q.in:
+			select {
+			case q.out <- v:
+			case <-q.done:
+			}
+			Release(q.clock)
+		case <-q.done:
+			q.sending.Wait()
+			for {
+				select {
+				case <-q.in:
+					Release(q.clock)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Receiver receives the events of a channel whose senders hold the clock for every event, e.g. the trades of the replay adapters
+//
+// An event holds the clock until the next one is asked for, so the clock also waits for the events the receiver hands on
+type Receiver[T any] struct {
+	ch <-chan T
+	// Clock held for the last event received, nil once released
+	held Clock
+}
+
+// Creates a Receiver of the events of ch
+func NewReceiver[T any](ch <-chan T) *Receiver[T] {
+	return &Receiver[T]{ch: ch}
+}
+
+// Releases the last event, and returns the next one, whose sender held c for it
+// Returns false once ctx is done
+func (r *Receiver[T]) Next(ctx context.Context, c Clock) (T, bool) {
+	if r.held != nil {
+		Release(r.held)
+		r.held = nil
+	}
+
+	select {
+	case v := <-r.ch:
+		r.held = c
+		return v, true
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
@@ -0,0 +1,58 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueue_HoldsUntilReceived(t *testing.T) {
+	v := NewVirtual(time.UnixMilli(0))
+	q := NewQueue[int](v, 1)
+
+	if !q.TrySend(1) {
+		t.Fatalf("Expected the event to be queued")
+	}
+
+	// The queued event holds the clock until it is received
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.Wait(ctx); err == nil {
+		t.Errorf("Expected Wait to block until the event is received")
+	}
+	if got := <-q.C(); got != 1 {
+		t.Errorf("Expected 1, got %d", got)
+	}
+	if err := v.Wait(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestQueue_Close(t *testing.T) {
+	v := NewVirtual(time.UnixMilli(0))
+	q := NewQueue[int](v, 10)
+	q.TrySend(1)
+	q.TrySend(2)
+
+	// Closing releases the events left unreceived, and drops later sends
+	q.Close()
+	if err := v.Wait(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if q.Send(3) {
+		t.Errorf("Expected a send to a closed queue to be dropped")
+	}
+}
+
+func TestQueue_WallClock(t *testing.T) {
+	q := NewQueue[int](Real(), 1)
+	if !q.TrySend(1) {
+		t.Fatalf("Expected the event to be queued")
+	}
+	if q.TrySend(2) {
+		t.Errorf("Expected a send to a full queue to be dropped")
+	}
+	if got := <-q.C(); got != 1 {
+		t.Errorf("Expected 1, got %d", got)
+	}
+}
@@ -0,0 +1,192 @@
+package clock
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Virtual is a clock that only advances when told to, e.g. by the records of a replayed trade tape
+//
+// It counts the events held by the pipeline, see Holder. A fired timer holds the clock until it is reset or stopped,
+// and Wait blocks until every event is released, so the pipeline processes events in the same order on every run
+type Virtual struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*virtualTimer
+	pending int
+	// Closed while no events are pending
+	idle chan struct{}
+}
+
+// Creates a Virtual clock set to start
+func NewVirtual(start time.Time) *Virtual {
+	idle := make(chan struct{})
+	close(idle)
+	return &Virtual{now: start, idle: idle}
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.now
+}
+
+func (v *Virtual) NewTimer(d time.Duration) Timer {
+	t := &virtualTimer{clock: v, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advances the clock to t, and fires the timers expiring at or before t in the order of their deadlines
+// Does nothing if t is not after the current time
+func (v *Virtual) AdvanceTo(t time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !t.After(v.now) {
+		return
+	}
+	v.now = t
+
+	slices.SortStableFunc(v.timers, func(a, b *virtualTimer) int {
+		return a.deadline.Compare(b.deadline)
+	})
+	i := 0
+	for ; i < len(v.timers) && !v.timers[i].deadline.After(t); i++ {
+		v.fireLocked(v.timers[i])
+	}
+	v.timers = slices.Delete(v.timers, 0, i)
+}
+
+// Returns the earliest deadline of the active timers, false if no timer is active
+func (v *Virtual) Next() (time.Time, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.timers) == 0 {
+		return time.Time{}, false
+	}
+	next := v.timers[0].deadline
+	for _, t := range v.timers[1:] {
+		if t.deadline.Before(next) {
+			next = t.deadline
+		}
+	}
+	return next, true
+}
+
+func (v *Virtual) Hold(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.holdLocked(n)
+}
+
+// Panics if more events are released than held, like sync.WaitGroup
+func (v *Virtual) Release() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.releaseLocked()
+}
+
+// Blocks until every held event is released, or ctx is done
+func (v *Virtual) Wait(ctx context.Context) error {
+	v.mu.Lock()
+	idle := v.idle
+	v.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sends the current time on the timer's channel, holding the clock until the timer is reset or stopped,
+// i.e. until the receiver is done with its time
+// A timer whose previous time was not received yet is not fired again
+// Must be called with the lock held
+func (v *Virtual) fireLocked(t *virtualTimer) {
+	t.active = false
+	select {
+	case t.c <- v.now:
+		if !t.held {
+			t.held = true
+			v.holdLocked(1)
+		}
+	default:
+	}
+}
+
+// Must be called with the lock held
+func (v *Virtual) holdLocked(n int) {
+	if v.pending == 0 && n > 0 {
+		v.idle = make(chan struct{})
+	}
+	v.pending += n
+}
+
+// Must be called with the lock held
+func (v *Virtual) releaseLocked() {
+	if v.pending == 0 {
+		panic("clock: more events released than held")
+	}
+	v.pending--
+	if v.pending == 0 {
+		close(v.idle)
+	}
+}
+
+type virtualTimer struct {
+	clock *Virtual
+	c     chan time.Time
+	// Guarded by the lock of the clock
+	deadline time.Time
+	active   bool
+	// Whether the timer holds the clock since it fired
+	held bool
+}
+
+func (t *virtualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *virtualTimer) Reset(d time.Duration) bool {
+	v := t.clock
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	active := t.stopLocked()
+	t.deadline, t.active = v.now.Add(d), true
+	if d <= 0 {
+		v.fireLocked(t)
+	} else {
+		v.timers = append(v.timers, t)
+	}
+	return active
+}
+
+// Stops the timer, and releases the clock if it fired, so a timer that is done with holds it no longer
+func (t *virtualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.stopLocked()
+}
+
+// Must be called with the lock of the clock held
+func (t *virtualTimer) stopLocked() bool {
+	v := t.clock
+	active := t.active
+	t.active = false
+	v.timers = slices.DeleteFunc(v.timers, func(other *virtualTimer) bool { return other == t })
+
+	select {
+	case <-t.c:
+	default:
+	}
+	if t.held {
+		t.held = false
+		v.releaseLocked()
+	}
+	return active
+}
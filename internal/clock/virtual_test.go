@@ -0,0 +1,72 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVirtual_AdvanceTo(t *testing.T) {
+	start := time.UnixMilli(1753453611000)
+	v := NewVirtual(start)
+	late := v.NewTimer(2 * time.Second)
+	early := v.NewTimer(time.Second)
+
+	if next, ok := v.Next(); !ok || !next.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the earliest deadline %v, got %v", start.Add(time.Second), next)
+	}
+
+	v.AdvanceTo(start.Add(1500 * time.Millisecond))
+	select {
+	case now := <-early.C():
+		if !now.Equal(start.Add(1500 * time.Millisecond)) {
+			t.Errorf("Expected the timer to send the current time, got %v", now)
+		}
+	default:
+		t.Fatalf("Expected the due timer to fire")
+	}
+	select {
+	case <-late.C():
+		t.Fatalf("Expected the timer not to fire before its deadline")
+	default:
+	}
+
+	// The fired timer holds the clock until it is reset or stopped
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.Wait(ctx); err == nil {
+		t.Errorf("Expected Wait to block until the fired timer is stopped")
+	}
+	early.Stop()
+	if err := v.Wait(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Moving back does nothing
+	v.AdvanceTo(start)
+	if now := v.Now(); !now.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("Expected the clock to stay at %v, got %v", start.Add(1500*time.Millisecond), now)
+	}
+}
+
+func TestVirtual_Stop(t *testing.T) {
+	v := NewVirtual(time.UnixMilli(0))
+	timer := v.NewTimer(time.Second)
+	v.AdvanceTo(time.UnixMilli(1000))
+
+	// Stopping a fired timer releases the clock, whether or not its time was received
+	if timer.Stop() {
+		t.Errorf("Expected Stop to report the timer had fired")
+	}
+	if err := v.Wait(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	timer.Reset(time.Second)
+	if !timer.Stop() {
+		t.Errorf("Expected Stop to report the timer was active")
+	}
+	if _, ok := v.Next(); ok {
+		t.Errorf("Expected no active timers after Stop")
+	}
+}
@@ -0,0 +1,202 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/websocket"
+)
+
+// Rejection is a symbol the exchange refused to subscribe to, e.g. an unknown pair
+type Rejection struct {
+	Symbol SymbolPair
+	Reason string
+}
+
+// SubscriptionAcknowledger is implemented by adapters of exchanges that acknowledge subscriptions
+//
+// The streamer waits for the acknowledgements of the symbols subscribed by ConnectAndSubscribe with WaitForAcks,
+// and the acknowledgements of Subscribe are handled by HandleMessage as they arrive
+type SubscriptionAcknowledger interface {
+	// Registers a handler called with the symbols the exchange rejected. Must be called before connecting
+	OnRejected(handler func(rejections []Rejection))
+	// Reads messages from c and passes them to handle, which hands them on to HandleMessage,
+	// until the symbols subscribed by ConnectAndSubscribe are acknowledged or rejected.
+	// Returns an error when they are not acknowledged in time, after which c can no longer be read
+	WaitForAcks(c *websocket.Conn, handle func(message []byte)) error
+}
+
+// Acks tracks the subscriptions of a connection awaiting an acknowledgement from the exchange
+//
+// Topics are the exchange's names of the subscribed symbols, e.g. "publicTrade.BTCUSDT" or "BTC-USDT".
+// Safe for concurrent use
+type Acks struct {
+	mu sync.Mutex
+	// Topic -> symbol awaiting an acknowledgement
+	pending map[string]SymbolPair
+	// Request ID -> topics subscribed by the request
+	requests   map[string][]string
+	onRejected func(rejections []Rejection)
+}
+
+// Registers a handler called with the symbols the exchange rejected
+func (a *Acks) OnRejected(handler func(rejections []Rejection)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onRejected = handler
+}
+
+// Clears the subscriptions awaiting an acknowledgement, e.g. before a new connection is subscribed
+func (a *Acks) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = map[string]SymbolPair{}
+	a.requests = map[string][]string{}
+}
+
+// Expects an acknowledgement of the topics subscribed by the request with the given ID
+// symbols[i] is the symbol of topics[i]
+func (a *Acks) Expect(requestID string, topics []string, symbols []SymbolPair) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		a.pending = map[string]SymbolPair{}
+		a.requests = map[string][]string{}
+	}
+	for i, topic := range topics {
+		a.pending[topic] = symbols[i]
+	}
+	a.requests[requestID] = append(a.requests[requestID], topics...)
+}
+
+// Acknowledges the topic
+func (a *Acks) Ack(topic string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.pending, topic)
+
+	// Forget the requests that have no topics left to acknowledge
+	for requestID, topics := range a.requests {
+		if !slices.ContainsFunc(topics, a.isPendingLocked) {
+			delete(a.requests, requestID)
+		}
+	}
+}
+
+// Acknowledges every topic of the request
+func (a *Acks) AckRequest(requestID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, topic := range a.requests[requestID] {
+		delete(a.pending, topic)
+	}
+	delete(a.requests, requestID)
+}
+
+// Rejects the topics of the request mentioned in reason, and acknowledges its other topics
+//
+// Exchanges name the offending topics in the reason of a failed request, e.g. "Invalid symbol :[publicTrade.FOOUSDT]".
+// Every topic of the request is rejected when reason mentions none of them.
+// When the request is unknown, e.g. the exchange did not return its ID, only the pending topics mentioned in reason are rejected
+func (a *Acks) RejectRequest(requestID string, reason string) {
+	a.mu.Lock()
+	topics, known := a.requests[requestID]
+	delete(a.requests, requestID)
+	if !known {
+		topics = slices.Collect(maps.Keys(a.pending))
+	}
+	topics = slices.DeleteFunc(slices.Clone(topics), func(topic string) bool {
+		return !a.isPendingLocked(topic)
+	})
+
+	mentioned := mentionedTopics(reason)
+	rejected := slices.DeleteFunc(slices.Clone(topics), func(topic string) bool {
+		return !mentioned[topic]
+	})
+	if len(rejected) == 0 && known {
+		rejected = topics
+	}
+
+	var rejections []Rejection
+	for _, topic := range rejected {
+		rejections = append(rejections, Rejection{Symbol: a.pending[topic], Reason: reason})
+	}
+	if known {
+		for _, topic := range topics {
+			delete(a.pending, topic)
+		}
+	} else {
+		for _, topic := range rejected {
+			delete(a.pending, topic)
+		}
+	}
+	handler := a.onRejected
+	a.mu.Unlock()
+
+	// The handler is called without the lock, so it may subscribe again
+	if handler != nil && len(rejections) > 0 {
+		handler(rejections)
+	}
+}
+
+// Returns the words of reason that may name a topic, e.g. "publicTrade.FOOUSDT" in "Invalid symbol :[publicTrade.FOOUSDT]"
+// or "BTC-USD-SWAP" in "instId:BTC-USD-SWAP doesn't exist."
+//
+// Topics are compared to the whole words, so a topic is not mentioned by a longer topic it prefixes, e.g. "BTC-USD" by "BTC-USD-SWAP"
+func mentionedTopics(reason string) map[string]bool {
+	words := strings.FieldsFunc(reason, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".-_", r)
+	})
+	mentioned := map[string]bool{}
+	for _, word := range words {
+		// Punctuation ending a sentence is not part of the topic
+		mentioned[strings.TrimRight(word, ".-_")] = true
+	}
+	return mentioned
+}
+
+// Returns the number of topics awaiting an acknowledgement
+func (a *Acks) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// Must be called with the lock held
+func (a *Acks) isPendingLocked(topic string) bool {
+	_, ok := a.pending[topic]
+	return ok
+}
+
+// Reads messages from c and passes them to handle until no topic awaits an acknowledgement
+//
+// handle is expected to pass the messages on to the adapter, whose HandleMessage acknowledges the topics.
+// Returns an error when topics still await an acknowledgement after timeout. c can no longer be read after the error
+func (a *Acks) Wait(c *websocket.Conn, handle func(message []byte), timeout time.Duration) error {
+	if a.Pending() == 0 {
+		return nil
+	}
+
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	for a.Pending() > 0 {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("timed out after %s waiting for the acknowledgement of %d symbols", timeout, a.Pending())
+			}
+			return fmt.Errorf("failed to read subscription acknowledgements: %w", err)
+		}
+		handle(message)
+	}
+	return nil
+}
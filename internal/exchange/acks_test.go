@@ -0,0 +1,189 @@
+package exchange
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAcks_RejectRequest(t *testing.T) {
+	btc := SymbolPair{First: "btc", Second: "usdt"}
+	foo := SymbolPair{First: "foo", Second: "usdt"}
+
+	tests := []struct {
+		name      string
+		requestID string
+		reason    string
+		expected  []string
+		pending   int
+	}{
+		{
+			name:      "reason names the rejected topic",
+			requestID: "1",
+			reason:    "Invalid symbol :[publicTrade.FOOUSDT]",
+			expected:  []string{"foousdt"},
+			pending:   0,
+		},
+		{
+			name:      "reason names no topic",
+			requestID: "1",
+			reason:    "Too many requests",
+			expected:  []string{"btcusdt", "foousdt"},
+			pending:   0,
+		},
+		{
+			name:      "unknown request",
+			requestID: "",
+			reason:    "Invalid symbol :[publicTrade.FOOUSDT]",
+			expected:  []string{"foousdt"},
+			pending:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acks Acks
+			var rejected []string
+			acks.OnRejected(func(rejections []Rejection) {
+				for _, rejection := range rejections {
+					rejected = append(rejected, rejection.Symbol.Key())
+					if rejection.Reason != tt.reason {
+						t.Errorf("Expected reason %q, got %q", tt.reason, rejection.Reason)
+					}
+				}
+			})
+			acks.Expect("1", []string{"publicTrade.BTCUSDT", "publicTrade.FOOUSDT"}, []SymbolPair{btc, foo})
+
+			acks.RejectRequest(tt.requestID, tt.reason)
+
+			// Rejections of a request are reported in the order of its topics
+			if strings.Join(rejected, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected rejected symbols %v, got %v", tt.expected, rejected)
+			}
+			if pending := acks.Pending(); pending != tt.pending {
+				t.Errorf("Expected %d pending topics, got %d", tt.pending, pending)
+			}
+		})
+	}
+}
+
+func TestAcks_RejectRequestPrefixedTopics(t *testing.T) {
+	short := SymbolPair{First: "eth", Second: "usd"}
+	long := SymbolPair{First: "eth", Second: "usdt"}
+
+	tests := []struct {
+		name     string
+		topics   []string
+		reason   string
+		expected SymbolPair
+	}{
+		{"longer topic", []string{"publicTrade.ETHUSD", "publicTrade.ETHUSDT"}, "Invalid symbol :[publicTrade.ETHUSDT]", long},
+		{"longer instId", []string{"ETH-USD", "ETH-USD-SWAP"}, "Wrong URL or channel:trades,instId:ETH-USD-SWAP doesn't exist.", long},
+		{"shorter instId", []string{"ETH-USD", "ETH-USD-SWAP"}, "Wrong URL or channel:trades,instId:ETH-USD doesn't exist.", short},
+		{"end of sentence", []string{"ETH-USD", "ETH-USD-SWAP"}, "Unknown instId:ETH-USD.", short},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acks Acks
+			var rejected []SymbolPair
+			acks.OnRejected(func(rejections []Rejection) {
+				for _, rejection := range rejections {
+					rejected = append(rejected, rejection.Symbol)
+				}
+			})
+			// The topic of short prefixes the topic of long, and is only rejected when named itself
+			acks.Expect("1", tt.topics, []SymbolPair{short, long})
+
+			acks.RejectRequest("", tt.reason)
+
+			if len(rejected) != 1 || rejected[0] != tt.expected {
+				t.Errorf("Expected rejected symbols [%s], got %v", tt.expected.Key(), rejected)
+			}
+			if pending := acks.Pending(); pending != 1 {
+				t.Errorf("Expected 1 pending topic, got %d", pending)
+			}
+		})
+	}
+}
+
+func TestAcks_Ack(t *testing.T) {
+	var acks Acks
+	acks.Expect("1", []string{"BTC-USDT", "ETH-USDT"}, []SymbolPair{{First: "btc", Second: "usdt"}, {First: "eth", Second: "usdt"}})
+	acks.Expect("2", []string{"SOL-USDT"}, []SymbolPair{{First: "sol", Second: "usdt"}})
+
+	acks.Ack("BTC-USDT")
+	if pending := acks.Pending(); pending != 2 {
+		t.Errorf("Expected 2 pending topics, got %d", pending)
+	}
+
+	acks.AckRequest("2")
+	acks.Ack("ETH-USDT")
+	if pending := acks.Pending(); pending != 0 {
+		t.Errorf("Expected no pending topics, got %d", pending)
+	}
+
+	// Topics acknowledged earlier are not rejected by a later failure of their request
+	rejected := false
+	acks.OnRejected(func([]Rejection) { rejected = true })
+	acks.RejectRequest("1", "Too many requests")
+	if rejected {
+		t.Errorf("Expected no rejections after every topic was acknowledged")
+	}
+}
+
+func TestAcks_Wait(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	ack := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if <-ack {
+			c.WriteMessage(websocket.TextMessage, []byte("ack"))
+		}
+		// Hold the connection open until the client is done
+		c.ReadMessage()
+	}))
+	defer server.Close()
+
+	dial := func() *websocket.Conn {
+		c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		return c
+	}
+
+	var acks Acks
+	handle := func(message []byte) {
+		if string(message) == "ack" {
+			acks.Ack("BTC-USDT")
+		}
+	}
+
+	// The acknowledgement arrives before the timeout
+	c := dial()
+	acks.Expect("1", []string{"BTC-USDT"}, []SymbolPair{{First: "btc", Second: "usdt"}})
+	ack <- true
+	if err := acks.Wait(c, handle, time.Second); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	c.Close()
+
+	// The acknowledgement never arrives
+	c = dial()
+	defer c.Close()
+	acks.Reset()
+	acks.Expect("2", []string{"BTC-USDT"}, []SymbolPair{{First: "btc", Second: "usdt"}})
+	ack <- false
+	if err := acks.Wait(c, handle, 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
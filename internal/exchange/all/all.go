@@ -0,0 +1,13 @@
+// Registers every exchange adapter
+//
+// Import this package for its side effects to make the adapters available in the exchange registry
+package all
+
+import (
+	_ "hermeneutic-candles/internal/exchange/binance"
+	_ "hermeneutic-candles/internal/exchange/bybit"
+	_ "hermeneutic-candles/internal/exchange/coinbase"
+	_ "hermeneutic-candles/internal/exchange/kraken"
+	_ "hermeneutic-candles/internal/exchange/kucoin"
+	_ "hermeneutic-candles/internal/exchange/okx"
+)
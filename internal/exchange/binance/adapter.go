@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"log"
+	"log/slog"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,13 +18,36 @@ import (
 type BinanceAdapter struct {
 	tradeChannel chan<- exchange.Trade
 	pongChannel  chan time.Time
+	clock        clock.Clock
 	connection   *websocket.Conn
+	// Websocket connections support a single concurrent writer
+	writeMu   sync.Mutex
+	requestID int
+	market    exchange.Market
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_BINANCE_REST_URL
+const registryName = "binance"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	WsAddress:     "stream.binance.com:9443",
+	RestURL:       "https://api.binance.com",
+	PerpWsAddress: "fstream.binance.com:443",
+	PerpRestURL:   "https://fapi.binance.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
 }
 
 func NewAdapter(tradeChannel chan<- exchange.Trade) *BinanceAdapter {
 	return &BinanceAdapter{
 		tradeChannel: tradeChannel,
 		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
 	}
 }
 
@@ -33,7 +58,8 @@ type binanceTradeData struct {
 	Time     int64   `json:"T"`
 }
 type binanceTrade struct {
-	Data binanceTradeData `json:"data"`
+	Stream string           `json:"stream"`
+	Data   binanceTradeData `json:"data"`
 }
 
 func (b *BinanceAdapter) Name() string {
@@ -44,13 +70,41 @@ func (b *BinanceAdapter) GetPongChan() <-chan time.Time {
 	return b.pongChannel
 }
 
+func (b *BinanceAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+// Perpetual swaps are streamed from USD-M futures
+func (b *BinanceAdapter) Markets() []exchange.Market {
+	return []exchange.Market{exchange.MarketPerp}
+}
+
+func (b *BinanceAdapter) SetMarket(market exchange.Market) {
+	b.market = market
+}
+
+// Spot connections carry up to 1024 streams and USD-M futures connections up to 200.
+// Streams subscribed on connect are part of the URL, which keeps its length in check.
+// The exchange closes spot connections sent more than 5 messages per second, and futures connections more than 10
+func (b *BinanceAdapter) SubscriptionLimits() exchange.SubscriptionLimits {
+	limits := exchange.SubscriptionLimits{SymbolsPerConnection: 1024, SymbolsPerMessage: 200, MessagesPerSecond: 5}
+	if b.market == exchange.MarketPerp {
+		limits.SymbolsPerConnection = 200
+		limits.MessagesPerSecond = 10
+	}
+	return limits
+}
+
 func (b *BinanceAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
-	cfg := cmd.GetConfig()
-	addr := fmt.Sprintf("%s:%d", cfg.BinanceAddress, cfg.BinancePort)
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	addr := endpoints.WsAddress
+	if b.market == exchange.MarketPerp {
+		addr = endpoints.PerpWsAddress
+	}
 	query := b.symbolsToQuery(symbols)
 	u := url.URL{Scheme: "wss", Host: addr, Path: "/stream", RawQuery: query}
 
-	log.Printf("Connecting to %s at %s", b.Name(), u.String())
+	slog.Info("Connecting", "exchange", b.Name(), "url", u.String())
 
 	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	b.connection = c
@@ -58,23 +112,58 @@ func (b *BinanceAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*we
 	if c != nil {
 		// Set the pong handler
 		c.SetPongHandler(func(string) error {
-			b.pongChannel <- time.Now()
+			b.pongChannel <- b.clock.Now()
 			return nil
 		})
 		c.SetPingHandler(func(s string) error {
 			// Echo the ping back to the server
+			b.writeMu.Lock()
+			defer b.writeMu.Unlock()
 			return c.WriteMessage(websocket.PongMessage, []byte(s))
 		})
 	}
 	return c, err
 }
 
+func (b *BinanceAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("SUBSCRIBE", symbols)
+}
+
+func (b *BinanceAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("UNSUBSCRIBE", symbols)
+}
+
+func (b *BinanceAdapter) sendSubscription(method string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", strings.ToLower(method))
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	b.requestID++
+	subscriptionMessage := map[string]interface{}{
+		"method": method,
+		"params": b.symbolsToStreams(symbols),
+		"id":     b.requestID,
+	}
+	if err := b.connection.WriteJSON(subscriptionMessage); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", strings.ToLower(method), err)
+	}
+	return nil
+}
+
 func (b *BinanceAdapter) HandleMessage(message []byte) error {
 	var bt binanceTrade
 	if err := json.Unmarshal(message, &bt); err != nil {
 		return fmt.Errorf("binance failed to unmarshal message: %w", err)
 	}
 
+	// Responses to subscription requests are not wrapped in a stream
+	if bt.Stream == "" {
+		return nil
+	}
+
 	b.tradeChannel <- b.binanceTradeDataToDomainTrade(
 		bt.Data,
 	)
@@ -83,6 +172,8 @@ func (b *BinanceAdapter) HandleMessage(message []byte) error {
 
 func (b *BinanceAdapter) Ping() error {
 	if b.connection != nil {
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
 		b.connection.WriteMessage(websocket.PingMessage, nil)
 		return nil
 	} else {
@@ -91,18 +182,25 @@ func (b *BinanceAdapter) Ping() error {
 }
 
 func (b *BinanceAdapter) symbolsToQuery(symbols []exchange.SymbolPair) string {
-	query := ""
+	return fmt.Sprintf("streams=%s", strings.Join(b.symbolsToStreams(symbols), "/"))
+}
+
+func (b *BinanceAdapter) symbolsToStreams(symbols []exchange.SymbolPair) []string {
+	// USD-M futures only stream aggregate trades
+	stream := "trade"
+	if b.market == exchange.MarketPerp {
+		stream = "aggTrade"
+	}
+
+	var streams []string
 	for _, symbol := range symbols {
-		if query != "" {
-			query += "/"
-		}
-		query += fmt.Sprintf("%s%s@trade", strings.ToLower(symbol.First), strings.ToLower(symbol.Second))
+		streams = append(streams, fmt.Sprintf("%s%s@%s", strings.ToLower(symbol.First), strings.ToLower(symbol.Second), stream))
 	}
-	return fmt.Sprintf("streams=%s", query)
+	return streams
 }
 
 func (b *BinanceAdapter) responseSymbolToOutputString(s string) string {
-	return strings.ToLower(s)
+	return exchange.MarketKey(strings.ToLower(s), b.market)
 }
 
 func (b *BinanceAdapter) binanceTradeDataToDomainTrade(
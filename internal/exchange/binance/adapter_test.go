@@ -165,6 +165,19 @@ func TestBinanceAdapter_HandleMessage(t *testing.T) {
 	}
 }
 
+func TestBinanceAdapter_HandleMessage_SubscriptionResponse(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 10)
+	adapter := NewAdapter(tradeChannel)
+
+	// Responses to SUBSCRIBE and UNSUBSCRIBE requests are not trades
+	if err := adapter.HandleMessage([]byte(`{"result": null, "id": 1}`)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(tradeChannel) != 0 {
+		t.Errorf("Expected 0 trades in channel, got %d", len(tradeChannel))
+	}
+}
+
 func TestBinanceAdapter_SymbolsToQuery(t *testing.T) {
 	tradeChannel := make(chan exchange.Trade, 1)
 	adapter := NewAdapter(tradeChannel)
@@ -210,6 +223,43 @@ func TestBinanceAdapter_SymbolsToQuery(t *testing.T) {
 	}
 }
 
+func TestBinanceAdapter_Perp(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+	adapter.SetMarket(exchange.MarketPerp)
+
+	// USD-M futures only stream aggregate trades
+	query := adapter.symbolsToQuery([]exchange.SymbolPair{{First: "btc", Second: "usdt", Market: exchange.MarketPerp}})
+	if query != "streams=btcusdt@aggTrade" {
+		t.Errorf("Expected query 'streams=btcusdt@aggTrade', got '%s'", query)
+	}
+
+	err := adapter.HandleMessage([]byte(`{
+		"stream": "btcusdt@aggTrade",
+		"data": {
+			"e": "aggTrade",
+			"E": 1753453611050,
+			"s": "BTCUSDT",
+			"a": 2794417611,
+			"p": "115195.10",
+			"q": "0.250",
+			"f": 6471843001,
+			"l": 6471843003,
+			"T": 1753453611045,
+			"m": false
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Perp trades are kept apart from spot trades
+	trade := <-tradeChannel
+	if trade.Symbol != "btcusdt:perp" || trade.Price != 115195.10 || trade.Quantity != 0.25 {
+		t.Errorf("Unexpected perp trade %+v", trade)
+	}
+}
+
 func TestBinanceAdapter_ResponseSymbolToOutputString(t *testing.T) {
 	tradeChannel := make(chan exchange.Trade, 1)
 	adapter := NewAdapter(tradeChannel)
@@ -299,3 +349,16 @@ func TestBinanceAdapter_BinanceTradeDataToDomainTrade(t *testing.T) {
 		})
 	}
 }
+
+func TestBinanceAdapter_SubscriptionLimits(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	if limits := adapter.SubscriptionLimits(); limits.SymbolsPerConnection != 1024 || limits.MessagesPerSecond != 5 {
+		t.Errorf("Expected 1024 spot streams and 5 messages per second per connection, got %+v", limits)
+	}
+
+	// USD-M futures connections carry fewer streams, and accept more messages
+	adapter.SetMarket(exchange.MarketPerp)
+	if limits := adapter.SubscriptionLimits(); limits.SymbolsPerConnection != 200 || limits.MessagesPerSecond != 10 {
+		t.Errorf("Expected 200 perp streams and 10 messages per second per connection, got %+v", limits)
+	}
+}
@@ -0,0 +1,141 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var klineIntervals = map[time.Duration]string{
+	time.Second:      "1s",
+	time.Minute:      "1m",
+	3 * time.Minute:  "3m",
+	5 * time.Minute:  "5m",
+	15 * time.Minute: "15m",
+	30 * time.Minute: "30m",
+	time.Hour:        "1h",
+	2 * time.Hour:    "2h",
+	4 * time.Hour:    "4h",
+	6 * time.Hour:    "6h",
+	8 * time.Hour:    "8h",
+	12 * time.Hour:   "12h",
+	24 * time.Hour:   "1d",
+}
+
+// Maximum number of klines returned by a single request
+const klineLimit = 1000
+
+// The intervals of the market of the adapter, USD-M futures have no 1s klines
+func (b *BinanceAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		if b.market == exchange.MarketPerp && interval == time.Second {
+			continue
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /api/v3/klines, or GET /fapi/v1/klines of USD-M futures for perpetual swaps
+// Ranges over the request limit are fetched in pages
+func (b *BinanceAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	binanceInterval, ok := klineIntervals[interval]
+	// USD-M futures have no 1s klines
+	if !ok || (symbol.Market == exchange.MarketPerp && interval == time.Second) {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	return exchange.FetchKlinePages(from, to, interval, klineLimit, func(from, to time.Time) ([]exchange.Kline, error) {
+		return b.fetchKlinePage(ctx, symbol, binanceInterval, from, to)
+	})
+}
+
+// Fetches the klines starting within [from, to], which must hold at most klineLimit klines
+func (b *BinanceAdapter) fetchKlinePage(ctx context.Context, symbol exchange.SymbolPair, binanceInterval string, from, to time.Time) ([]exchange.Kline, error) {
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	endpoint := endpoints.RestURL + "/api/v3/klines"
+	if symbol.Market == exchange.MarketPerp {
+		endpoint = endpoints.PerpRestURL + "/fapi/v1/klines"
+	}
+	query := url.Values{}
+	query.Set("symbol", strings.ToUpper(symbol.First+symbol.Second))
+	query.Set("interval", binanceInterval)
+	query.Set("startTime", strconv.FormatInt(from.UnixMilli(), 10))
+	query.Set("endTime", strconv.FormatInt(to.UnixMilli(), 10))
+	query.Set("limit", strconv.Itoa(klineLimit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("binance failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("binance failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	// Each kline is an array of [openTime, open, high, low, close, volume, closeTime, ...]
+	var rows [][]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("binance failed to unmarshal klines: %w", err)
+	}
+
+	klines := make([]exchange.Kline, 0, len(rows))
+	for _, row := range rows {
+		kline, err := b.klineRowToDomainKline(symbol, row)
+		if err != nil {
+			return nil, err
+		}
+		// startTime is inclusive, but guard against klines starting before from
+		if kline.Start.Before(from) {
+			continue
+		}
+		klines = append(klines, kline)
+	}
+	return klines, nil
+}
+
+func (b *BinanceAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []json.RawMessage) (exchange.Kline, error) {
+	if len(row) < 6 {
+		return exchange.Kline{}, fmt.Errorf("binance failed to unmarshal kline: expected at least 6 fields, got %d", len(row))
+	}
+
+	var start int64
+	if err := json.Unmarshal(row[0], &start); err != nil {
+		return exchange.Kline{}, fmt.Errorf("binance failed to unmarshal kline: %w", err)
+	}
+	values := make([]float64, 5)
+	for i := range values {
+		var s string
+		if err := json.Unmarshal(row[i+1], &s); err != nil {
+			return exchange.Kline{}, fmt.Errorf("binance failed to unmarshal kline: %w", err)
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("binance failed to unmarshal kline: %w", err)
+		}
+		values[i] = value
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.UnixMilli(start),
+		Open:   values[0],
+		High:   values[1],
+		Low:    values[2],
+		Close:  values[3],
+		Volume: values[4],
+		Source: b.Name(),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBinanceAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/klines" {
+			t.Errorf("Expected path /api/v3/klines, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("symbol") != "BTCUSDT" {
+			t.Errorf("Expected symbol BTCUSDT, got %s", query.Get("symbol"))
+		}
+		if query.Get("interval") != "1m" {
+			t.Errorf("Expected interval 1m, got %s", query.Get("interval"))
+		}
+		if query.Get("startTime") != "1753445760000" || query.Get("endTime") != "1753445820000" {
+			t.Errorf("Unexpected range %s - %s", query.Get("startTime"), query.Get("endTime"))
+		}
+		w.Write([]byte(`[
+			[1753445760000, "116489.45000000", "116500.00000000", "116400.10000000", "116450.00000000", "12.50000000", 1753445819999, "0", 100, "0", "0", "0"],
+			[1753445820000, "116450.00000000", "116460.00000000", "116420.00000000", "116430.00000000", "3.25000000", 1753445879999, "0", 50, "0", "0", "0"]
+		]`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usdt"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []exchange.Kline{
+		{Symbol: "btcusdt", Start: time.UnixMilli(1753445760000), Open: 116489.45, High: 116500, Low: 116400.1, Close: 116450, Volume: 12.5, Source: "Binance"},
+		{Symbol: "btcusdt", Start: time.UnixMilli(1753445820000), Open: 116450, High: 116460, Low: 116420, Close: 116430, Volume: 3.25, Source: "Binance"},
+	}
+	if len(klines) != len(expected) {
+		t.Fatalf("Expected %d klines, got %d", len(expected), len(klines))
+	}
+	for i, kline := range klines {
+		if !kline.Start.Equal(expected[i].Start) || kline.Symbol != expected[i].Symbol || kline.Source != expected[i].Source ||
+			kline.Open != expected[i].Open || kline.High != expected[i].High || kline.Low != expected[i].Low ||
+			kline.Close != expected[i].Close || kline.Volume != expected[i].Volume {
+			t.Errorf("Expected kline %v, got %v", expected[i], kline)
+		}
+	}
+}
+
+func TestBinanceAdapter_FetchKlines_UnsupportedInterval(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	_, err := adapter.FetchKlines(context.Background(), exchange.SymbolPair{First: "btc", Second: "usdt"}, 7*time.Second, time.Now(), time.Now())
+	if !errors.Is(err, exchange.ErrUnsupportedKlineInterval) {
+		t.Errorf("Expected ErrUnsupportedKlineInterval, got %v", err)
+	}
+}
+
+func TestBinanceAdapter_KlineIntervalFor(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	if interval, ok := exchange.KlineIntervalFor(adapter, 5*time.Second); !ok || interval != time.Second {
+		t.Errorf("Expected 1s klines for spot, got %s", interval)
+	}
+
+	// USD-M futures have no 1s klines, so seconds candles cannot be backfilled
+	adapter.SetMarket(exchange.MarketPerp)
+	if interval, ok := exchange.KlineIntervalFor(adapter, 5*time.Second); ok {
+		t.Errorf("Expected no kline interval for perp, got %s", interval)
+	}
+	if interval, ok := exchange.KlineIntervalFor(adapter, 5*time.Minute); !ok || interval != 5*time.Minute {
+		t.Errorf("Expected 5m klines for perp, got %s", interval)
+	}
+}
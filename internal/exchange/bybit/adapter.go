@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"log"
+	"log/slog"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,17 +20,41 @@ type BybitAdapter struct {
 	connection   *websocket.Conn
 	tradeChannel chan<- exchange.Trade
 	pongChannel  chan time.Time
+	clock        clock.Clock
+	// Websocket connections support a single concurrent writer
+	writeMu   sync.Mutex
+	requestID int
+	market    exchange.Market
+	acks      exchange.Acks
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_BYBIT_REST_URL
+const registryName = "bybit"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	WsAddress: "stream.bybit.com",
+	RestURL:   "https://api.bybit.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
 }
 
 func NewAdapter(tradeChannel chan<- exchange.Trade) *BybitAdapter {
 	return &BybitAdapter{
 		tradeChannel: tradeChannel,
 		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
 	}
 }
 
 type bybitTradeData struct {
-	Symbol   string  `json:"s"`
+	Symbol string `json:"s"`
+	// Mapped so the side is not matched case-insensitively to the symbol
+	Side     string  `json:"S"`
 	Price    float64 `json:"p,string"`
 	Quantity float64 `json:"v,string"`
 	Time     int64   `json:"T"`
@@ -36,6 +63,13 @@ type bybitTrade struct {
 	Data []bybitTradeData `json:"data"`
 }
 
+// Response to a subscribe request, e.g. {"success":false,"ret_msg":"Invalid symbol :[publicTrade.FOOUSDT]","req_id":"1","op":"subscribe"}
+type bybitResponse struct {
+	Success   bool   `json:"success"`
+	RetMsg    string `json:"ret_msg"`
+	RequestID string `json:"req_id"`
+}
+
 func (b *BybitAdapter) Name() string {
 	return "Bybit"
 }
@@ -44,32 +78,92 @@ func (b *BybitAdapter) GetPongChan() <-chan time.Time {
 	return b.pongChannel
 }
 
+func (b *BybitAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+// Perpetual swaps are streamed from the linear category
+func (b *BybitAdapter) Markets() []exchange.Market {
+	return []exchange.Market{exchange.MarketPerp}
+}
+
+func (b *BybitAdapter) SetMarket(market exchange.Market) {
+	b.market = market
+}
+
+// Subscribe requests are acknowledged per request, and a failed request names the topics it rejected
+func (b *BybitAdapter) OnRejected(handler func(rejections []exchange.Rejection)) {
+	b.acks.OnRejected(handler)
+}
+
+// Spot subscribe requests carry up to 10 args, and the args of a connection are capped at 21,000 characters
+func (b *BybitAdapter) SubscriptionLimits() exchange.SubscriptionLimits {
+	return exchange.SubscriptionLimits{SymbolsPerConnection: 500, SymbolsPerMessage: 10}
+}
+
 func (b *BybitAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
 	cfg := cmd.GetConfig()
-	addr := cfg.BybitAddress
-	u := url.URL{Scheme: "wss", Host: addr, Path: "/v5/public/spot"}
+	u := url.URL{Scheme: "wss", Host: cfg.Exchange(registryName, defaultEndpoints).WsAddress, Path: "/v5/public/" + category(b.market)}
 
-	log.Printf("Connecting to %s at %s", b.Name(), u.String())
+	slog.Info("Connecting", "exchange", b.Name(), "url", u.String())
 
 	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	b.connection = c
+	b.acks.Reset()
 
-	// send a subscription message
-	subscribeMessage := map[string]interface{}{
-		"op":   "subscribe",
-		"args": b.symbolsToSubscribeArgs(symbols),
-	}
-	if err := c.WriteJSON(subscribeMessage); err != nil {
+	if err := b.sendSubscription("subscribe", symbols); err != nil {
 		c.Close()
-		return nil, fmt.Errorf("failed to subscribe to symbols: %w", err)
+		return nil, err
 	}
 
 	return c, nil
 }
 
+func (b *BybitAdapter) WaitForAcks(c *websocket.Conn, handle func(message []byte)) error {
+	timeout := time.Duration(cmd.GetConfig().WSSubscribeAckTimeout) * time.Millisecond
+	if err := b.acks.Wait(c, handle, timeout); err != nil {
+		return fmt.Errorf("bybit %w", err)
+	}
+	return nil
+}
+
+func (b *BybitAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("subscribe", symbols)
+}
+
+func (b *BybitAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("unsubscribe", symbols)
+}
+
+func (b *BybitAdapter) sendSubscription(op string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", op)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	b.requestID++
+	requestID := strconv.Itoa(b.requestID)
+	args := b.symbolsToSubscribeArgs(symbols)
+	if op == "subscribe" {
+		b.acks.Expect(requestID, args, symbols)
+	}
+
+	subscriptionMessage := map[string]interface{}{
+		"req_id": requestID,
+		"op":     op,
+		"args":   args,
+	}
+	if err := b.connection.WriteJSON(subscriptionMessage); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", op, err)
+	}
+	return nil
+}
+
 func (b *BybitAdapter) HandleMessage(message []byte) error {
 	var m map[string]interface{}
 	if err := json.Unmarshal(message, &m); err != nil {
@@ -77,7 +171,18 @@ func (b *BybitAdapter) HandleMessage(message []byte) error {
 	}
 
 	if m["op"] == "ping" {
-		b.pongChannel <- time.Now()
+		b.pongChannel <- b.clock.Now()
+		return nil
+	} else if m["op"] == "subscribe" {
+		var br bybitResponse
+		if err := json.Unmarshal(message, &br); err != nil {
+			return fmt.Errorf("bybit failed to unmarshal message: %w", err)
+		}
+		if br.Success {
+			b.acks.AckRequest(br.RequestID)
+		} else {
+			b.acks.RejectRequest(br.RequestID, br.RetMsg)
+		}
 		return nil
 	} else {
 		var bt bybitTrade
@@ -100,6 +205,8 @@ func (b *BybitAdapter) Ping() error {
 		pingMessage := map[string]interface{}{
 			"op": "ping",
 		}
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
 		b.connection.WriteJSON(pingMessage)
 		return nil
 	} else {
@@ -118,8 +225,16 @@ func (b *BybitAdapter) symbolsToSubscribeArgs(symbols []exchange.SymbolPair) []s
 	return args
 }
 
+// Returns the category of the market's endpoints
+func category(market exchange.Market) string {
+	if market == exchange.MarketPerp {
+		return "linear"
+	}
+	return "spot"
+}
+
 func (b *BybitAdapter) responseSymbolToOutputString(s string) string {
-	return strings.ToLower(s)
+	return exchange.MarketKey(strings.ToLower(s), b.market)
 }
 
 func (b *BybitAdapter) bybitTradeDataToDomainTrade(
@@ -225,6 +225,33 @@ func TestBybitAdapter_SymbolsToSubscribeArgs(t *testing.T) {
 	}
 }
 
+func TestBybitAdapter_Perp(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+	adapter.SetMarket(exchange.MarketPerp)
+
+	err := adapter.HandleMessage([]byte(`{
+		"topic": "publicTrade.BTCUSDT",
+		"type": "snapshot",
+		"ts": 1753453611050,
+		"data": [
+			{"T": 1753453611045, "s": "BTCUSDT", "S": "Buy", "v": "0.250", "p": "115195.10", "L": "PlusTick", "i": "a1b2", "BT": false}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Perp trades are kept apart from spot trades
+	trade := <-tradeChannel
+	if trade.Symbol != "btcusdt:perp" || trade.Price != 115195.10 || trade.Quantity != 0.25 {
+		t.Errorf("Unexpected perp trade %+v", trade)
+	}
+	if category(exchange.MarketPerp) != "linear" || category(exchange.MarketSpot) != "spot" {
+		t.Errorf("Expected perp symbols on the linear category")
+	}
+}
+
 func TestBybitAdapter_ResponseSymbolToOutputString(t *testing.T) {
 	tradeChannel := make(chan exchange.Trade, 1)
 	adapter := NewAdapter(tradeChannel)
@@ -314,3 +341,30 @@ func TestBybitAdapter_BybitTradeDataToDomainTrade(t *testing.T) {
 		})
 	}
 }
+
+func TestBybitAdapter_HandleMessage_Acks(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+
+	var rejections []exchange.Rejection
+	adapter.OnRejected(func(r []exchange.Rejection) {
+		rejections = append(rejections, r...)
+	})
+	btc := exchange.SymbolPair{First: "btc", Second: "usdt"}
+	foo := exchange.SymbolPair{First: "foo", Second: "usdt"}
+	adapter.acks.Expect("1", adapter.symbolsToSubscribeArgs([]exchange.SymbolPair{btc}), []exchange.SymbolPair{btc})
+	adapter.acks.Expect("2", adapter.symbolsToSubscribeArgs([]exchange.SymbolPair{foo}), []exchange.SymbolPair{foo})
+
+	if err := adapter.HandleMessage([]byte(`{"success":true,"ret_msg":"subscribe","conn_id":"d2ra4tsh","req_id":"1","op":"subscribe"}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := adapter.HandleMessage([]byte(`{"success":false,"ret_msg":"Invalid symbol :[publicTrade.FOOUSDT]","conn_id":"d2ra4tsh","req_id":"2","op":"subscribe"}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pending := adapter.acks.Pending(); pending != 0 {
+		t.Errorf("Expected no pending acknowledgements, got %d", pending)
+	}
+	if len(rejections) != 1 || rejections[0].Symbol != foo || rejections[0].Reason != "Invalid symbol :[publicTrade.FOOUSDT]" {
+		t.Errorf("Expected foousdt to be rejected, got %+v", rejections)
+	}
+}
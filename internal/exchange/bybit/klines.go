@@ -0,0 +1,143 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var klineIntervals = map[time.Duration]string{
+	time.Minute:      "1",
+	3 * time.Minute:  "3",
+	5 * time.Minute:  "5",
+	15 * time.Minute: "15",
+	30 * time.Minute: "30",
+	time.Hour:        "60",
+	2 * time.Hour:    "120",
+	4 * time.Hour:    "240",
+	6 * time.Hour:    "360",
+	12 * time.Hour:   "720",
+	24 * time.Hour:   "D",
+}
+
+// Maximum number of klines returned by a single request
+const klineLimit = 1000
+
+type bybitKlineResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		// Each kline is an array of [startTime, open, high, low, close, volume, turnover]
+		List [][]string `json:"list"`
+	} `json:"result"`
+}
+
+func (b *BybitAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /v5/market/kline, of the linear category for perpetual swaps
+// Ranges over the request limit are fetched in pages
+func (b *BybitAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	bybitInterval, ok := klineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	return exchange.FetchKlinePages(from, to, interval, klineLimit, func(from, to time.Time) ([]exchange.Kline, error) {
+		return b.fetchKlinePage(ctx, symbol, bybitInterval, from, to)
+	})
+}
+
+// Fetches the klines starting within [from, to], which must hold at most klineLimit klines
+func (b *BybitAdapter) fetchKlinePage(ctx context.Context, symbol exchange.SymbolPair, bybitInterval string, from, to time.Time) ([]exchange.Kline, error) {
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	query := url.Values{}
+	query.Set("category", category(symbol.Market))
+	query.Set("symbol", strings.ToUpper(symbol.First+symbol.Second))
+	query.Set("interval", bybitInterval)
+	query.Set("start", strconv.FormatInt(from.UnixMilli(), 10))
+	query.Set("end", strconv.FormatInt(to.UnixMilli(), 10))
+	query.Set("limit", strconv.Itoa(klineLimit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.RestURL+"/v5/market/kline?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("bybit failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bybit failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	var kr bybitKlineResponse
+	if err := json.NewDecoder(res.Body).Decode(&kr); err != nil {
+		return nil, fmt.Errorf("bybit failed to unmarshal klines: %w", err)
+	}
+	if kr.RetCode != 0 {
+		return nil, fmt.Errorf("bybit failed to fetch klines: %s", kr.RetMsg)
+	}
+
+	klines := make([]exchange.Kline, 0, len(kr.Result.List))
+	for _, row := range kr.Result.List {
+		kline, err := b.klineRowToDomainKline(symbol, row)
+		if err != nil {
+			return nil, err
+		}
+		if kline.Start.Before(from) || kline.Start.After(to) {
+			continue
+		}
+		klines = append(klines, kline)
+	}
+
+	// Bybit returns the newest kline first
+	slices.SortFunc(klines, func(a, b exchange.Kline) int {
+		return a.Start.Compare(b.Start)
+	})
+	return klines, nil
+}
+
+func (b *BybitAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []string) (exchange.Kline, error) {
+	if len(row) < 6 {
+		return exchange.Kline{}, fmt.Errorf("bybit failed to unmarshal kline: expected at least 6 fields, got %d", len(row))
+	}
+
+	start, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return exchange.Kline{}, fmt.Errorf("bybit failed to unmarshal kline: %w", err)
+	}
+	values := make([]float64, 5)
+	for i := range values {
+		value, err := strconv.ParseFloat(row[i+1], 64)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("bybit failed to unmarshal kline: %w", err)
+		}
+		values[i] = value
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.UnixMilli(start),
+		Open:   values[0],
+		High:   values[1],
+		Low:    values[2],
+		Close:  values[3],
+		Volume: values[4],
+		Source: b.Name(),
+	}, nil
+}
@@ -0,0 +1,81 @@
+package bybit
+
+import (
+	"context"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBybitAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v5/market/kline" {
+			t.Errorf("Expected path /v5/market/kline, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("category") != "spot" || query.Get("symbol") != "BTCUSDT" || query.Get("interval") != "1" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		// Newest kline first
+		w.Write([]byte(`{
+			"retCode": 0,
+			"retMsg": "OK",
+			"result": {
+				"category": "spot",
+				"symbol": "BTCUSDT",
+				"list": [
+					["1753445820000", "116450", "116460", "116420", "116430", "3.25", "378400.5"],
+					["1753445760000", "116489.45", "116500", "116400.1", "116450", "12.5", "1456000.1"]
+				]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usdt"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(klines) != 2 {
+		t.Fatalf("Expected 2 klines, got %d", len(klines))
+	}
+	if klines[0].Start.UnixMilli() != 1753445760000 || klines[1].Start.UnixMilli() != 1753445820000 {
+		t.Errorf("Expected klines ordered by start time, got %d and %d", klines[0].Start.UnixMilli(), klines[1].Start.UnixMilli())
+	}
+	if klines[0].Symbol != "btcusdt" || klines[0].Source != "Bybit" {
+		t.Errorf("Expected btcusdt from Bybit, got %s from %s", klines[0].Symbol, klines[0].Source)
+	}
+	if klines[0].Open != 116489.45 || klines[0].High != 116500 || klines[0].Low != 116400.1 || klines[0].Close != 116450 || klines[0].Volume != 12.5 {
+		t.Errorf("Unexpected kline values %v", klines[0])
+	}
+}
+
+func TestBybitAdapter_FetchKlines_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"retCode": 10001, "retMsg": "params error: symbol invalid", "result": {}}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	_, err := adapter.FetchKlines(context.Background(), exchange.SymbolPair{First: "foo", Second: "bar"}, time.Minute, time.Now(), time.Now())
+	if err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,196 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Channels subscribed for every product
+// The heartbeat channel sends a message every second per product, so the connection stays live for illiquid products
+var channels = []string{"matches", "heartbeat"}
+
+type CoinbaseAdapter struct {
+	tradeChannel chan<- exchange.Trade
+	pongChannel  chan time.Time
+	clock        clock.Clock
+	connection   *websocket.Conn
+	// Websocket connections support a single concurrent writer
+	writeMu sync.Mutex
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_COINBASE_REST_URL
+const registryName = "coinbase"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	WsAddress: "ws-feed.exchange.coinbase.com",
+	RestURL:   "https://api.exchange.coinbase.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
+}
+
+func NewAdapter(tradeChannel chan<- exchange.Trade) *CoinbaseAdapter {
+	return &CoinbaseAdapter{
+		tradeChannel: tradeChannel,
+		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
+	}
+}
+
+type coinbaseMessage struct {
+	Type      string    `json:"type"`
+	ProductId string    `json:"product_id"`
+	Price     float64   `json:"price,string"`
+	Size      float64   `json:"size,string"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Reason    string    `json:"reason"`
+}
+
+func (b *CoinbaseAdapter) Name() string {
+	return "Coinbase"
+}
+
+func (b *CoinbaseAdapter) GetPongChan() <-chan time.Time {
+	return b.pongChannel
+}
+
+func (b *CoinbaseAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+func (b *CoinbaseAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
+	cfg := cmd.GetConfig()
+	u := url.URL{Scheme: "wss", Host: cfg.Exchange(registryName, defaultEndpoints).WsAddress}
+
+	slog.Info("Connecting", "exchange", b.Name(), "url", u.String())
+
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.connection = c
+
+	// Coinbase has no application level ping, the websocket ping frames are answered instead
+	c.SetPongHandler(func(string) error {
+		b.pongChannel <- b.clock.Now()
+		return nil
+	})
+
+	// send a subscription message
+	if err := c.WriteJSON(b.subscriptionMessage("subscribe", symbols)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to subscribe to symbols: %w", err)
+	}
+
+	return c, nil
+}
+
+func (b *CoinbaseAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("subscribe", symbols)
+}
+
+func (b *CoinbaseAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("unsubscribe", symbols)
+}
+
+func (b *CoinbaseAdapter) sendSubscription(messageType string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", messageType)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	if err := b.connection.WriteJSON(b.subscriptionMessage(messageType, symbols)); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", messageType, err)
+	}
+	return nil
+}
+
+func (b *CoinbaseAdapter) subscriptionMessage(messageType string, symbols []exchange.SymbolPair) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        messageType,
+		"product_ids": b.symbolsToProductIds(symbols),
+		"channels":    channels,
+	}
+}
+
+func (b *CoinbaseAdapter) HandleMessage(message []byte) error {
+	var m coinbaseMessage
+	if err := json.Unmarshal(message, &m); err != nil {
+		return fmt.Errorf("coinbase failed to unmarshal message: %w", err)
+	}
+
+	switch m.Type {
+	case "match":
+		b.tradeChannel <- b.coinbaseMatchToDomainTrade(m)
+		return nil
+	case "error":
+		return fmt.Errorf("coinbase returned an error: %s: %s", m.Message, m.Reason)
+	default:
+		// Heartbeats only keep the connection live. The last_match sent on subscription
+		// happened before subscribing, and is dropped as it may belong to a closed candle
+		return nil
+	}
+}
+
+func (b *CoinbaseAdapter) Ping() error {
+	if b.connection != nil {
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
+		b.connection.WriteMessage(websocket.PingMessage, nil)
+		return nil
+	} else {
+		return fmt.Errorf("tried to ping without a valid connection")
+	}
+}
+
+// Returns the product IDs of the symbols
+//
+// Ex: {First: "btc", Second: "usd"} -> "BTC-USD"
+func (b *CoinbaseAdapter) symbolsToProductIds(symbols []exchange.SymbolPair) []string {
+	var productIds []string
+	for _, symbol := range symbols {
+		productIds = append(productIds, b.symbolToProductId(symbol))
+	}
+	return productIds
+}
+
+func (b *CoinbaseAdapter) symbolToProductId(symbol exchange.SymbolPair) string {
+	return fmt.Sprintf("%s-%s", strings.ToUpper(symbol.First), strings.ToUpper(symbol.Second))
+}
+
+func (b *CoinbaseAdapter) responseSymbolToOutputString(s string) string {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.ToLower(fmt.Sprintf("%s%s", parts[0], parts[1]))
+}
+
+func (b *CoinbaseAdapter) coinbaseMatchToDomainTrade(
+	m coinbaseMessage,
+) exchange.Trade {
+	return exchange.Trade{
+		Symbol:    b.responseSymbolToOutputString(m.ProductId),
+		Price:     m.Price,
+		Quantity:  m.Size,
+		Timestamp: m.Time,
+		Source:    b.Name(),
+	}
+}
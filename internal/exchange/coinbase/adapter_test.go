@@ -0,0 +1,258 @@
+package coinbase
+
+import (
+	"hermeneutic-candles/internal/exchange"
+	"testing"
+	"time"
+)
+
+func TestCoinbaseAdapter_HandleMessage(t *testing.T) {
+	// Create a buffered channel to capture trades
+	tradeChannel := make(chan exchange.Trade, 10)
+
+	// Create the adapter
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		name        string
+		payload     string
+		expected    []exchange.Trade
+		shouldError bool
+	}{
+		{
+			name: "valid BTC match",
+			payload: `{
+				"type": "match",
+				"trade_id": 857230131,
+				"maker_order_id": "ac928c66-ca53-498f-9c13-a110027a60e8",
+				"taker_order_id": "132fb6ae-456b-4654-b4e0-d681ac05cea1",
+				"side": "sell",
+				"size": "0.00193696",
+				"price": "115168.01",
+				"product_id": "BTC-USD",
+				"sequence": 110473128581,
+				"time": "2025-07-25T14:44:10.864Z"
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "btcusd",
+					Price:     115168.01,
+					Quantity:  0.00193696,
+					Timestamp: time.UnixMilli(1753454650864),
+					Source:    "Coinbase",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "valid ETH match",
+			payload: `{
+				"type": "match",
+				"trade_id": 621830475,
+				"side": "buy",
+				"size": "1.5",
+				"price": "3245.67",
+				"product_id": "ETH-USD",
+				"sequence": 65348201733,
+				"time": "2025-07-25T14:44:10.870Z"
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "ethusd",
+					Price:     3245.67,
+					Quantity:  1.5,
+					Timestamp: time.UnixMilli(1753454650870),
+					Source:    "Coinbase",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "heartbeat message",
+			payload: `{
+				"type": "heartbeat",
+				"sequence": 110473128582,
+				"last_trade_id": 857230131,
+				"product_id": "BTC-USD",
+				"time": "2025-07-25T14:44:11.000Z"
+			}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "last match before subscribing",
+			payload: `{
+				"type": "last_match",
+				"trade_id": 857230100,
+				"side": "buy",
+				"size": "0.01",
+				"price": "115160",
+				"product_id": "BTC-USD",
+				"sequence": 110473128000,
+				"time": "2025-07-25T14:43:58.120Z"
+			}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "subscriptions message",
+			payload: `{
+				"type": "subscriptions",
+				"channels": [
+					{"name": "matches", "product_ids": ["BTC-USD"]},
+					{"name": "heartbeat", "product_ids": ["BTC-USD"]}
+				]
+			}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "error message",
+			payload: `{
+				"type": "error",
+				"message": "Failed to subscribe",
+				"reason": "BTC-XYZ is not a valid product"
+			}`,
+			shouldError: true,
+		},
+		{
+			name: "invalid JSON with wrong price format",
+			payload: `{
+				"type": "match",
+				"size": "0.00193696",
+				"price": "invalid_price",
+				"product_id": "BTC-USD",
+				"time": "2025-07-25T14:44:10.864Z"
+			}`,
+			shouldError: true,
+		},
+		{
+			name: "malformed JSON",
+			payload: `{
+				"type": "match"
+				"product_id": "BTC-USD"
+			`,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clear the channel before each test
+			for len(tradeChannel) > 0 {
+				<-tradeChannel
+			}
+
+			// Handle the message
+			err := adapter.HandleMessage([]byte(tt.payload))
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			// Check number of trades sent to channel
+			expectedCount := len(tt.expected)
+			if len(tradeChannel) != expectedCount {
+				t.Errorf("Expected %d trades in channel, got %d", expectedCount, len(tradeChannel))
+				return
+			}
+
+			// Verify each trade
+			for i, expectedTrade := range tt.expected {
+				receivedTrade := <-tradeChannel
+
+				if receivedTrade.Symbol != expectedTrade.Symbol {
+					t.Errorf("Trade %d: Expected symbol %s, got %s", i, expectedTrade.Symbol, receivedTrade.Symbol)
+				}
+				if receivedTrade.Price != expectedTrade.Price {
+					t.Errorf("Trade %d: Expected price %f, got %f", i, expectedTrade.Price, receivedTrade.Price)
+				}
+				if receivedTrade.Quantity != expectedTrade.Quantity {
+					t.Errorf("Trade %d: Expected quantity %f, got %f", i, expectedTrade.Quantity, receivedTrade.Quantity)
+				}
+				if receivedTrade.Timestamp.UnixMilli() != expectedTrade.Timestamp.UnixMilli() {
+					t.Errorf("Trade %d: Expected timestamp %d, got %d", i, expectedTrade.Timestamp.UnixMilli(), receivedTrade.Timestamp.UnixMilli())
+				}
+				if receivedTrade.Source != expectedTrade.Source {
+					t.Errorf("Trade %d: Expected source %s, got %s", i, expectedTrade.Source, receivedTrade.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestCoinbaseAdapter_SymbolsToProductIds(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		name     string
+		symbols  []exchange.SymbolPair
+		expected []string
+	}{
+		{
+			name: "single symbol",
+			symbols: []exchange.SymbolPair{
+				{First: "BTC", Second: "USD"},
+			},
+			expected: []string{"BTC-USD"},
+		},
+		{
+			name: "mixed case symbols",
+			symbols: []exchange.SymbolPair{
+				{First: "btc", Second: "usd"},
+				{First: "ETH", Second: "usd"},
+				{First: "sol", Second: "USDT"},
+			},
+			expected: []string{"BTC-USD", "ETH-USD", "SOL-USDT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := adapter.symbolsToProductIds(tt.symbols)
+			if len(result) != len(tt.expected) {
+				t.Errorf("Expected %d product IDs, got %d", len(tt.expected), len(result))
+				return
+			}
+			for i, expected := range tt.expected {
+				if result[i] != expected {
+					t.Errorf("Expected product ID[%d] '%s', got '%s'", i, expected, result[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCoinbaseAdapter_ResponseSymbolToOutputString(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"BTC-USD", "btcusd"},
+		{"ETH-USD", "ethusd"},
+		{"BTC-USDT", "btcusdt"},
+		{"btc-usd", "btcusd"}, // Should handle lowercase
+		{"INVALID", ""},       // Should handle missing separator
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := adapter.responseSymbolToOutputString(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			}
+		})
+	}
+}
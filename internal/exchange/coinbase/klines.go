@@ -0,0 +1,112 @@
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Granularities in seconds supported by the candles endpoint
+var klineIntervals = map[time.Duration]int{
+	time.Minute:      60,
+	5 * time.Minute:  300,
+	15 * time.Minute: 900,
+	time.Hour:        3600,
+	6 * time.Hour:    21600,
+	24 * time.Hour:   86400,
+}
+
+// Maximum number of klines returned by a single request
+const klineLimit = 300
+
+func (b *CoinbaseAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /products/{product_id}/candles
+// Ranges over the request limit are fetched in pages
+func (b *CoinbaseAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	granularity, ok := klineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	return exchange.FetchKlinePages(from, to, interval, klineLimit, func(from, to time.Time) ([]exchange.Kline, error) {
+		return b.fetchKlinePage(ctx, symbol, granularity, from, to)
+	})
+}
+
+// Fetches the klines starting within [from, to], which must hold at most klineLimit klines
+func (b *CoinbaseAdapter) fetchKlinePage(ctx context.Context, symbol exchange.SymbolPair, granularity int, from, to time.Time) ([]exchange.Kline, error) {
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	query := url.Values{}
+	query.Set("granularity", strconv.Itoa(granularity))
+	query.Set("start", from.UTC().Format(time.RFC3339))
+	query.Set("end", to.UTC().Format(time.RFC3339))
+
+	endpoint := fmt.Sprintf("%s/products/%s/candles?%s", endpoints.RestURL, b.symbolToProductId(symbol), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("coinbase failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coinbase failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	// Each kline is an array of [time, low, high, open, close, volume], with time in seconds
+	var rows [][]float64
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("coinbase failed to unmarshal klines: %w", err)
+	}
+
+	klines := make([]exchange.Kline, 0, len(rows))
+	for _, row := range rows {
+		kline, err := b.klineRowToDomainKline(symbol, row)
+		if err != nil {
+			return nil, err
+		}
+		if kline.Start.Before(from) || kline.Start.After(to) {
+			continue
+		}
+		klines = append(klines, kline)
+	}
+
+	// Coinbase returns the newest kline first
+	slices.SortFunc(klines, func(a, b exchange.Kline) int {
+		return a.Start.Compare(b.Start)
+	})
+	return klines, nil
+}
+
+func (b *CoinbaseAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []float64) (exchange.Kline, error) {
+	if len(row) < 6 {
+		return exchange.Kline{}, fmt.Errorf("coinbase failed to unmarshal kline: expected at least 6 fields, got %d", len(row))
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.Unix(int64(row[0]), 0),
+		Open:   row[3],
+		High:   row[2],
+		Low:    row[1],
+		Close:  row[4],
+		Volume: row[5],
+		Source: b.Name(),
+	}, nil
+}
@@ -0,0 +1,60 @@
+package coinbase
+
+import (
+	"context"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCoinbaseAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products/BTC-USD/candles" {
+			t.Errorf("Expected path /products/BTC-USD/candles, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("granularity") != "60" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if query.Get("start") != "2025-07-25T12:16:00Z" || query.Get("end") != "2025-07-25T12:17:00Z" {
+			t.Errorf("Unexpected range start %s end %s", query.Get("start"), query.Get("end"))
+		}
+		// Newest kline first
+		w.Write([]byte(`[
+			[1753445820, 116420, 116460, 116450, 116430, 3.25],
+			[1753445760, 116400.1, 116500, 116489.45, 116450, 12.5]
+		]`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usd"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(klines) != 2 {
+		t.Fatalf("Expected 2 klines, got %d", len(klines))
+	}
+	if klines[0].Start.UnixMilli() != 1753445760000 || klines[1].Start.UnixMilli() != 1753445820000 {
+		t.Errorf("Expected klines ordered by start time, got %d and %d", klines[0].Start.UnixMilli(), klines[1].Start.UnixMilli())
+	}
+	if klines[0].Symbol != "btcusd" || klines[0].Source != "Coinbase" {
+		t.Errorf("Expected btcusd from Coinbase, got %s from %s", klines[0].Symbol, klines[0].Source)
+	}
+	if klines[0].Open != 116489.45 || klines[0].High != 116500 || klines[0].Low != 116400.1 || klines[0].Close != 116450 || klines[0].Volume != 12.5 {
+		t.Errorf("Unexpected kline values %v", klines[0])
+	}
+}
@@ -1,6 +1,9 @@
 package exchange
 
 import (
+	"fmt"
+	"hermeneutic-candles/internal/clock"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,15 +17,126 @@ type Trade struct {
 	Source    string
 }
 
+// Market is the kind of instrument a symbol is traded as
+type Market string
+
+const (
+	// Spot market, the zero value of Market
+	MarketSpot Market = ""
+	// Perpetual swaps settled in the quote asset, e.g. Binance USD-M futures, Bybit linear and OKX SWAP
+	MarketPerp Market = "perp"
+)
+
+// Parses the market suffix of a requested symbol, e.g. "perp" in "btc-usdt:perp"
+//
+// An empty string or "spot" is the spot market
+func ParseMarket(s string) (Market, error) {
+	switch strings.ToLower(s) {
+	case "", "spot":
+		return MarketSpot, nil
+	case string(MarketPerp):
+		return MarketPerp, nil
+	default:
+		return "", fmt.Errorf("unknown market %q, must be spot or %s", s, MarketPerp)
+	}
+}
+
+// Returns the name of the market
+func (m Market) String() string {
+	if m == MarketSpot {
+		return "spot"
+	}
+	return string(m)
+}
+
 type SymbolPair struct {
 	First  string
 	Second string
+	Market Market
+}
+
+// Returns the symbol in the format used by Trade.Symbol
+//
+// Symbols of markets other than spot are suffixed with the market, so their candles are kept apart from spot candles
+// Ex: {First: "BTC", Second: "usdt"} -> "btcusdt", {First: "btc", Second: "usdt", Market: MarketPerp} -> "btcusdt:perp"
+func (p SymbolPair) Key() string {
+	return MarketKey(strings.ToLower(p.First+p.Second), p.Market)
+}
+
+// Returns the key of a symbol of the market, given the key of the symbol on the spot market
+//
+// Ex: ("btcusdt", MarketPerp) -> "btcusdt:perp"
+func MarketKey(spotKey string, market Market) string {
+	if market == MarketSpot {
+		return spotKey
+	}
+	return spotKey + ":" + string(market)
+}
+
+// Returns the keys of the symbols, e.g. to log the symbol set
+func SymbolKeys(symbols []SymbolPair) []string {
+	keys := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		keys = append(keys, symbol.Key())
+	}
+	return keys
 }
 
 type ExchangeAdapter interface {
 	Name() string
 	GetPongChan() <-chan time.Time
 	ConnectAndSubscribe(symbols []SymbolPair) (*websocket.Conn, error)
+	// Subscribes to additional symbols over the current connection
+	Subscribe(symbols []SymbolPair) error
+	// Unsubscribes from symbols over the current connection
+	Unsubscribe(symbols []SymbolPair) error
 	HandleMessage(message []byte) error
 	Ping() error
 }
+
+// MarketAdapter is implemented by adapters that stream markets other than spot
+//
+// Each market is streamed over its own connection, by an adapter dedicated to the market
+type MarketAdapter interface {
+	// Returns the markets other than spot the exchange supports
+	Markets() []Market
+	// Sets the market the adapter streams. Must be called before connecting, the default is spot
+	SetMarket(market Market)
+}
+
+// PingIntervalProvider is implemented by adapters of exchanges that dictate how often the client pings
+//
+// The exchange expects a ping every interval, even while messages are flowing
+type PingIntervalProvider interface {
+	// Returns the interval between pings and the time to wait for a pong, as provided by the exchange on the last connect
+	// Zero when the exchange did not provide them
+	PingInterval() (interval time.Duration, timeout time.Duration)
+}
+
+// SubscriptionLimits are the limits an exchange puts on the symbols and messages of a connection. Zero is unlimited
+type SubscriptionLimits struct {
+	// Maximum number of symbols subscribed over a single connection
+	SymbolsPerConnection int
+	// Maximum number of symbols in a single subscribe or unsubscribe message, including the symbols subscribed on connect
+	SymbolsPerMessage int
+	// Maximum number of subscribe and unsubscribe messages sent over a connection per second, including the connect
+	MessagesPerSecond int
+}
+
+// SubscriptionLimiter is implemented by adapters of exchanges that limit the symbols of a connection or a subscribe message,
+// or the rate of the messages of a connection
+//
+// Symbol sets over the limits are split across several subscribe messages and connections, each by its own adapter,
+// and the messages of a connection are spaced to stay within its message rate
+type SubscriptionLimiter interface {
+	// Returns the limits of the market the adapter streams
+	SubscriptionLimits() SubscriptionLimits
+}
+
+// ClockSetter is implemented by adapters that read the time, e.g. to timestamp pongs
+//
+// Network deadlines of the connection are always set on the wall clock
+type ClockSetter interface {
+	// Sets the clock the adapter reads the time from. Must be called before connecting, the default is the wall clock
+	SetClock(c clock.Clock)
+}
@@ -0,0 +1,55 @@
+package exchange
+
+import "testing"
+
+func TestParseMarket(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    Market
+		shouldError bool
+	}{
+		{input: "", expected: MarketSpot},
+		{input: "spot", expected: MarketSpot},
+		{input: "perp", expected: MarketPerp},
+		{input: "PERP", expected: MarketPerp},
+		{input: "futures", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			market, err := ParseMarket(tt.input)
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if market != tt.expected {
+				t.Errorf("Expected market %q, got %q", tt.expected, market)
+			}
+		})
+	}
+}
+
+func TestSymbolPair_Key(t *testing.T) {
+	tests := []struct {
+		symbol   SymbolPair
+		expected string
+	}{
+		{symbol: SymbolPair{First: "BTC", Second: "usdt"}, expected: "btcusdt"},
+		{symbol: SymbolPair{First: "btc", Second: "usdt", Market: MarketPerp}, expected: "btcusdt:perp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if key := tt.symbol.Key(); key != tt.expected {
+				t.Errorf("Expected key %s, got %s", tt.expected, key)
+			}
+		})
+	}
+}
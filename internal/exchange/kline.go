@@ -0,0 +1,67 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var ErrUnsupportedKlineInterval = errors.New("unsupported kline interval")
+
+// Client of the kline requests of the adapters. The timeout keeps a hanging endpoint from stalling the backfill of a reconnect
+var KlineClient = &http.Client{Timeout: 10 * time.Second}
+
+type Kline struct {
+	Symbol string
+	Start  time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+	Source string
+}
+
+// KlineFetcher is implemented by adapters that can fetch historical klines from the exchange's REST API
+// It is used to rebuild candles for the period an exchange was disconnected
+type KlineFetcher interface {
+	// Returns the kline intervals supported by the exchange for the market of the adapter
+	KlineIntervals() []time.Duration
+	// Returns the klines of the symbol starting within [from, to], ordered by start time
+	FetchKlines(ctx context.Context, symbol SymbolPair, interval time.Duration, from, to time.Time) ([]Kline, error)
+}
+
+// Returns the largest kline interval supported by the fetcher that evenly divides interval
+func KlineIntervalFor(fetcher KlineFetcher, interval time.Duration) (time.Duration, bool) {
+	intervals := fetcher.KlineIntervals()
+	slices.Sort(intervals)
+	for i := len(intervals) - 1; i >= 0; i-- {
+		if interval%intervals[i] == 0 {
+			return intervals[i], true
+		}
+	}
+	return 0, false
+}
+
+// Fetches the klines of the interval starting within [from, to] in pages of at most limit klines
+//
+// fetchPage returns the klines starting within [from, to] of a single page, ordered by start time.
+// The klines of every page are returned in order
+func FetchKlinePages(from, to time.Time, interval time.Duration, limit int, fetchPage func(from, to time.Time) ([]Kline, error)) ([]Kline, error) {
+	span := interval * time.Duration(max(limit-1, 0))
+	var klines []Kline
+	for pageFrom := from; !pageFrom.After(to); pageFrom = pageFrom.Add(span + interval) {
+		pageTo := pageFrom.Add(span)
+		if pageTo.After(to) {
+			pageTo = to
+		}
+		page, err := fetchPage(pageFrom, pageTo)
+		if err != nil {
+			return nil, err
+		}
+		klines = append(klines, page...)
+	}
+	return klines, nil
+}
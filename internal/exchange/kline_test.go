@@ -0,0 +1,48 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchKlinePages(t *testing.T) {
+	from := time.UnixMilli(1753445760000)
+	to := from.Add(6 * time.Minute)
+
+	type page struct{ from, to time.Time }
+	var pages []page
+	klines, err := FetchKlinePages(from, to, time.Minute, 3, func(from, to time.Time) ([]Kline, error) {
+		pages = append(pages, page{from, to})
+		var klines []Kline
+		for start := from; !start.After(to); start = start.Add(time.Minute) {
+			klines = append(klines, Kline{Start: start})
+		}
+		return klines, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 7 klines in pages of at most 3
+	expected := []page{
+		{from, from.Add(2 * time.Minute)},
+		{from.Add(3 * time.Minute), from.Add(5 * time.Minute)},
+		{from.Add(6 * time.Minute), to},
+	}
+	if len(pages) != len(expected) {
+		t.Fatalf("Expected %d pages, got %v", len(expected), pages)
+	}
+	for i, p := range pages {
+		if !p.from.Equal(expected[i].from) || !p.to.Equal(expected[i].to) {
+			t.Errorf("Page %d: expected %v - %v, got %v - %v", i, expected[i].from, expected[i].to, p.from, p.to)
+		}
+	}
+	if len(klines) != 7 {
+		t.Fatalf("Expected 7 klines, got %d", len(klines))
+	}
+	for i, kline := range klines {
+		if !kline.Start.Equal(from.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("Expected kline %d at %v, got %v", i, from.Add(time.Duration(i)*time.Minute), kline.Start)
+		}
+	}
+}
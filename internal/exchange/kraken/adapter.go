@@ -0,0 +1,203 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type KrakenAdapter struct {
+	tradeChannel chan<- exchange.Trade
+	pongChannel  chan time.Time
+	clock        clock.Clock
+	connection   *websocket.Conn
+	// Websocket connections support a single concurrent writer
+	writeMu   sync.Mutex
+	requestID int
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_KRAKEN_REST_URL
+const registryName = "kraken"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	WsAddress: "ws.kraken.com",
+	RestURL:   "https://api.kraken.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
+}
+
+func NewAdapter(tradeChannel chan<- exchange.Trade) *KrakenAdapter {
+	return &KrakenAdapter{
+		tradeChannel: tradeChannel,
+		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
+	}
+}
+
+type krakenTradeData struct {
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	Quantity  float64   `json:"qty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Messages of the websocket v2 API are either channel messages or responses to methods
+type krakenMessage struct {
+	Channel string            `json:"channel"`
+	Data    []krakenTradeData `json:"data"`
+	Method  string            `json:"method"`
+	Success *bool             `json:"success"`
+	Error   string            `json:"error"`
+}
+
+func (b *KrakenAdapter) Name() string {
+	return "Kraken"
+}
+
+func (b *KrakenAdapter) GetPongChan() <-chan time.Time {
+	return b.pongChannel
+}
+
+func (b *KrakenAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+func (b *KrakenAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
+	cfg := cmd.GetConfig()
+	u := url.URL{Scheme: "wss", Host: cfg.Exchange(registryName, defaultEndpoints).WsAddress, Path: "/v2"}
+
+	slog.Info("Connecting", "exchange", b.Name(), "url", u.String())
+
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.connection = c
+
+	// send a subscription message
+	if err := c.WriteJSON(b.nextMethodMessage("subscribe", symbols)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to subscribe to symbols: %w", err)
+	}
+
+	return c, nil
+}
+
+func (b *KrakenAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("subscribe", symbols)
+}
+
+func (b *KrakenAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("unsubscribe", symbols)
+}
+
+func (b *KrakenAdapter) sendSubscription(method string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", method)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	if err := b.connection.WriteJSON(b.nextMethodMessage(method, symbols)); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", method, err)
+	}
+	return nil
+}
+
+func (b *KrakenAdapter) nextMethodMessage(method string, symbols []exchange.SymbolPair) map[string]interface{} {
+	b.requestID++
+	return map[string]interface{}{
+		"method": method,
+		"params": map[string]interface{}{
+			"channel": "trade",
+			"symbol":  b.symbolsToWebsocketSymbols(symbols),
+			// The snapshot holds trades from before subscribing, which may belong to closed candles
+			"snapshot": false,
+		},
+		"req_id": b.requestID,
+	}
+}
+
+func (b *KrakenAdapter) HandleMessage(message []byte) error {
+	var m krakenMessage
+	if err := json.Unmarshal(message, &m); err != nil {
+		return fmt.Errorf("kraken failed to unmarshal message: %w", err)
+	}
+
+	if m.Method == "pong" {
+		b.pongChannel <- b.clock.Now()
+		return nil
+	}
+	if m.Success != nil && !*m.Success {
+		return fmt.Errorf("kraken failed to %s: %s", m.Method, m.Error)
+	}
+	// Heartbeats, status updates and method responses carry no trades
+	if m.Channel != "trade" {
+		return nil
+	}
+
+	for _, data := range m.Data {
+		b.tradeChannel <- b.krakenTradeDataToDomainTrade(
+			data,
+		)
+	}
+	return nil
+}
+
+func (b *KrakenAdapter) Ping() error {
+	if b.connection != nil {
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
+		b.requestID++
+		b.connection.WriteJSON(map[string]interface{}{
+			"method": "ping",
+			"req_id": b.requestID,
+		})
+		return nil
+	} else {
+		return fmt.Errorf("tried to ping without a valid connection")
+	}
+}
+
+func (b *KrakenAdapter) symbolsToWebsocketSymbols(symbols []exchange.SymbolPair) []string {
+	var krakenSymbols []string
+	for _, symbol := range symbols {
+		krakenSymbols = append(krakenSymbols, symbolToWebsocketSymbol(symbol))
+	}
+	return krakenSymbols
+}
+
+func (b *KrakenAdapter) responseSymbolToOutputString(s string) string {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return ""
+	}
+	return fromKrakenAsset(parts[0]) + fromKrakenAsset(parts[1])
+}
+
+func (b *KrakenAdapter) krakenTradeDataToDomainTrade(
+	data krakenTradeData,
+) exchange.Trade {
+	return exchange.Trade{
+		Symbol:    b.responseSymbolToOutputString(data.Symbol),
+		Price:     data.Price,
+		Quantity:  data.Quantity,
+		Timestamp: data.Timestamp,
+		Source:    b.Name(),
+	}
+}
@@ -0,0 +1,254 @@
+package kraken
+
+import (
+	"hermeneutic-candles/internal/exchange"
+	"testing"
+	"time"
+)
+
+func TestKrakenAdapter_HandleMessage(t *testing.T) {
+	// Create a buffered channel to capture trades
+	tradeChannel := make(chan exchange.Trade, 10)
+
+	// Create the adapter
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		name        string
+		payload     string
+		expected    []exchange.Trade
+		shouldError bool
+	}{
+		{
+			name: "valid BTC trade",
+			payload: `{
+				"channel": "trade",
+				"type": "update",
+				"data": [
+					{
+						"symbol": "BTC/USDT",
+						"side": "sell",
+						"price": 115168,
+						"qty": 0.00193696,
+						"ord_type": "market",
+						"trade_id": 4665846,
+						"timestamp": "2025-07-25T14:44:10.864Z"
+					}
+				]
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "btcusdt",
+					Price:     115168,
+					Quantity:  0.00193696,
+					Timestamp: time.UnixMilli(1753454650864),
+					Source:    "Kraken",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "multiple trades with XBT symbol",
+			payload: `{
+				"channel": "trade",
+				"type": "update",
+				"data": [
+					{
+						"symbol": "XBT/USD",
+						"side": "buy",
+						"price": 115170.5,
+						"qty": 0.5,
+						"ord_type": "limit",
+						"trade_id": 4665847,
+						"timestamp": "2025-07-25T14:44:10.870Z"
+					},
+					{
+						"symbol": "ETH/USD",
+						"side": "buy",
+						"price": 3245.67,
+						"qty": 1.5,
+						"ord_type": "limit",
+						"trade_id": 4665848,
+						"timestamp": "2025-07-25T14:44:10.880Z"
+					}
+				]
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "btcusd",
+					Price:     115170.5,
+					Quantity:  0.5,
+					Timestamp: time.UnixMilli(1753454650870),
+					Source:    "Kraken",
+				},
+				{
+					Symbol:    "ethusd",
+					Price:     3245.67,
+					Quantity:  1.5,
+					Timestamp: time.UnixMilli(1753454650880),
+					Source:    "Kraken",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name:        "heartbeat message",
+			payload:     `{"channel": "heartbeat"}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "pong message",
+			payload: `{
+				"method": "pong",
+				"req_id": 2,
+				"time_in": "2025-07-25T14:44:10.000Z",
+				"time_out": "2025-07-25T14:44:10.001Z"
+			}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "subscribe acknowledgement",
+			payload: `{
+				"method": "subscribe",
+				"result": {"channel": "trade", "snapshot": false, "symbol": "BTC/USDT"},
+				"success": true,
+				"time_in": "2025-07-25T14:44:09.000Z",
+				"time_out": "2025-07-25T14:44:09.001Z",
+				"req_id": 1
+			}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name: "subscribe rejection",
+			payload: `{
+				"method": "subscribe",
+				"success": false,
+				"error": "Currency pair not supported BTC/XYZ",
+				"symbol": "BTC/XYZ",
+				"req_id": 1
+			}`,
+			shouldError: true,
+		},
+		{
+			name: "invalid JSON with wrong price format",
+			payload: `{
+				"channel": "trade",
+				"type": "update",
+				"data": [
+					{
+						"symbol": "BTC/USDT",
+						"price": "invalid_price",
+						"qty": 0.00193696,
+						"timestamp": "2025-07-25T14:44:10.864Z"
+					}
+				]
+			}`,
+			shouldError: true,
+		},
+		{
+			name: "malformed JSON",
+			payload: `{
+				"channel": "trade"
+				"data": [
+			}`,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clear the channels before each test
+			for len(tradeChannel) > 0 {
+				<-tradeChannel
+			}
+			for len(adapter.pongChannel) > 0 {
+				<-adapter.pongChannel
+			}
+
+			// Handle the message
+			err := adapter.HandleMessage([]byte(tt.payload))
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			// Check number of trades sent to channel
+			expectedCount := len(tt.expected)
+			if len(tradeChannel) != expectedCount {
+				t.Errorf("Expected %d trades in channel, got %d", expectedCount, len(tradeChannel))
+				return
+			}
+
+			// Verify each trade
+			for i, expectedTrade := range tt.expected {
+				receivedTrade := <-tradeChannel
+
+				if receivedTrade.Symbol != expectedTrade.Symbol {
+					t.Errorf("Trade %d: Expected symbol %s, got %s", i, expectedTrade.Symbol, receivedTrade.Symbol)
+				}
+				if receivedTrade.Price != expectedTrade.Price {
+					t.Errorf("Trade %d: Expected price %f, got %f", i, expectedTrade.Price, receivedTrade.Price)
+				}
+				if receivedTrade.Quantity != expectedTrade.Quantity {
+					t.Errorf("Trade %d: Expected quantity %f, got %f", i, expectedTrade.Quantity, receivedTrade.Quantity)
+				}
+				if receivedTrade.Timestamp.UnixMilli() != expectedTrade.Timestamp.UnixMilli() {
+					t.Errorf("Trade %d: Expected timestamp %d, got %d", i, expectedTrade.Timestamp.UnixMilli(), receivedTrade.Timestamp.UnixMilli())
+				}
+				if receivedTrade.Source != expectedTrade.Source {
+					t.Errorf("Trade %d: Expected source %s, got %s", i, expectedTrade.Source, receivedTrade.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestKrakenAdapter_HandleMessage_Pong(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+
+	if err := adapter.HandleMessage([]byte(`{"method": "pong", "req_id": 1}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case <-adapter.GetPongChan():
+	default:
+		t.Errorf("Expected a pong on the pong channel")
+	}
+}
+
+func TestKrakenAdapter_ResponseSymbolToOutputString(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"BTC/USDT", "btcusdt"},
+		{"XBT/USDT", "btcusdt"}, // Should translate Kraken's name of bitcoin
+		{"XDG/USD", "dogeusd"},
+		{"ETH/USD", "ethusd"},
+		{"INVALID", ""}, // Should handle missing separator
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := adapter.responseSymbolToOutputString(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			}
+		})
+	}
+}
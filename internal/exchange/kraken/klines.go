@@ -0,0 +1,144 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Intervals in minutes supported by the OHLC endpoint
+var klineIntervals = map[time.Duration]int{
+	time.Minute:      1,
+	5 * time.Minute:  5,
+	15 * time.Minute: 15,
+	30 * time.Minute: 30,
+	time.Hour:        60,
+	4 * time.Hour:    240,
+	24 * time.Hour:   1440,
+}
+
+// Number of the most recent klines the OHLC endpoint serves. Older klines cannot be fetched
+const klineLimit = 720
+
+type krakenKlineResponse struct {
+	Error []string `json:"error"`
+	// Klines keyed by the pair, e.g. "XXBTZUSD", next to the "last" pagination cursor
+	// Each kline is an array of [time, open, high, low, close, vwap, volume, count], with time in seconds
+	Result map[string]json.RawMessage `json:"result"`
+}
+
+func (b *KrakenAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /0/public/OHLC
+// Returns an error if from is older than the most recent klines the endpoint serves, instead of a range cut short
+func (b *KrakenAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	krakenInterval, ok := klineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	query := url.Values{}
+	query.Set("pair", symbolToRestPair(symbol))
+	query.Set("interval", strconv.Itoa(krakenInterval))
+	// since is exclusive
+	query.Set("since", strconv.FormatInt(from.Unix()-1, 10))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.RestURL+"/0/public/OHLC?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kraken failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kraken failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	var kr krakenKlineResponse
+	if err := json.NewDecoder(res.Body).Decode(&kr); err != nil {
+		return nil, fmt.Errorf("kraken failed to unmarshal klines: %w", err)
+	}
+	if len(kr.Error) > 0 {
+		return nil, fmt.Errorf("kraken failed to fetch klines: %s", strings.Join(kr.Error, ", "))
+	}
+
+	klines := []exchange.Kline{}
+	rows := 0
+	for pair, raw := range kr.Result {
+		if pair == "last" {
+			continue
+		}
+		var pairRows [][]json.RawMessage
+		if err := json.Unmarshal(raw, &pairRows); err != nil {
+			return nil, fmt.Errorf("kraken failed to unmarshal klines: %w", err)
+		}
+		rows += len(pairRows)
+		for _, row := range pairRows {
+			kline, err := b.klineRowToDomainKline(symbol, row)
+			if err != nil {
+				return nil, err
+			}
+			if kline.Start.Before(from) || kline.Start.After(to) {
+				continue
+			}
+			klines = append(klines, kline)
+		}
+	}
+	// A full response starting after from holds the most recent klines only
+	if rows >= klineLimit && (len(klines) == 0 || klines[0].Start.After(from)) {
+		return nil, fmt.Errorf("kraken failed to fetch klines: only the last %d klines are served, the range from %s is cut short", klineLimit, from.UTC().Format(time.RFC3339))
+	}
+	return klines, nil
+}
+
+func (b *KrakenAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []json.RawMessage) (exchange.Kline, error) {
+	if len(row) < 7 {
+		return exchange.Kline{}, fmt.Errorf("kraken failed to unmarshal kline: expected at least 7 fields, got %d", len(row))
+	}
+
+	var start int64
+	if err := json.Unmarshal(row[0], &start); err != nil {
+		return exchange.Kline{}, fmt.Errorf("kraken failed to unmarshal kline: %w", err)
+	}
+	// open, high, low, close, then volume after the vwap
+	fields := []json.RawMessage{row[1], row[2], row[3], row[4], row[6]}
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		var s string
+		if err := json.Unmarshal(field, &s); err != nil {
+			return exchange.Kline{}, fmt.Errorf("kraken failed to unmarshal kline: %w", err)
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("kraken failed to unmarshal kline: %w", err)
+		}
+		values[i] = value
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.Unix(start, 0),
+		Open:   values[0],
+		High:   values[1],
+		Low:    values[2],
+		Close:  values[3],
+		Volume: values[4],
+		Source: b.Name(),
+	}, nil
+}
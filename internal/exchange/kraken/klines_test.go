@@ -0,0 +1,112 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKrakenAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0/public/OHLC" {
+			t.Errorf("Expected path /0/public/OHLC, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("pair") != "XBTUSDT" || query.Get("interval") != "1" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if query.Get("since") != "1753445759" {
+			t.Errorf("Unexpected since %s", query.Get("since"))
+		}
+		w.Write([]byte(`{
+			"error": [],
+			"result": {
+				"XBTUSDT": [
+					[1753445760, "116489.45", "116500", "116400.1", "116450", "116460.2", "12.5", 120],
+					[1753445820, "116450", "116460", "116420", "116430", "116440.7", "3.25", 31],
+					[1753445880, "116430", "116440", "116410", "116420", "116425.0", "1.5", 12]
+				],
+				"last": 1753445820
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usdt"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(klines) != 2 {
+		t.Fatalf("Expected 2 klines, got %d", len(klines))
+	}
+	if klines[0].Start.UnixMilli() != 1753445760000 || klines[1].Start.UnixMilli() != 1753445820000 {
+		t.Errorf("Expected klines ordered by start time, got %d and %d", klines[0].Start.UnixMilli(), klines[1].Start.UnixMilli())
+	}
+	if klines[0].Symbol != "btcusdt" || klines[0].Source != "Kraken" {
+		t.Errorf("Expected btcusdt from Kraken, got %s from %s", klines[0].Symbol, klines[0].Source)
+	}
+	if klines[0].Open != 116489.45 || klines[0].High != 116500 || klines[0].Low != 116400.1 || klines[0].Close != 116450 || klines[0].Volume != 12.5 {
+		t.Errorf("Unexpected kline values %v", klines[0])
+	}
+}
+
+func TestKrakenAdapter_FetchKlines_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": ["EQuery:Unknown asset pair"]}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	_, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "xyz"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestKrakenAdapter_FetchKlines_CutShort(t *testing.T) {
+	// Only the most recent klines are served, whatever since asks for
+	from := time.Unix(1753445760, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rows []string
+		for i := range klineLimit {
+			rows = append(rows, fmt.Sprintf(`[%d, "1", "1", "1", "1", "1", "1", 1]`, from.Unix()+int64(60*(i+100))))
+		}
+		fmt.Fprintf(w, `{"error": [], "result": {"XXBTZUSD": [%s], "last": 0}}`, strings.Join(rows, ","))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	_, err := adapter.FetchKlines(context.Background(), exchange.SymbolPair{First: "btc", Second: "usd"}, time.Minute, from, from.Add(1000*time.Minute))
+	if err == nil {
+		t.Errorf("Expected an error for a range older than the served klines")
+	}
+}
@@ -0,0 +1,51 @@
+package kraken
+
+import (
+	"fmt"
+	"hermeneutic-candles/internal/exchange"
+	"strings"
+)
+
+// Kraken names some assets differently from the other exchanges
+// The REST API uses these names while the websocket v2 API uses the common ones, and both are translated back
+var krakenAssets = map[string]string{
+	"btc":  "XBT",
+	"doge": "XDG",
+}
+
+// Returns the Kraken name of an asset
+//
+// Ex: "btc" -> "XBT", "usdt" -> "USDT"
+func toKrakenAsset(asset string) string {
+	if krakenAsset, ok := krakenAssets[strings.ToLower(asset)]; ok {
+		return krakenAsset
+	}
+	return strings.ToUpper(asset)
+}
+
+// Returns the common name of a Kraken asset, in the format used by Trade.Symbol
+//
+// Ex: "XBT" -> "btc", "USDT" -> "usdt"
+func fromKrakenAsset(krakenAsset string) string {
+	upper := strings.ToUpper(krakenAsset)
+	for asset, name := range krakenAssets {
+		if name == upper {
+			return asset
+		}
+	}
+	return strings.ToLower(krakenAsset)
+}
+
+// Returns the symbol of the websocket v2 API
+//
+// Ex: {First: "btc", Second: "usdt"} -> "BTC/USDT"
+func symbolToWebsocketSymbol(symbol exchange.SymbolPair) string {
+	return fmt.Sprintf("%s/%s", strings.ToUpper(symbol.First), strings.ToUpper(symbol.Second))
+}
+
+// Returns the pair of the REST API
+//
+// Ex: {First: "btc", Second: "usdt"} -> "XBTUSDT"
+func symbolToRestPair(symbol exchange.SymbolPair) string {
+	return toKrakenAsset(symbol.First) + toKrakenAsset(symbol.Second)
+}
@@ -0,0 +1,65 @@
+package kraken
+
+import (
+	"hermeneutic-candles/internal/exchange"
+	"testing"
+)
+
+func TestSymbolTranslation(t *testing.T) {
+	tests := []struct {
+		name              string
+		symbol            exchange.SymbolPair
+		expectedWebsocket string
+		expectedRest      string
+	}{
+		{
+			name:              "bitcoin",
+			symbol:            exchange.SymbolPair{First: "btc", Second: "usdt"},
+			expectedWebsocket: "BTC/USDT",
+			expectedRest:      "XBTUSDT",
+		},
+		{
+			name:              "dogecoin",
+			symbol:            exchange.SymbolPair{First: "DOGE", Second: "usd"},
+			expectedWebsocket: "DOGE/USD",
+			expectedRest:      "XDGUSD",
+		},
+		{
+			name:              "asset without a Kraken name",
+			symbol:            exchange.SymbolPair{First: "eth", Second: "usdt"},
+			expectedWebsocket: "ETH/USDT",
+			expectedRest:      "ETHUSDT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := symbolToWebsocketSymbol(tt.symbol); result != tt.expectedWebsocket {
+				t.Errorf("Expected websocket symbol '%s', got '%s'", tt.expectedWebsocket, result)
+			}
+			if result := symbolToRestPair(tt.symbol); result != tt.expectedRest {
+				t.Errorf("Expected REST pair '%s', got '%s'", tt.expectedRest, result)
+			}
+		})
+	}
+}
+
+func TestSymbolTranslation_RoundTrip(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+
+	// Kraken trades must merge into the same bucket as the other exchanges' trades
+	for _, symbol := range []exchange.SymbolPair{
+		{First: "btc", Second: "usdt"},
+		{First: "doge", Second: "usd"},
+		{First: "eth", Second: "usdt"},
+	} {
+		if result := adapter.responseSymbolToOutputString(symbolToWebsocketSymbol(symbol)); result != symbol.Key() {
+			t.Errorf("Expected %s to round trip, got '%s'", symbol.Key(), result)
+		}
+		// The websocket API may answer with the Kraken names as well
+		krakenName := toKrakenAsset(symbol.First) + "/" + toKrakenAsset(symbol.Second)
+		if result := adapter.responseSymbolToOutputString(krakenName); result != symbol.Key() {
+			t.Errorf("Expected %s to round trip from %s, got '%s'", symbol.Key(), krakenName, result)
+		}
+	}
+}
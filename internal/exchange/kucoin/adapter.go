@@ -0,0 +1,246 @@
+package kucoin
+
+import (
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Time to wait for the welcome message after dialing
+const welcomeTimeout = 10 * time.Second
+
+type KucoinAdapter struct {
+	tradeChannel chan<- exchange.Trade
+	pongChannel  chan time.Time
+	clock        clock.Clock
+	connection   *websocket.Conn
+	// Websocket connections support a single concurrent writer
+	writeMu   sync.Mutex
+	requestID int
+	// Provided by the bootstrap of the last connection
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_KUCOIN_REST_URL
+const registryName = "kucoin"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	RestURL: "https://api.kucoin.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
+}
+
+func NewAdapter(tradeChannel chan<- exchange.Trade) *KucoinAdapter {
+	return &KucoinAdapter{
+		tradeChannel: tradeChannel,
+		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
+	}
+}
+
+type kucoinTradeData struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price,string"`
+	Size   float64 `json:"size,string"`
+	// Nanoseconds since epoch
+	Time int64 `json:"time,string"`
+}
+type kucoinMessage struct {
+	Type    string          `json:"type"`
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+	Code    int             `json:"code"`
+}
+
+func (b *KucoinAdapter) Name() string {
+	return "Kucoin"
+}
+
+func (b *KucoinAdapter) GetPongChan() <-chan time.Time {
+	return b.pongChannel
+}
+
+func (b *KucoinAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+func (b *KucoinAdapter) PingInterval() (time.Duration, time.Duration) {
+	return b.pingInterval, b.pingTimeout
+}
+
+// A match topic carries up to 100 symbols, and a connection up to 400 topics. A connection can send 100 messages per 10 seconds
+func (b *KucoinAdapter) SubscriptionLimits() exchange.SubscriptionLimits {
+	return exchange.SubscriptionLimits{SymbolsPerConnection: 400, SymbolsPerMessage: 100, MessagesPerSecond: 10}
+}
+
+// Requests a token and endpoint with the bullet-public bootstrap, then dials the endpoint and subscribes
+func (b *KucoinAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
+	cfg := cmd.GetConfig()
+	bullet, err := fetchBullet(cfg.Exchange(registryName, defaultEndpoints).RestURL)
+	if err != nil {
+		return nil, err
+	}
+	b.pingInterval = bullet.pingInterval
+	b.pingTimeout = bullet.pingTimeout
+
+	u := bullet.endpoint
+	query := u.Query()
+	query.Set("token", bullet.token)
+	query.Set("connectId", strconv.FormatInt(time.Now().UnixNano(), 10))
+	u.RawQuery = query.Encode()
+
+	slog.Info("Connecting", "exchange", b.Name(), "url", bullet.endpoint.String())
+
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.connection = c
+
+	// KuCoin sends a welcome message once the connection is ready for subscriptions
+	c.SetReadDeadline(time.Now().Add(welcomeTimeout))
+	var welcome kucoinMessage
+	if err := c.ReadJSON(&welcome); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("kucoin failed to receive welcome message: %w", err)
+	}
+	if welcome.Type != "welcome" {
+		c.Close()
+		return nil, fmt.Errorf("kucoin expected welcome message, got %s", welcome.Type)
+	}
+	c.SetReadDeadline(time.Time{})
+
+	// send a subscription message
+	if err := c.WriteJSON(b.nextSubscriptionMessage("subscribe", symbols)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to subscribe to symbols: %w", err)
+	}
+
+	return c, nil
+}
+
+func (b *KucoinAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("subscribe", symbols)
+}
+
+func (b *KucoinAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("unsubscribe", symbols)
+}
+
+func (b *KucoinAdapter) sendSubscription(messageType string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", messageType)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	if err := b.connection.WriteJSON(b.nextSubscriptionMessage(messageType, symbols)); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", messageType, err)
+	}
+	return nil
+}
+
+func (b *KucoinAdapter) nextSubscriptionMessage(messageType string, symbols []exchange.SymbolPair) map[string]interface{} {
+	b.requestID++
+	return map[string]interface{}{
+		"id":             strconv.Itoa(b.requestID),
+		"type":           messageType,
+		"topic":          b.symbolsToTopic(symbols),
+		"privateChannel": false,
+		"response":       true,
+	}
+}
+
+func (b *KucoinAdapter) HandleMessage(message []byte) error {
+	var m kucoinMessage
+	if err := json.Unmarshal(message, &m); err != nil {
+		return fmt.Errorf("kucoin failed to unmarshal message: %w", err)
+	}
+
+	switch m.Type {
+	case "pong":
+		b.pongChannel <- b.clock.Now()
+		return nil
+	case "error":
+		return fmt.Errorf("kucoin returned error %d: %s", m.Code, m.Data)
+	case "message":
+		if m.Subject != "trade.l3match" {
+			return nil
+		}
+		var data kucoinTradeData
+		if err := json.Unmarshal(m.Data, &data); err != nil {
+			return fmt.Errorf("kucoin failed to unmarshal message: %w", err)
+		}
+		b.tradeChannel <- b.kucoinTradeDataToDomainTrade(data)
+		return nil
+	default:
+		// Welcome and ack messages carry no trades
+		return nil
+	}
+}
+
+func (b *KucoinAdapter) Ping() error {
+	if b.connection != nil {
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
+		b.requestID++
+		b.connection.WriteJSON(map[string]interface{}{
+			"id":   strconv.Itoa(b.requestID),
+			"type": "ping",
+		})
+		return nil
+	} else {
+		return fmt.Errorf("tried to ping without a valid connection")
+	}
+}
+
+// Returns the match topic of the symbols
+//
+// Ex: [{First: "btc", Second: "usdt"}, {First: "eth", Second: "usdt"}] -> "/market/match:BTC-USDT,ETH-USDT"
+func (b *KucoinAdapter) symbolsToTopic(symbols []exchange.SymbolPair) string {
+	kucoinSymbols := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		kucoinSymbols = append(kucoinSymbols, symbolToKucoinSymbol(symbol))
+	}
+	return "/market/match:" + strings.Join(kucoinSymbols, ",")
+}
+
+func symbolToKucoinSymbol(symbol exchange.SymbolPair) string {
+	return fmt.Sprintf("%s-%s", strings.ToUpper(symbol.First), strings.ToUpper(symbol.Second))
+}
+
+func (b *KucoinAdapter) responseSymbolToOutputString(s string) string {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.ToLower(fmt.Sprintf("%s%s", parts[0], parts[1]))
+}
+
+func (b *KucoinAdapter) kucoinTradeDataToDomainTrade(
+	data kucoinTradeData,
+) exchange.Trade {
+	return exchange.Trade{
+		Symbol:    b.responseSymbolToOutputString(data.Symbol),
+		Price:     data.Price,
+		Quantity:  data.Size,
+		Timestamp: time.Unix(0, data.Time),
+		Source:    b.Name(),
+	}
+}
@@ -0,0 +1,297 @@
+package kucoin
+
+import (
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestKucoinAdapter_HandleMessage(t *testing.T) {
+	// Create a buffered channel to capture trades
+	tradeChannel := make(chan exchange.Trade, 10)
+
+	// Create the adapter
+	adapter := NewAdapter(tradeChannel)
+
+	tests := []struct {
+		name        string
+		payload     string
+		expected    []exchange.Trade
+		shouldError bool
+	}{
+		{
+			name: "valid BTC match",
+			payload: `{
+				"type": "message",
+				"topic": "/market/match:BTC-USDT",
+				"subject": "trade.l3match",
+				"data": {
+					"makerOrderId": "6287c3015c27e000017d0c2f",
+					"price": "115168",
+					"sequence": "1627871568340",
+					"side": "sell",
+					"size": "0.00193696",
+					"symbol": "BTC-USDT",
+					"takerOrderId": "6287c30e2b7f5b00018a2fc5",
+					"time": "1753454650864000000",
+					"tradeId": "6287c30e2b7f5b00018a2fc6",
+					"type": "match"
+				}
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "btcusdt",
+					Price:     115168,
+					Quantity:  0.00193696,
+					Timestamp: time.UnixMilli(1753454650864),
+					Source:    "Kucoin",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "valid ETH match",
+			payload: `{
+				"type": "message",
+				"topic": "/market/match:ETH-USDT",
+				"subject": "trade.l3match",
+				"data": {
+					"price": "3245.67",
+					"side": "buy",
+					"size": "1.5",
+					"symbol": "ETH-USDT",
+					"time": "1753454650870000000",
+					"type": "match"
+				}
+			}`,
+			expected: []exchange.Trade{
+				{
+					Symbol:    "ethusdt",
+					Price:     3245.67,
+					Quantity:  1.5,
+					Timestamp: time.UnixMilli(1753454650870),
+					Source:    "Kucoin",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name:        "welcome message",
+			payload:     `{"id": "hQvf8jkno", "type": "welcome"}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name:        "subscribe acknowledgement",
+			payload:     `{"id": "1", "type": "ack"}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name:        "pong message",
+			payload:     `{"id": "2", "type": "pong"}`,
+			expected:    []exchange.Trade{},
+			shouldError: false,
+		},
+		{
+			name:        "error message",
+			payload:     `{"id": "1", "type": "error", "code": 404, "data": "topic /market/match:BTC-XYZ is not found"}`,
+			shouldError: true,
+		},
+		{
+			name: "invalid JSON with wrong price format",
+			payload: `{
+				"type": "message",
+				"topic": "/market/match:BTC-USDT",
+				"subject": "trade.l3match",
+				"data": {
+					"price": "invalid_price",
+					"size": "0.00193696",
+					"symbol": "BTC-USDT",
+					"time": "1753454650864000000"
+				}
+			}`,
+			shouldError: true,
+		},
+		{
+			name: "malformed JSON",
+			payload: `{
+				"type": "message"
+				"data": {
+			}`,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clear the channels before each test
+			for len(tradeChannel) > 0 {
+				<-tradeChannel
+			}
+			for len(adapter.pongChannel) > 0 {
+				<-adapter.pongChannel
+			}
+
+			// Handle the message
+			err := adapter.HandleMessage([]byte(tt.payload))
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			// Check number of trades sent to channel
+			expectedCount := len(tt.expected)
+			if len(tradeChannel) != expectedCount {
+				t.Errorf("Expected %d trades in channel, got %d", expectedCount, len(tradeChannel))
+				return
+			}
+
+			// Verify each trade
+			for i, expectedTrade := range tt.expected {
+				receivedTrade := <-tradeChannel
+
+				if receivedTrade.Symbol != expectedTrade.Symbol {
+					t.Errorf("Trade %d: Expected symbol %s, got %s", i, expectedTrade.Symbol, receivedTrade.Symbol)
+				}
+				if receivedTrade.Price != expectedTrade.Price {
+					t.Errorf("Trade %d: Expected price %f, got %f", i, expectedTrade.Price, receivedTrade.Price)
+				}
+				if receivedTrade.Quantity != expectedTrade.Quantity {
+					t.Errorf("Trade %d: Expected quantity %f, got %f", i, expectedTrade.Quantity, receivedTrade.Quantity)
+				}
+				if receivedTrade.Timestamp.UnixMilli() != expectedTrade.Timestamp.UnixMilli() {
+					t.Errorf("Trade %d: Expected timestamp %d, got %d", i, expectedTrade.Timestamp.UnixMilli(), receivedTrade.Timestamp.UnixMilli())
+				}
+				if receivedTrade.Source != expectedTrade.Source {
+					t.Errorf("Trade %d: Expected source %s, got %s", i, expectedTrade.Source, receivedTrade.Source)
+				}
+			}
+		})
+	}
+
+	// Pongs are timestamped on the clock of the adapter
+	clock := fakeclock.New(time.UnixMilli(1753454650864))
+	adapter.SetClock(clock)
+	if err := adapter.HandleMessage([]byte(`{"id": "3", "type": "pong"}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pong := <-adapter.GetPongChan(); !pong.Equal(clock.Now()) {
+		t.Errorf("Expected the pong at %v, got %v", clock.Now(), pong)
+	}
+}
+
+func TestKucoinAdapter_SymbolsToTopic(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+
+	topic := adapter.symbolsToTopic([]exchange.SymbolPair{
+		{First: "btc", Second: "usdt"},
+		{First: "ETH", Second: "usdt"},
+	})
+	if topic != "/market/match:BTC-USDT,ETH-USDT" {
+		t.Errorf("Expected '/market/match:BTC-USDT,ETH-USDT', got '%s'", topic)
+	}
+}
+
+func TestKucoinAdapter_ConnectAndSubscribe(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	subscribed := make(chan map[string]interface{}, 1)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v1/bullet-public", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST, got %s", r.Method)
+		}
+		w.Write([]byte(`{
+			"code": "200000",
+			"data": {
+				"token": "test-token",
+				"instanceServers": [
+					{
+						"endpoint": "ws://` + strings.TrimPrefix(server.URL, "http://") + `/endpoint",
+						"encrypt": false,
+						"protocol": "websocket",
+						"pingInterval": 18000,
+						"pingTimeout": 10000
+					}
+				]
+			}
+		}`))
+	})
+	mux.HandleFunc("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "test-token" {
+			t.Errorf("Expected token test-token, got %s", r.URL.Query().Get("token"))
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade: %v", err)
+			return
+		}
+		defer c.Close()
+
+		c.WriteJSON(map[string]string{"id": "welcome-id", "type": "welcome"})
+		var message map[string]interface{}
+		if err := c.ReadJSON(&message); err != nil {
+			t.Errorf("Failed to read subscribe message: %v", err)
+			return
+		}
+		subscribed <- message
+	})
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	c, err := adapter.ConnectAndSubscribe([]exchange.SymbolPair{{First: "btc", Second: "usdt"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	select {
+	case message := <-subscribed:
+		if message["type"] != "subscribe" || message["topic"] != "/market/match:BTC-USDT" {
+			t.Errorf("Unexpected subscribe message %v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Subscribe message not received")
+	}
+
+	interval, timeout := adapter.PingInterval()
+	if interval != 18*time.Second || timeout != 10*time.Second {
+		t.Errorf("Expected the ping interval provided by the server, got %s and %s", interval, timeout)
+	}
+}
+
+func TestKucoinAdapter_ConnectAndSubscribe_BootstrapError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code": "429000", "msg": "Too many requests"}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	if _, err := adapter.ConnectAndSubscribe([]exchange.SymbolPair{{First: "btc", Second: "usdt"}}); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,71 @@
+package kucoin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Token and endpoint to dial, returned by the bullet-public bootstrap
+type bullet struct {
+	token        string
+	endpoint     *url.URL
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+}
+
+type bulletResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Token           string `json:"token"`
+		InstanceServers []struct {
+			Endpoint string `json:"endpoint"`
+			Protocol string `json:"protocol"`
+			// Milliseconds
+			PingInterval int64 `json:"pingInterval"`
+			PingTimeout  int64 `json:"pingTimeout"`
+		} `json:"instanceServers"`
+	} `json:"data"`
+}
+
+// Client of the bullet-public bootstrap. Connects have no context, so the timeout keeps a hanging endpoint from blocking them,
+// and leaves the retries to the reconnect policy of the streamer
+var bulletClient = &http.Client{Timeout: 10 * time.Second}
+
+// Requests a token and the websocket endpoint with POST /api/v1/bullet-public
+func fetchBullet(restURL string) (bullet, error) {
+	res, err := bulletClient.Post(restURL+"/api/v1/bullet-public", "application/json", nil)
+	if err != nil {
+		return bullet{}, fmt.Errorf("kucoin failed to fetch token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return bullet{}, fmt.Errorf("kucoin failed to fetch token: status %d", res.StatusCode)
+	}
+
+	var br bulletResponse
+	if err := json.NewDecoder(res.Body).Decode(&br); err != nil {
+		return bullet{}, fmt.Errorf("kucoin failed to unmarshal token: %w", err)
+	}
+	if br.Code != "200000" {
+		return bullet{}, fmt.Errorf("kucoin failed to fetch token: %s", br.Msg)
+	}
+	if br.Data.Token == "" || len(br.Data.InstanceServers) == 0 {
+		return bullet{}, fmt.Errorf("kucoin failed to fetch token: no token or instance server returned")
+	}
+
+	server := br.Data.InstanceServers[0]
+	endpoint, err := url.Parse(server.Endpoint)
+	if err != nil {
+		return bullet{}, fmt.Errorf("kucoin returned an invalid endpoint %s: %w", server.Endpoint, err)
+	}
+	return bullet{
+		token:        br.Data.Token,
+		endpoint:     endpoint,
+		pingInterval: time.Duration(server.PingInterval) * time.Millisecond,
+		pingTimeout:  time.Duration(server.PingTimeout) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package kucoin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var klineIntervals = map[time.Duration]string{
+	time.Minute:      "1min",
+	3 * time.Minute:  "3min",
+	5 * time.Minute:  "5min",
+	15 * time.Minute: "15min",
+	30 * time.Minute: "30min",
+	time.Hour:        "1hour",
+	2 * time.Hour:    "2hour",
+	4 * time.Hour:    "4hour",
+	6 * time.Hour:    "6hour",
+	8 * time.Hour:    "8hour",
+	12 * time.Hour:   "12hour",
+	24 * time.Hour:   "1day",
+}
+
+// Maximum number of klines returned by a single request
+const klineLimit = 1500
+
+type kucoinKlineResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	// Each kline is an array of [time, open, close, high, low, volume, turnover], with time in seconds
+	Data [][]string `json:"data"`
+}
+
+func (b *KucoinAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /api/v1/market/candles
+// Ranges over the request limit are fetched in pages
+func (b *KucoinAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	kucoinInterval, ok := klineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	return exchange.FetchKlinePages(from, to, interval, klineLimit, func(from, to time.Time) ([]exchange.Kline, error) {
+		return b.fetchKlinePage(ctx, symbol, kucoinInterval, from, to)
+	})
+}
+
+// Fetches the klines starting within [from, to], which must hold at most klineLimit klines
+func (b *KucoinAdapter) fetchKlinePage(ctx context.Context, symbol exchange.SymbolPair, kucoinInterval string, from, to time.Time) ([]exchange.Kline, error) {
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	query := url.Values{}
+	query.Set("symbol", symbolToKucoinSymbol(symbol))
+	query.Set("type", kucoinInterval)
+	query.Set("startAt", strconv.FormatInt(from.Unix(), 10))
+	query.Set("endAt", strconv.FormatInt(to.Unix(), 10))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.RestURL+"/api/v1/market/candles?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kucoin failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kucoin failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	var kr kucoinKlineResponse
+	if err := json.NewDecoder(res.Body).Decode(&kr); err != nil {
+		return nil, fmt.Errorf("kucoin failed to unmarshal klines: %w", err)
+	}
+	if kr.Code != "200000" {
+		return nil, fmt.Errorf("kucoin failed to fetch klines: %s", kr.Msg)
+	}
+
+	klines := make([]exchange.Kline, 0, len(kr.Data))
+	for _, row := range kr.Data {
+		kline, err := b.klineRowToDomainKline(symbol, row)
+		if err != nil {
+			return nil, err
+		}
+		if kline.Start.Before(from) || kline.Start.After(to) {
+			continue
+		}
+		klines = append(klines, kline)
+	}
+
+	// KuCoin returns the newest kline first
+	slices.SortFunc(klines, func(a, b exchange.Kline) int {
+		return a.Start.Compare(b.Start)
+	})
+	return klines, nil
+}
+
+func (b *KucoinAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []string) (exchange.Kline, error) {
+	if len(row) < 6 {
+		return exchange.Kline{}, fmt.Errorf("kucoin failed to unmarshal kline: expected at least 6 fields, got %d", len(row))
+	}
+
+	start, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return exchange.Kline{}, fmt.Errorf("kucoin failed to unmarshal kline: %w", err)
+	}
+	values := make([]float64, 5)
+	for i := range values {
+		value, err := strconv.ParseFloat(row[i+1], 64)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("kucoin failed to unmarshal kline: %w", err)
+		}
+		values[i] = value
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.Unix(start, 0),
+		Open:   values[0],
+		Close:  values[1],
+		High:   values[2],
+		Low:    values[3],
+		Volume: values[4],
+		Source: b.Name(),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package kucoin
+
+import (
+	"context"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKucoinAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/market/candles" {
+			t.Errorf("Expected path /api/v1/market/candles, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("symbol") != "BTC-USDT" || query.Get("type") != "1min" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if query.Get("startAt") != "1753445760" || query.Get("endAt") != "1753445820" {
+			t.Errorf("Unexpected range startAt %s endAt %s", query.Get("startAt"), query.Get("endAt"))
+		}
+		// Newest kline first
+		w.Write([]byte(`{
+			"code": "200000",
+			"data": [
+				["1753445820", "116450", "116430", "116460", "116420", "3.25", "378400.5"],
+				["1753445760", "116489.45", "116450", "116500", "116400.1", "12.5", "1456000.1"]
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	cfg := cmd.GetConfig()
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: server.URL}
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usdt"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(klines) != 2 {
+		t.Fatalf("Expected 2 klines, got %d", len(klines))
+	}
+	if klines[0].Start.UnixMilli() != 1753445760000 || klines[1].Start.UnixMilli() != 1753445820000 {
+		t.Errorf("Expected klines ordered by start time, got %d and %d", klines[0].Start.UnixMilli(), klines[1].Start.UnixMilli())
+	}
+	if klines[0].Symbol != "btcusdt" || klines[0].Source != "Kucoin" {
+		t.Errorf("Expected btcusdt from Kucoin, got %s from %s", klines[0].Symbol, klines[0].Source)
+	}
+	if klines[0].Open != 116489.45 || klines[0].High != 116500 || klines[0].Low != 116400.1 || klines[0].Close != 116450 || klines[0].Volume != 12.5 {
+		t.Errorf("Unexpected kline values %v", klines[0])
+	}
+}
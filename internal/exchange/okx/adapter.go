@@ -2,12 +2,16 @@ package okx
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"log"
+	"log/slog"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,13 +20,39 @@ import (
 type OkxAdapter struct {
 	tradeChannel chan<- exchange.Trade
 	pongChannel  chan time.Time
+	clock        clock.Clock
 	connection   *websocket.Conn
+	// Websocket connections support a single concurrent writer
+	writeMu   sync.Mutex
+	requestID int
+	market    exchange.Market
+	acks      exchange.Acks
+	// Instrument ID -> amount of the base asset per contract, of perpetual swaps
+	// Refreshed by the subscriptions of swaps it does not list, while the connection reads trades
+	contractMu     sync.Mutex
+	contractValues map[string]float64
+}
+
+// Registry name of the exchange, which also prefixes its endpoint variables, e.g. EXCHANGE_OKX_REST_URL
+const registryName = "okx"
+
+// Public endpoints of the exchange, used unless set in cmd.Config.Exchanges
+var defaultEndpoints = cmd.ExchangeConfig{
+	WsAddress: "ws.okx.com:8443",
+	RestURL:   "https://www.okx.com",
+}
+
+func init() {
+	exchange.Register(registryName, func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(tradeChannel)
+	})
 }
 
 func NewAdapter(tradeChannel chan<- exchange.Trade) *OkxAdapter {
 	return &OkxAdapter{
 		tradeChannel: tradeChannel,
 		pongChannel:  make(chan time.Time, 1),
+		clock:        clock.Real(),
 	}
 }
 
@@ -40,6 +70,15 @@ type subscribeArgs struct {
 	InstId  string `json:"instId"`
 }
 
+// Response to a request, e.g. {"id":"1","event":"subscribe","arg":{"channel":"trades","instId":"BTC-USDT"}}
+// or {"id":"1","event":"error","code":"60018","msg":"Wrong URL or channel:trades,instId:FOO-USDT doesn't exist."}
+type okxEvent struct {
+	ID    string        `json:"id"`
+	Event string        `json:"event"`
+	Arg   subscribeArgs `json:"arg"`
+	Msg   string        `json:"msg"`
+}
+
 func (b *OkxAdapter) Name() string {
 	return "Okx"
 }
@@ -48,54 +87,190 @@ func (b *OkxAdapter) GetPongChan() <-chan time.Time {
 	return b.pongChannel
 }
 
+func (b *OkxAdapter) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+// Perpetual swaps are streamed from the SWAP instruments
+func (b *OkxAdapter) Markets() []exchange.Market {
+	return []exchange.Market{exchange.MarketPerp}
+}
+
+func (b *OkxAdapter) SetMarket(market exchange.Market) {
+	b.market = market
+}
+
+// Subscriptions are acknowledged per instrument, and a failed request names the instrument it rejected
+func (b *OkxAdapter) OnRejected(handler func(rejections []exchange.Rejection)) {
+	b.acks.OnRejected(handler)
+}
+
+// Subscribe requests are capped at 64 KB, and a connection can send 3 requests per second.
+// A full connection is subscribed with its connect request and 2 subscribe requests, spaced a third of a second apart
+func (b *OkxAdapter) SubscriptionLimits() exchange.SubscriptionLimits {
+	return exchange.SubscriptionLimits{SymbolsPerConnection: 300, SymbolsPerMessage: 100, MessagesPerSecond: 3}
+}
+
 func (b *OkxAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
 	cfg := cmd.GetConfig()
-	addr := fmt.Sprintf("%s:%d", cfg.OkxAddress, cfg.OkxPort)
-	u := url.URL{Scheme: "wss", Host: addr, Path: "/ws/v5/public"}
+	endpoints := cfg.Exchange(registryName, defaultEndpoints)
 
-	log.Printf("Connecting to %s at %s", b.Name(), u.String())
+	// Swap trades are sized in contracts, which are converted to the base asset
+	if b.market == exchange.MarketPerp {
+		if err := b.refreshContractValues(); err != nil {
+			return nil, err
+		}
+	}
+
+	u := url.URL{Scheme: "wss", Host: endpoints.WsAddress, Path: "/ws/v5/public"}
+
+	slog.Info("Connecting", "exchange", b.Name(), "url", u.String())
 
 	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	b.connection = c
+	b.acks.Reset()
 
-	// send a subscription message
-	subscribeMessage := map[string]interface{}{
-		"op":   "subscribe",
-		"args": b.symbolsToSubscribeArgs(symbols),
-	}
-	if err := c.WriteJSON(subscribeMessage); err != nil {
+	if err := b.sendSubscription("subscribe", symbols); err != nil {
 		c.Close()
-		return nil, fmt.Errorf("failed to subscribe to symbols: %w", err)
+		return nil, err
 	}
 
 	return c, nil
 }
 
+func (b *OkxAdapter) WaitForAcks(c *websocket.Conn, handle func(message []byte)) error {
+	timeout := time.Duration(cmd.GetConfig().WSSubscribeAckTimeout) * time.Millisecond
+	if err := b.acks.Wait(c, handle, timeout); err != nil {
+		return fmt.Errorf("okx %w", err)
+	}
+	return nil
+}
+
+func (b *OkxAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	// Swaps listed since the contract values were fetched would have no contract value to convert their trades with
+	if b.market == exchange.MarketPerp && b.missesContractValues(symbols) {
+		if err := b.refreshContractValues(); err != nil {
+			return err
+		}
+	}
+	return b.sendSubscription("subscribe", symbols)
+}
+
+// Fetches the contract value of every perpetual swap
+func (b *OkxAdapter) refreshContractValues() error {
+	contractValues, err := fetchContractValues(cmd.GetConfig().Exchange(registryName, defaultEndpoints).RestURL)
+	if err != nil {
+		return err
+	}
+	b.contractMu.Lock()
+	defer b.contractMu.Unlock()
+	b.contractValues = contractValues
+	return nil
+}
+
+// Returns true if the contract value of any of the swaps is unknown
+func (b *OkxAdapter) missesContractValues(symbols []exchange.SymbolPair) bool {
+	b.contractMu.Lock()
+	defer b.contractMu.Unlock()
+	for _, symbol := range symbols {
+		if _, ok := b.contractValues[symbolToInstId(symbol)]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the contract value of the swap, and false if it is unknown
+func (b *OkxAdapter) contractValue(instId string) (float64, bool) {
+	b.contractMu.Lock()
+	defer b.contractMu.Unlock()
+	contractValue, ok := b.contractValues[instId]
+	return contractValue, ok
+}
+
+func (b *OkxAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return b.sendSubscription("unsubscribe", symbols)
+}
+
+func (b *OkxAdapter) sendSubscription(op string, symbols []exchange.SymbolPair) error {
+	if b.connection == nil {
+		return fmt.Errorf("tried to %s without a valid connection", op)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	b.requestID++
+	requestID := strconv.Itoa(b.requestID)
+	args := b.symbolsToSubscribeArgs(symbols)
+	if op == "subscribe" {
+		instIds := make([]string, 0, len(args))
+		for _, arg := range args {
+			instIds = append(instIds, arg.InstId)
+		}
+		b.acks.Expect(requestID, instIds, symbols)
+	}
+
+	subscriptionMessage := map[string]interface{}{
+		"id":   requestID,
+		"op":   op,
+		"args": args,
+	}
+	if err := b.connection.WriteJSON(subscriptionMessage); err != nil {
+		return fmt.Errorf("failed to %s symbols: %w", op, err)
+	}
+	return nil
+}
+
 func (b *OkxAdapter) HandleMessage(message []byte) error {
 	if string(message) == "pong" {
-		b.pongChannel <- time.Now()
+		b.pongChannel <- b.clock.Now()
 		return nil
 	} else {
+		var event okxEvent
+		if err := json.Unmarshal(message, &event); err != nil {
+			return fmt.Errorf("okx failed to unmarshal message: %w", err)
+		}
+		if event.Event != "" {
+			switch event.Event {
+			case "subscribe":
+				b.acks.Ack(event.Arg.InstId)
+			case "error":
+				b.acks.RejectRequest(event.ID, event.Msg)
+			}
+			// Unsubscribe acknowledgements need no handling
+			return nil
+		}
+
 		var bt okxTrade
 		if err := json.Unmarshal(message, &bt); err != nil {
 			return fmt.Errorf("okx failed to unmarshal message: %w", err)
 		}
 
+		// A trade that can't be converted is dropped without the other trades of the message
+		var errs []error
 		for _, data := range bt.Data {
-			b.tradeChannel <- b.okxTradeDataToDomainTrade(
+			trade, err := b.okxTradeDataToDomainTrade(
 				data,
 			)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			b.tradeChannel <- trade
 		}
-		return nil
+		return errors.Join(errs...)
 	}
 }
 
 func (b *OkxAdapter) Ping() error {
 	if b.connection != nil {
 		pingMessage := "ping"
+		b.writeMu.Lock()
+		defer b.writeMu.Unlock()
 		b.connection.WriteMessage(websocket.TextMessage, []byte(pingMessage))
 		return nil
 	} else {
@@ -106,33 +281,54 @@ func (b *OkxAdapter) Ping() error {
 func (b *OkxAdapter) symbolsToSubscribeArgs(symbols []exchange.SymbolPair) []subscribeArgs {
 	var args []subscribeArgs
 	for _, symbol := range symbols {
-		first := strings.ToUpper(symbol.First)
-		second := strings.ToUpper(symbol.Second)
-		okxSymbol := fmt.Sprintf("%s-%s", first, second)
 		args = append(args, subscribeArgs{
 			Channel: "trades",
-			InstId:  okxSymbol,
+			InstId:  symbolToInstId(symbol),
 		})
 	}
 	return args
 }
 
+// Returns the instrument ID of the symbol
+//
+// Ex: {First: "btc", Second: "usdt"} -> "BTC-USDT", {First: "btc", Second: "usdt", Market: MarketPerp} -> "BTC-USDT-SWAP"
+func symbolToInstId(symbol exchange.SymbolPair) string {
+	instId := fmt.Sprintf("%s-%s", strings.ToUpper(symbol.First), strings.ToUpper(symbol.Second))
+	if symbol.Market == exchange.MarketPerp {
+		instId += "-SWAP"
+	}
+	return instId
+}
+
 func (b *OkxAdapter) responseSymbolToOutputString(s string) string {
 	parts := strings.Split(s, "-")
+	market := exchange.MarketSpot
+	if len(parts) == 3 && strings.EqualFold(parts[2], "SWAP") {
+		parts, market = parts[:2], exchange.MarketPerp
+	}
 	if len(parts) != 2 {
 		return ""
 	}
-	return strings.ToLower(fmt.Sprintf("%s%s", parts[0], parts[1]))
+	return exchange.MarketKey(strings.ToLower(fmt.Sprintf("%s%s", parts[0], parts[1])), market)
 }
 
 func (b *OkxAdapter) okxTradeDataToDomainTrade(
 	data okxTradeData,
-) exchange.Trade {
+) (exchange.Trade, error) {
+	quantity := data.Size
+	if strings.HasSuffix(data.InstId, "-SWAP") {
+		contractValue, ok := b.contractValue(data.InstId)
+		if !ok {
+			return exchange.Trade{}, fmt.Errorf("okx has no contract value for %s", data.InstId)
+		}
+		quantity *= contractValue
+	}
+
 	return exchange.Trade{
 		Symbol:    b.responseSymbolToOutputString(data.InstId),
 		Price:     data.Price,
-		Quantity:  data.Size,
+		Quantity:  quantity,
 		Timestamp: time.UnixMilli(data.TimeStamp),
 		Source:    b.Name(),
-	}
+	}, nil
 }
@@ -1,7 +1,10 @@
 package okx
 
 import (
+	"hermeneutic-candles/cmd"
 	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -248,6 +251,15 @@ func TestOkxAdapter_SymbolsToSubscribeArgs(t *testing.T) {
 				{Channel: "trades", InstId: "SOL-USDT"},
 			},
 		},
+		{
+			name: "perpetual swap",
+			symbols: []exchange.SymbolPair{
+				{First: "btc", Second: "usdt", Market: exchange.MarketPerp},
+			},
+			expected: []subscribeArgs{
+				{Channel: "trades", InstId: "BTC-USDT-SWAP"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -282,8 +294,10 @@ func TestOkxAdapter_ResponseSymbolToOutputString(t *testing.T) {
 		{"SOL-USDT", "solusdt"},
 		{"ADA-USDT", "adausdt"},
 		{"btc-usdt", "btcusdt"}, // Should handle lowercase
-		{"INVALID", ""},         // Should handle invalid format
-		{"BTC", ""},             // Should handle missing separator
+		{"BTC-USDT-SWAP", "btcusdt:perp"},
+		{"BTC-USD-250926", ""}, // Should not handle futures
+		{"INVALID", ""},        // Should handle invalid format
+		{"BTC", ""},            // Should handle missing separator
 	}
 
 	for _, tt := range tests {
@@ -315,7 +329,10 @@ func TestOkxAdapter_OkxTradeDataToDomainTrade(t *testing.T) {
 		Source:    "Okx",
 	}
 
-	result := adapter.okxTradeDataToDomainTrade(testData)
+	result, err := adapter.okxTradeDataToDomainTrade(testData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 
 	if result.Symbol != expected.Symbol {
 		t.Errorf("Expected symbol %s, got %s", expected.Symbol, result.Symbol)
@@ -333,3 +350,106 @@ func TestOkxAdapter_OkxTradeDataToDomainTrade(t *testing.T) {
 		t.Errorf("Expected source %s, got %s", expected.Source, result.Source)
 	}
 }
+
+func TestOkxAdapter_HandleMessage_Swap(t *testing.T) {
+	tradeChannel := make(chan exchange.Trade, 1)
+	adapter := NewAdapter(tradeChannel)
+	adapter.SetMarket(exchange.MarketPerp)
+	adapter.contractValues = map[string]float64{"BTC-USDT-SWAP": 0.01}
+
+	// Swap trades are sized in contracts
+	err := adapter.HandleMessage([]byte(`{
+		"arg": {"channel": "trades", "instId": "BTC-USDT-SWAP"},
+		"data": [
+			{"instId": "BTC-USDT-SWAP", "tradeId": "1", "px": "115170", "sz": "25", "side": "buy", "ts": "1753454650864"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	trade := <-tradeChannel
+	if trade.Symbol != "btcusdt:perp" {
+		t.Errorf("Expected symbol btcusdt:perp, got %s", trade.Symbol)
+	}
+	if trade.Quantity != 0.25 {
+		t.Errorf("Expected quantity 0.25 BTC, got %f", trade.Quantity)
+	}
+
+	// Unknown contract values can't be converted, and only the trades of their swap are dropped
+	err = adapter.HandleMessage([]byte(`{
+		"data": [
+			{"instId": "DOGE-USDT-SWAP", "px": "0.2", "sz": "1", "ts": "1753454650864"},
+			{"instId": "BTC-USDT-SWAP", "px": "115170", "sz": "10", "ts": "1753454650865"}
+		]
+	}`))
+	if err == nil {
+		t.Errorf("Expected error but got none")
+	}
+	if trade := <-tradeChannel; trade.Quantity != 0.1 {
+		t.Errorf("Expected the trade of the known swap with quantity 0.1 BTC, got %+v", trade)
+	}
+}
+
+func TestOkxAdapter_Subscribe_RefreshesContractValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code": "0", "data": [
+			{"instId": "BTC-USDT-SWAP", "ctVal": "0.01"},
+			{"instId": "DOGE-USDT-SWAP", "ctVal": "1000"}
+		]}`))
+	}))
+	defer server.Close()
+
+	setRestURL(t, server.URL)
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	adapter.SetMarket(exchange.MarketPerp)
+	adapter.contractValues = map[string]float64{"BTC-USDT-SWAP": 0.01}
+
+	// A swap listed after the connect is fetched before it is subscribed. The adapter has no connection to subscribe over
+	adapter.Subscribe([]exchange.SymbolPair{{First: "doge", Second: "usdt", Market: exchange.MarketPerp}})
+	if contractValue, ok := adapter.contractValue("DOGE-USDT-SWAP"); !ok || contractValue != 1000 {
+		t.Errorf("Expected the contract value 1000 of DOGE-USDT-SWAP, got %f", contractValue)
+	}
+}
+
+func TestOkxAdapter_HandleMessage_Acks(t *testing.T) {
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+
+	var rejections []exchange.Rejection
+	adapter.OnRejected(func(r []exchange.Rejection) {
+		rejections = append(rejections, r...)
+	})
+	btc := exchange.SymbolPair{First: "btc", Second: "usdt"}
+	foo := exchange.SymbolPair{First: "foo", Second: "usdt"}
+	adapter.acks.Expect("1", []string{"BTC-USDT", "FOO-USDT"}, []exchange.SymbolPair{btc, foo})
+
+	// Subscriptions are acknowledged per instrument
+	if err := adapter.HandleMessage([]byte(`{"id":"1","event":"subscribe","arg":{"channel":"trades","instId":"BTC-USDT"},"connId":"a4d3ae55"}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := adapter.HandleMessage([]byte(`{"id":"1","event":"error","code":"60018","msg":"Wrong URL or channel:trades,instId:FOO-USDT doesn't exist. Please use the correct URL, channel and parameters referring to API document.","connId":"a4d3ae55"}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pending := adapter.acks.Pending(); pending != 0 {
+		t.Errorf("Expected no pending acknowledgements, got %d", pending)
+	}
+	if len(rejections) != 1 || rejections[0].Symbol != foo {
+		t.Errorf("Expected foousdt to be rejected, got %+v", rejections)
+	}
+}
+
+// Points the REST endpoint of the global config at url, and restores the previous settings once the test ends
+func setRestURL(t *testing.T, url string) {
+	cfg := cmd.GetConfig()
+	previous, ok := cfg.Exchanges[registryName]
+	cfg.Exchanges[registryName] = cmd.ExchangeConfig{RestURL: url}
+	t.Cleanup(func() {
+		if ok {
+			cfg.Exchanges[registryName] = previous
+		} else {
+			delete(cfg.Exchanges, registryName)
+		}
+	})
+}
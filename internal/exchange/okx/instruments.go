@@ -0,0 +1,54 @@
+package okx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type okxInstrumentsResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Data []struct {
+		InstId string `json:"instId"`
+		CtVal  string `json:"ctVal"`
+	} `json:"data"`
+}
+
+// Client of the instruments endpoint. Connects have no context, so the timeout keeps a hanging endpoint from blocking them,
+// and leaves the retries to the reconnect policy of the streamer
+var instrumentsClient = &http.Client{Timeout: 10 * time.Second}
+
+// Fetches the contract value of every perpetual swap from GET /api/v5/public/instruments
+//
+// The contract value of linear swaps is the amount of the base asset per contract
+func fetchContractValues(restURL string) (map[string]float64, error) {
+	res, err := instrumentsClient.Get(restURL + "/api/v5/public/instruments?instType=SWAP")
+	if err != nil {
+		return nil, fmt.Errorf("okx failed to fetch instruments: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("okx failed to fetch instruments: status %d", res.StatusCode)
+	}
+
+	var ir okxInstrumentsResponse
+	if err := json.NewDecoder(res.Body).Decode(&ir); err != nil {
+		return nil, fmt.Errorf("okx failed to unmarshal instruments: %w", err)
+	}
+	if ir.Code != "0" {
+		return nil, fmt.Errorf("okx failed to fetch instruments: %s", ir.Msg)
+	}
+
+	contractValues := make(map[string]float64, len(ir.Data))
+	for _, instrument := range ir.Data {
+		contractValue, err := strconv.ParseFloat(instrument.CtVal, 64)
+		if err != nil {
+			return nil, fmt.Errorf("okx failed to unmarshal contract value of %s: %w", instrument.InstId, err)
+		}
+		contractValues[instrument.InstId] = contractValue
+	}
+	return contractValues, nil
+}
@@ -0,0 +1,145 @@
+package okx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var klineIntervals = map[time.Duration]string{
+	time.Minute:      "1m",
+	3 * time.Minute:  "3m",
+	5 * time.Minute:  "5m",
+	15 * time.Minute: "15m",
+	30 * time.Minute: "30m",
+	time.Hour:        "1H",
+	2 * time.Hour:    "2H",
+	4 * time.Hour:    "4H",
+}
+
+// Maximum number of klines returned by a single request
+const klineLimit = 100
+
+type okxKlineResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	// Each kline is an array of [ts, open, high, low, close, vol, volCcy, volCcyQuote, confirm]
+	Data [][]string `json:"data"`
+}
+
+func (b *OkxAdapter) KlineIntervals() []time.Duration {
+	intervals := make([]time.Duration, 0, len(klineIntervals))
+	for interval := range klineIntervals {
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Fetches klines from GET /api/v5/market/history-candles, of the SWAP instrument for perpetual swaps
+// Ranges over the request limit are fetched in pages
+func (b *OkxAdapter) FetchKlines(ctx context.Context, symbol exchange.SymbolPair, interval time.Duration, from, to time.Time) ([]exchange.Kline, error) {
+	okxInterval, ok := klineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", b.Name(), exchange.ErrUnsupportedKlineInterval, interval)
+	}
+
+	return exchange.FetchKlinePages(from, to, interval, klineLimit, func(from, to time.Time) ([]exchange.Kline, error) {
+		return b.fetchKlinePage(ctx, symbol, okxInterval, from, to)
+	})
+}
+
+// Fetches the klines starting within [from, to], which must hold at most klineLimit klines
+func (b *OkxAdapter) fetchKlinePage(ctx context.Context, symbol exchange.SymbolPair, okxInterval string, from, to time.Time) ([]exchange.Kline, error) {
+	endpoints := cmd.GetConfig().Exchange(registryName, defaultEndpoints)
+	query := url.Values{}
+	query.Set("instId", symbolToInstId(symbol))
+	query.Set("bar", okxInterval)
+	// after and before are exclusive, and paginate from the newest kline
+	query.Set("after", strconv.FormatInt(to.UnixMilli()+1, 10))
+	query.Set("before", strconv.FormatInt(from.UnixMilli()-1, 10))
+	query.Set("limit", strconv.Itoa(klineLimit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.RestURL+"/api/v5/market/history-candles?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := exchange.KlineClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("okx failed to fetch klines: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("okx failed to fetch klines: status %d", res.StatusCode)
+	}
+
+	var kr okxKlineResponse
+	if err := json.NewDecoder(res.Body).Decode(&kr); err != nil {
+		return nil, fmt.Errorf("okx failed to unmarshal klines: %w", err)
+	}
+	if kr.Code != "0" {
+		return nil, fmt.Errorf("okx failed to fetch klines: %s", kr.Msg)
+	}
+
+	klines := make([]exchange.Kline, 0, len(kr.Data))
+	for _, row := range kr.Data {
+		kline, err := b.klineRowToDomainKline(symbol, row)
+		if err != nil {
+			return nil, err
+		}
+		if kline.Start.Before(from) || kline.Start.After(to) {
+			continue
+		}
+		klines = append(klines, kline)
+	}
+
+	// OKX returns the newest kline first
+	slices.SortFunc(klines, func(a, b exchange.Kline) int {
+		return a.Start.Compare(b.Start)
+	})
+	return klines, nil
+}
+
+func (b *OkxAdapter) klineRowToDomainKline(symbol exchange.SymbolPair, row []string) (exchange.Kline, error) {
+	if len(row) < 6 {
+		return exchange.Kline{}, fmt.Errorf("okx failed to unmarshal kline: expected at least 6 fields, got %d", len(row))
+	}
+
+	start, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return exchange.Kline{}, fmt.Errorf("okx failed to unmarshal kline: %w", err)
+	}
+	// The volume of swaps is in contracts, and their volume in the base asset follows it
+	fields := row[1:6]
+	if symbol.Market == exchange.MarketPerp {
+		if len(row) < 7 {
+			return exchange.Kline{}, fmt.Errorf("okx failed to unmarshal kline: expected at least 7 fields, got %d", len(row))
+		}
+		fields = append(slices.Clone(row[1:5]), row[6])
+	}
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("okx failed to unmarshal kline: %w", err)
+		}
+		values[i] = value
+	}
+
+	return exchange.Kline{
+		Symbol: symbol.Key(),
+		Start:  time.UnixMilli(start),
+		Open:   values[0],
+		High:   values[1],
+		Low:    values[2],
+		Close:  values[3],
+		Volume: values[4],
+		Source: b.Name(),
+	}, nil
+}
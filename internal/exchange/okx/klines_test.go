@@ -0,0 +1,102 @@
+package okx
+
+import (
+	"context"
+	"fmt"
+	"hermeneutic-candles/internal/exchange"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOkxAdapter_FetchKlines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/market/history-candles" {
+			t.Errorf("Expected path /api/v5/market/history-candles, got %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("instId") != "BTC-USDT" || query.Get("bar") != "1m" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if query.Get("after") != "1753445820001" || query.Get("before") != "1753445759999" {
+			t.Errorf("Unexpected range after %s before %s", query.Get("after"), query.Get("before"))
+		}
+		// Newest kline first
+		w.Write([]byte(`{
+			"code": "0",
+			"msg": "",
+			"data": [
+				["1753445820000", "116450", "116460", "116420", "116430", "3.25", "378400.5", "378400.5", "1"],
+				["1753445760000", "116489.45", "116500", "116400.1", "116450", "12.5", "1456000.1", "1456000.1", "1"]
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	setRestURL(t, server.URL)
+
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(
+		context.Background(),
+		exchange.SymbolPair{First: "btc", Second: "usdt"},
+		time.Minute,
+		time.UnixMilli(1753445760000),
+		time.UnixMilli(1753445820000),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(klines) != 2 {
+		t.Fatalf("Expected 2 klines, got %d", len(klines))
+	}
+	if klines[0].Start.UnixMilli() != 1753445760000 || klines[1].Start.UnixMilli() != 1753445820000 {
+		t.Errorf("Expected klines ordered by start time, got %d and %d", klines[0].Start.UnixMilli(), klines[1].Start.UnixMilli())
+	}
+	if klines[0].Symbol != "btcusdt" || klines[0].Source != "Okx" {
+		t.Errorf("Expected btcusdt from Okx, got %s from %s", klines[0].Symbol, klines[0].Source)
+	}
+	if klines[0].Open != 116489.45 || klines[0].High != 116500 || klines[0].Low != 116400.1 || klines[0].Close != 116450 || klines[0].Volume != 12.5 {
+		t.Errorf("Unexpected kline values %v", klines[0])
+	}
+}
+
+func TestOkxAdapter_FetchKlines_Pages(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+		before, _ := strconv.ParseInt(r.URL.Query().Get("before"), 10, 64)
+		if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); (after-before-2)/60000+1 > int64(limit) {
+			t.Errorf("Expected at most %d klines in the page after %d before %d", limit, after, before)
+		}
+		// Newest kline first
+		var rows []string
+		for start := after - 1; start > before; start -= 60000 {
+			rows = append(rows, fmt.Sprintf(`["%d", "1", "1", "1", "1", "1", "1", "1", "1"]`, start))
+		}
+		fmt.Fprintf(w, `{"code": "0", "msg": "", "data": [%s]}`, strings.Join(rows, ","))
+	}))
+	defer server.Close()
+
+	setRestURL(t, server.URL)
+
+	// 150 klines span two pages, and the oldest ones are fetched too
+	from := time.UnixMilli(1753445760000)
+	adapter := NewAdapter(make(chan exchange.Trade, 1))
+	klines, err := adapter.FetchKlines(context.Background(), exchange.SymbolPair{First: "btc", Second: "usdt"}, time.Minute, from, from.Add(149*time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requests != 2 || len(klines) != 150 {
+		t.Fatalf("Expected 150 klines in 2 requests, got %d klines in %d requests", len(klines), requests)
+	}
+	for i, kline := range klines {
+		if !kline.Start.Equal(from.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("Expected kline %d at %v, got %v", i, from.Add(time.Duration(i)*time.Minute), kline.Start)
+		}
+	}
+}
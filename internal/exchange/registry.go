@@ -0,0 +1,49 @@
+package exchange
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Creates an adapter that writes trades to tradeChannel
+type AdapterFactory func(tradeChannel chan<- Trade) ExchangeAdapter
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]AdapterFactory{}
+)
+
+// Registers the factory of an exchange adapter by name
+//
+// Adapters register themselves from an init function, so importing their package makes them available.
+// Names are case-insensitive. Panics if the name is already registered
+func Register(name string, factory AdapterFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	key := strings.ToLower(name)
+	if _, ok := registry[key]; ok {
+		panic(fmt.Sprintf("exchange %s is already registered", name))
+	}
+	registry[key] = factory
+}
+
+// Returns the factory of the exchange adapter registered with the given name, matched case-insensitively
+func Lookup(name string) (AdapterFactory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factory, ok := registry[strings.ToLower(name)]
+	return factory, ok
+}
+
+// Returns the sorted names of the registered exchange adapters
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return slices.Sorted(maps.Keys(registry))
+}
@@ -0,0 +1,34 @@
+package exchange
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	Register("Registry-Test", func(tradeChannel chan<- Trade) ExchangeAdapter {
+		return nil
+	})
+
+	if _, ok := Lookup("registry-test"); !ok {
+		t.Errorf("Expected registry-test to be registered")
+	}
+	if _, ok := Lookup("REGISTRY-TEST"); !ok {
+		t.Errorf("Expected lookup to be case-insensitive")
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Errorf("Expected unknown to not be registered")
+	}
+	if !slices.Contains(Registered(), "registry-test") {
+		t.Errorf("Expected registered names to contain registry-test, got %v", Registered())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a duplicate name to panic")
+		}
+	}()
+	Register("registry-test", func(tradeChannel chan<- Trade) ExchangeAdapter {
+		return nil
+	})
+}
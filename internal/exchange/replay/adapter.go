@@ -0,0 +1,154 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/tape"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReplayAdapter streams the records a Source plays for an exchange
+//
+// Frames are parsed by the live adapter of the exchange, which never connects, and normalized trades are sent as recorded.
+// Every trade holds the virtual clock of the Source until the hub queued it to its subscribers, see clock.Receiver.
+// The Source plays the recorded trades of OKX swaps instead of their frames, see tradeStreams
+type ReplayAdapter struct {
+	source       *Source
+	live         exchange.ExchangeAdapter
+	tradeChannel chan<- exchange.Trade
+	// Trades the live adapter parsed from the current frame
+	parsed      chan exchange.Trade
+	pongChannel chan time.Time
+	market      exchange.Market
+	connection  *connection
+	conn        *websocket.Conn
+}
+
+// Creates a ReplayAdapter of the exchange of the live adapters created by newLive
+func NewAdapter(source *Source, newLive exchange.AdapterFactory, tradeChannel chan<- exchange.Trade) *ReplayAdapter {
+	parsed := make(chan exchange.Trade, 100)
+	return &ReplayAdapter{
+		source:       source,
+		live:         newLive(parsed),
+		tradeChannel: tradeChannel,
+		parsed:       parsed,
+		pongChannel:  make(chan time.Time, 1),
+	}
+}
+
+func (b *ReplayAdapter) Name() string {
+	return b.live.Name()
+}
+
+func (b *ReplayAdapter) GetPongChan() <-chan time.Time {
+	return b.pongChannel
+}
+
+// The markets of the live adapter are replayed
+func (b *ReplayAdapter) Markets() []exchange.Market {
+	if marketAdapter, ok := b.live.(exchange.MarketAdapter); ok {
+		return marketAdapter.Markets()
+	}
+	return nil
+}
+
+func (b *ReplayAdapter) SetMarket(market exchange.Market) {
+	b.market = market
+	if marketAdapter, ok := b.live.(exchange.MarketAdapter); ok {
+		marketAdapter.SetMarket(market)
+	}
+}
+
+// Connects to the Source, which plays the records of the exchange and market from then on
+func (b *ReplayAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
+	connection, c, err := b.source.connect(b.Name(), b.market)
+	if err != nil {
+		return nil, err
+	}
+	b.connection, b.conn = connection, c
+
+	c.SetPongHandler(func(string) error {
+		select {
+		case b.pongChannel <- time.Now():
+		default:
+		}
+		return nil
+	})
+	return c, nil
+}
+
+// The tape holds the records of every recorded symbol, the hub drops the trades of the symbols without subscribers
+func (b *ReplayAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return nil
+}
+
+func (b *ReplayAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return nil
+}
+
+// Sends the trades of the record, and signals the Source once they are sent
+func (b *ReplayAdapter) HandleMessage(message []byte) error {
+	defer b.handled()
+
+	var record tape.Record
+	if err := json.Unmarshal(message, &record); err != nil {
+		return fmt.Errorf("replay failed to unmarshal record: %w", err)
+	}
+	if record.Trade != nil {
+		b.send(*record.Trade)
+		return nil
+	}
+	return b.parse([]byte(record.Frame))
+}
+
+// Parses the frame with the live adapter, sending its trades as they are parsed,
+// so a frame with more trades than the buffer does not block the live adapter.
+// The pongs of recorded pong frames are discarded, as the live adapter never pinged
+func (b *ReplayAdapter) parse(frame []byte) error {
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err = b.live.HandleMessage(frame)
+	}()
+
+	for {
+		select {
+		case trade := <-b.parsed:
+			b.send(trade)
+		case <-b.live.GetPongChan():
+		case <-done:
+			for {
+				select {
+				case trade := <-b.parsed:
+					b.send(trade)
+				default:
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Holds the virtual clock for the trade until the hub queued it
+func (b *ReplayAdapter) send(trade exchange.Trade) {
+	b.source.clock.Hold(1)
+	b.tradeChannel <- trade
+}
+
+func (b *ReplayAdapter) handled() {
+	select {
+	case b.connection.handled <- struct{}{}:
+	default:
+	}
+}
+
+func (b *ReplayAdapter) Ping() error {
+	if b.conn == nil {
+		return fmt.Errorf("tried to ping without a valid connection")
+	}
+	return b.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+}
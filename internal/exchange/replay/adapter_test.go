@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	_ "hermeneutic-candles/internal/exchange/all"
+	"hermeneutic-candles/internal/tape"
+	"testing"
+	"time"
+)
+
+func TestReplayAdapter_HandleMessage(t *testing.T) {
+	received := time.UnixMilli(1753453611045)
+	source := &Source{clock: clock.NewVirtual(received)}
+	bybit, _ := exchange.Lookup("bybit")
+	tradeChannel := make(chan exchange.Trade, 10)
+	adapter := NewAdapter(source, bybit, tradeChannel)
+	adapter.connection = &connection{handled: make(chan struct{}, 1)}
+
+	records := []tape.Record{
+		// Pongs of the live connection are recorded, and must not block the live adapter that never pinged
+		{Received: received, Exchange: "Bybit", Frame: `{"op":"ping","success":true}`},
+		{Received: received, Exchange: "Bybit", Frame: `{"op":"ping","success":true}`},
+		{Received: received, Exchange: "Bybit", Frame: `{"topic":"publicTrade.BTCUSDT","data":[` +
+			`{"s":"BTCUSDT","S":"Buy","p":"100","v":"1","T":1753453611000},{"s":"BTCUSDT","S":"Sell","p":"101","v":"2","T":1753453611001}]}`},
+		{Received: received, Exchange: "Bybit", Trade: &exchange.Trade{Symbol: "ethusdt", Price: 10, Quantity: 3, Timestamp: received, Source: "Bybit"}},
+	}
+	for _, record := range records {
+		message, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("Failed to encode record: %v", err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- adapter.HandleMessage(message) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("HandleMessage blocked on %s", record.Frame)
+		}
+		select {
+		case <-adapter.connection.handled:
+		default:
+			t.Errorf("Expected the record to be signaled as handled")
+		}
+	}
+
+	// Every trade holds the clock until it is released
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := source.clock.Wait(ctx); err == nil {
+		t.Errorf("Expected the trades to hold the clock")
+	}
+
+	var symbols []string
+	for len(tradeChannel) > 0 {
+		trade := <-tradeChannel
+		symbols = append(symbols, trade.Symbol)
+		source.clock.Release()
+	}
+	if len(symbols) != 3 || symbols[0] != "btcusdt" || symbols[2] != "ethusdt" {
+		t.Errorf("Expected the parsed trades then the recorded trade, got %v", symbols)
+	}
+	if err := source.clock.Wait(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
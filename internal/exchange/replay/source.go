@@ -0,0 +1,378 @@
+// Replays a trade tape in place of the live exchanges
+//
+// A Source plays the records of a tape recorded by tape.Recorder over local websocket connections,
+// to ReplayAdapters wrapping the adapters of the recorded exchanges. The candle pipeline runs on the
+// Source's virtual clock, which follows the time the records were received
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/tape"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Options of a Source
+type Options struct {
+	// Directory of the tape files
+	Dir string
+	// Playback speed relative to the time the records were received, e.g. 1 plays in real time and 10 ten times faster.
+	// Zero plays as fast as the candle pipeline processes the records
+	Speed float64
+	// Replays the normalized trades of the tape instead of parsing its frames with the adapters of the exchanges
+	Trades bool
+	// Time the virtual clock keeps advancing after the last record, so the last candles close and become final
+	Tail time.Duration
+}
+
+// Source plays a trade tape to the ReplayAdapters connected to it
+//
+// Playback starts once the first adapter connects, i.e. on the first subscription, and each record is played
+// to the connection of its exchange and market. Records of connections that are not open are skipped.
+// Before each record the virtual clock advances to the time it was received, stopping at every timer on the way,
+// and waits for the pipeline to process the events of the previous record, see clock.Virtual
+type Source struct {
+	opts   Options
+	reader *tape.Reader
+	// First record of the tape, read to start the clock
+	first  tape.Record
+	clock  *clock.Virtual
+	server *http.Server
+	addr   string
+
+	mu     sync.Mutex
+	nextID int
+	// ID -> connection an adapter is dialing
+	dialing map[int]*connection
+	// Connections the records are played to
+	conns map[streamKey]*connection
+	// Closed once the first connection is open
+	started   chan struct{}
+	startOnce sync.Once
+	// Streams of tradeStreams whose frames were skipped, warned about once
+	skipped map[streamKey]bool
+}
+
+type streamKey struct {
+	// Lowercase name of the exchange
+	exchange string
+	market   exchange.Market
+}
+
+// Streams whose frames cannot be parsed without connecting, so their recorded trades are replayed instead of their frames.
+// OKX swaps are sized in contracts, whose values are fetched on connect
+var tradeStreams = map[streamKey]bool{
+	{exchange: "okx", market: exchange.MarketPerp}: true,
+}
+
+// Connection of an adapter to the Source
+type connection struct {
+	key  streamKey
+	conn *websocket.Conn
+	// Closed once the Source accepted the connection
+	ready chan struct{}
+	// Signaled by the adapter once it handled a record
+	handled chan struct{}
+	// Closed once the connection is closed
+	closed chan struct{}
+}
+
+// Time to wait for the Source to accept the connection of an adapter
+const connectTimeout = 10 * time.Second
+
+// Opens the tape and starts serving the connections of the adapters on a local port
+func NewSource(opts Options) (*Source, error) {
+	reader, err := tape.NewReader(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{opts: opts, reader: reader, dialing: map[int]*connection{}, conns: map[streamKey]*connection{}, started: make(chan struct{}), skipped: map[streamKey]bool{}}
+
+	s.first, err = s.next()
+	if err != nil {
+		reader.Close()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no records to replay in %s", opts.Dir)
+		}
+		return nil, err
+	}
+	s.clock = clock.NewVirtual(s.first.Received)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	s.addr = listener.Addr().String()
+	s.server = &http.Server{Handler: http.HandlerFunc(s.accept)}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Returns the virtual clock the candle pipeline must run on
+func (s *Source) Clock() *clock.Virtual {
+	return s.clock
+}
+
+// Returns the factory of a ReplayAdapter of the exchange registered with the given name, matched case-insensitively
+//
+// The frames of the tape are parsed by an adapter of the registered exchange. Matches exchange.Lookup
+func (s *Source) Lookup(name string) (exchange.AdapterFactory, bool) {
+	live, ok := exchange.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewAdapter(s, live, tradeChannel)
+	}, true
+}
+
+// Plays the tape until its end, or until ctx is done
+func (s *Source) Run(ctx context.Context) error {
+	select {
+	case <-s.started:
+	case <-ctx.Done():
+		return nil
+	}
+	slog.Info("Replaying trade tape", "dir", s.opts.Dir, "from", s.first.Received, "speed", s.opts.Speed, "trades", s.opts.Trades)
+
+	record, played := s.first, 0
+	for {
+		if err := s.advance(ctx, record.Received); err != nil {
+			return nil
+		}
+		if s.play(ctx, record) {
+			played++
+		}
+
+		next, err := s.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		record = next
+	}
+
+	if err := s.advance(ctx, s.clock.Now().Add(s.opts.Tail)); err != nil {
+		return nil
+	}
+	slog.Info("Replayed trade tape", "dir", s.opts.Dir, "records", played, "until", s.clock.Now())
+	return nil
+}
+
+// Returns the next record of the kind replayed
+// When replaying frames, the trades of tradeStreams are replayed instead of their frames
+func (s *Source) next() (tape.Record, error) {
+	for {
+		record, err := s.reader.Next()
+		if err != nil {
+			return tape.Record{}, err
+		}
+		if s.opts.Trades {
+			if record.Trade != nil {
+				return record, nil
+			}
+			continue
+		}
+
+		key := recordKey(record)
+		if !tradeStreams[key] {
+			if record.Trade == nil {
+				return record, nil
+			}
+			continue
+		}
+		if record.Trade != nil {
+			return record, nil
+		}
+		if !s.skipped[key] {
+			s.skipped[key] = true
+			slog.Warn("Skipping frames that cannot be parsed offline, only the recorded trades of their stream are replayed",
+				"exchange", record.Exchange, "market", key.market.String())
+		}
+	}
+}
+
+// Returns the stream of the exchange and market the record is played to
+func recordKey(record tape.Record) streamKey {
+	key := streamKey{exchange: strings.ToLower(record.Exchange), market: record.Market}
+	if record.Trade != nil {
+		// The market of a trade is the suffix of its symbol, see exchange.MarketKey
+		_, market, _ := strings.Cut(record.Trade.Symbol, ":")
+		key.market = exchange.Market(market)
+	}
+	return key
+}
+
+// Advances the clock to t, stopping at the deadline of every timer on the way
+//
+// The pipeline processes the events of each step before the next one, so a timer rearmed by its receiver
+// fires again within the same advance if it is due before t
+func (s *Source) advance(ctx context.Context, t time.Time) error {
+	for {
+		if err := s.clock.Wait(ctx); err != nil {
+			return err
+		}
+		next, ok := s.clock.Next()
+		if !ok || next.After(t) {
+			break
+		}
+		if err := s.pace(ctx, next); err != nil {
+			return err
+		}
+		s.clock.AdvanceTo(next)
+	}
+
+	if err := s.pace(ctx, t); err != nil {
+		return err
+	}
+	s.clock.AdvanceTo(t)
+	return s.clock.Wait(ctx)
+}
+
+// Sleeps for the time until t scaled by the playback speed
+func (s *Source) pace(ctx context.Context, t time.Time) error {
+	if s.opts.Speed <= 0 {
+		return nil
+	}
+	delay := time.Duration(float64(t.Sub(s.clock.Now())) / s.opts.Speed)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Plays the record to the connection of its exchange and market, and waits until the adapter handled it
+// Returns false if the connection is not open
+func (s *Source) play(ctx context.Context, record tape.Record) bool {
+	key := recordKey(record)
+
+	s.mu.Lock()
+	c := s.conns[key]
+	s.mu.Unlock()
+	if c == nil {
+		return false
+	}
+
+	message, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("Failed to encode replayed record", "exchange", record.Exchange, "error", err)
+		return false
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		slog.Warn("Failed to replay record, skipping", "exchange", record.Exchange, "market", key.market.String(), "error", err)
+		return false
+	}
+
+	select {
+	case <-c.handled:
+	case <-c.closed:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// Registers a connection of an adapter of the exchange and market, and dials it
+// Returns once the Source accepted the connection, so the next record is played to it
+func (s *Source) connect(name string, market exchange.Market) (*connection, *websocket.Conn, error) {
+	c := &connection{
+		key:     streamKey{exchange: strings.ToLower(name), market: market},
+		ready:   make(chan struct{}),
+		handled: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.dialing[id] = c
+	s.mu.Unlock()
+
+	u := url.URL{Scheme: "ws", Host: s.addr, Path: "/", RawQuery: url.Values{"id": {strconv.Itoa(id)}}.Encode()}
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.dialing, id)
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+
+	select {
+	case <-c.ready:
+		return c, ws, nil
+	case <-time.After(connectTimeout):
+		ws.Close()
+		return nil, nil, fmt.Errorf("replay source did not accept the connection within %s", connectTimeout)
+	}
+}
+
+// Accepts the connection of an adapter, and plays the records of its exchange and market to it until it is closed
+func (s *Source) accept(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	s.mu.Lock()
+	c, ok := s.dialing[id]
+	delete(s.dialing, id)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusNotFound)
+		return
+	}
+
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	c.conn = conn
+
+	s.mu.Lock()
+	s.conns[c.key] = c
+	s.mu.Unlock()
+	close(c.ready)
+	s.startOnce.Do(func() { close(s.started) })
+
+	// Reading answers the pings of the adapter, until it closes the connection
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	if s.conns[c.key] == c {
+		delete(s.conns, c.key)
+	}
+	s.mu.Unlock()
+	close(c.closed)
+}
+
+// Stops serving the adapters and closes the tape
+func (s *Source) Close() {
+	s.server.Close()
+	s.reader.Close()
+}
@@ -0,0 +1,62 @@
+package replay
+
+import (
+	"errors"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/tape"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSource_Next(t *testing.T) {
+	dir := t.TempDir()
+	recorder := tape.NewRecorder(tape.Options{Dir: dir, MaxFileSize: 1 << 20, MaxFileAge: time.Hour, DiskBudget: 1 << 20, Frames: true, Trades: true})
+	received := time.UnixMilli(1753453611045)
+	recorder.RecordFrame("Binance", exchange.MarketSpot, received, []byte(`{"e":"trade"}`))
+	recorder.RecordTrade(received, exchange.Trade{Symbol: "btcusdt", Price: 100, Quantity: 1, Timestamp: received, Source: "Binance"})
+	recorder.RecordFrame("OKX", exchange.MarketPerp, received, []byte(`{"arg":{"channel":"trades"}}`))
+	recorder.RecordTrade(received, exchange.Trade{Symbol: "btcusdt:perp", Price: 101, Quantity: 2, Timestamp: received, Source: "OKX"})
+	recorder.RecordFrame("OKX", exchange.MarketSpot, received, []byte(`{"arg":{"channel":"trades"}}`))
+	recorder.RecordTrade(received, exchange.Trade{Symbol: "btcusdt", Price: 102, Quantity: 3, Timestamp: received, Source: "OKX"})
+	recorder.Close()
+
+	tests := []struct {
+		name   string
+		trades bool
+		// Exchange and kind of the replayed records
+		expected []string
+	}{
+		// The frames of OKX swaps are sized in contracts, so their trades are replayed instead
+		{"frames", false, []string{"Binance frame", "OKX trade", "OKX frame"}},
+		{"trades", true, []string{"Binance trade", "OKX trade", "OKX trade"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(Options{Dir: dir, Trades: tt.trades})
+			if err != nil {
+				t.Fatalf("Failed to open source: %v", err)
+			}
+			defer source.Close()
+
+			var replayed []string
+			for record, err := source.first, error(nil); ; record, err = source.next() {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				kind := "frame"
+				if record.Trade != nil {
+					kind = "trade"
+				}
+				replayed = append(replayed, record.Exchange+" "+kind)
+			}
+			if !slices.Equal(replayed, tt.expected) {
+				t.Errorf("Expected records %v, got %v", tt.expected, replayed)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Health and readiness checks of the server
+//
+// The server is healthy as long as it is serving, and ready once enough exchanges are connected and delivering trades
+package health
+
+import (
+	"context"
+	"fmt"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/tradestreamer"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+// Rules the exchange connections must satisfy for the server to be ready
+type Rules struct {
+	// Minimum number of live exchanges
+	MinExchanges int
+	// Maximum time since the last trade of a live exchange
+	MaxTradeAge time.Duration
+}
+
+// Checker reports readiness over gRPC health checks and HTTP
+type Checker struct {
+	rules  Rules
+	status func() []tradestreamer.Status
+	// Clock of the exchange connections, which the trade times are read on
+	clock    clock.Clock
+	services []string
+}
+
+// Creates a new Checker
+//
+// status returns the liveness of the exchange connections, which is checked at the time of c,
+// and services lists the gRPC services reported by Check
+func NewChecker(rules Rules, status func() []tradestreamer.Status, c clock.Clock, services ...string) *Checker {
+	return &Checker{
+		rules:    rules,
+		status:   status,
+		clock:    c,
+		services: services,
+	}
+}
+
+// Returns an error describing the unmet rule if the server is not ready at now
+//
+// An exchange is live when it is connected and its last trade is within the maximum trade age.
+// Heartbeats and pongs keep a connection open without trades, so they do not count
+func (c *Checker) Ready(now time.Time) error {
+	var live, notLive []string
+	for _, status := range c.status() {
+		if status.Connected && !status.LastTrade.IsZero() && now.Sub(status.LastTrade) <= c.rules.MaxTradeAge {
+			live = append(live, status.Exchange)
+		} else {
+			notLive = append(notLive, status.Exchange)
+		}
+	}
+
+	if len(live) < c.rules.MinExchanges {
+		return fmt.Errorf(
+			"%d exchanges are live, at least %d required. Not live: %s",
+			len(live), c.rules.MinExchanges, strings.Join(notLive, ", "),
+		)
+	}
+	return nil
+}
+
+// Implements grpchealth.Checker
+//
+// An empty service checks the server as a whole
+func (c *Checker) Check(_ context.Context, req *grpchealth.CheckRequest) (*grpchealth.CheckResponse, error) {
+	if req.Service != "" && !slices.Contains(c.services, req.Service) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service %s", req.Service))
+	}
+	if c.Ready(c.clock.Now()) != nil {
+		return &grpchealth.CheckResponse{Status: grpchealth.StatusNotServing}, nil
+	}
+	return &grpchealth.CheckResponse{Status: grpchealth.StatusServing}, nil
+}
+
+// Responds OK as long as the server is serving
+func (c *Checker) HandleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// Responds OK when the server is ready, and Service Unavailable with the unmet rule otherwise
+func (c *Checker) HandleReadyz(w http.ResponseWriter, _ *http.Request) {
+	if err := c.Ready(c.clock.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/tradestreamer"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+func TestChecker_Ready(t *testing.T) {
+	now := time.UnixMilli(1753590000000)
+	rules := Rules{MinExchanges: 2, MaxTradeAge: 30 * time.Second}
+
+	tests := []struct {
+		name     string
+		statuses []tradestreamer.Status
+		ready    bool
+	}{
+		{
+			name: "enough live exchanges",
+			statuses: []tradestreamer.Status{
+				{Exchange: "Binance", Connected: true, LastTrade: now.Add(-time.Second)},
+				{Exchange: "Bybit", Connected: true, LastTrade: now.Add(-30 * time.Second)},
+				{Exchange: "Okx", Connected: false},
+			},
+			ready: true,
+		},
+		{
+			name: "disconnected exchange is not live",
+			statuses: []tradestreamer.Status{
+				{Exchange: "Binance", Connected: true, LastTrade: now.Add(-time.Second)},
+				{Exchange: "Bybit", Connected: false, LastTrade: now.Add(-time.Second)},
+			},
+			ready: false,
+		},
+		{
+			name: "exchange without recent trades is not live",
+			statuses: []tradestreamer.Status{
+				{Exchange: "Binance", Connected: true, LastTrade: now.Add(-time.Second)},
+				{Exchange: "Bybit", Connected: true, LastTrade: now.Add(-31 * time.Second)},
+			},
+			ready: false,
+		},
+		{
+			name: "exchange without trades is not live",
+			statuses: []tradestreamer.Status{
+				{Exchange: "Binance", Connected: true, LastTrade: now.Add(-time.Second)},
+				{Exchange: "Bybit", Connected: true},
+			},
+			ready: false,
+		},
+		{
+			name: "heartbeats without trades are not live",
+			statuses: []tradestreamer.Status{
+				{Exchange: "Binance", Connected: true, LastTrade: now.Add(-time.Second)},
+				{Exchange: "Bybit", Connected: true, LastMessage: now, LastTrade: now.Add(-time.Minute)},
+			},
+			ready: false,
+		},
+		{
+			name:     "no exchanges",
+			statuses: nil,
+			ready:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(rules, func() []tradestreamer.Status { return tt.statuses }, clock.Real())
+
+			err := checker.Ready(now)
+			if tt.ready && err != nil {
+				t.Errorf("Expected ready, got %v", err)
+			}
+			if !tt.ready && err == nil {
+				t.Errorf("Expected not ready")
+			}
+		})
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	// Trades are timed on the clock of a replayed tape, far from the wall clock
+	ready := false
+	replayClock := fakeclock.New(time.UnixMilli(1700000000000))
+	lastTrade := replayClock.Now()
+	checker := NewChecker(Rules{MinExchanges: 1, MaxTradeAge: time.Minute}, func() []tradestreamer.Status {
+		return []tradestreamer.Status{{Exchange: "Binance", Connected: ready, LastTrade: lastTrade}}
+	}, replayClock, "proto.candles.v1.CandlesService")
+
+	res, err := checker.Check(context.Background(), &grpchealth.CheckRequest{})
+	if err != nil || res.Status != grpchealth.StatusNotServing {
+		t.Errorf("Expected not serving, got %v, %v", res, err)
+	}
+
+	ready = true
+	res, err = checker.Check(context.Background(), &grpchealth.CheckRequest{Service: "proto.candles.v1.CandlesService"})
+	if err != nil || res.Status != grpchealth.StatusServing {
+		t.Errorf("Expected serving, got %v, %v", res, err)
+	}
+
+	replayClock.Advance(2 * time.Minute)
+	res, err = checker.Check(context.Background(), &grpchealth.CheckRequest{})
+	if err != nil || res.Status != grpchealth.StatusNotServing {
+		t.Errorf("Expected not serving once the last trade is older than the maximum age, got %v, %v", res, err)
+	}
+
+	_, err = checker.Check(context.Background(), &grpchealth.CheckRequest{Service: "unknown"})
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeNotFound {
+		t.Errorf("Expected NotFound error, got %v", err)
+	}
+}
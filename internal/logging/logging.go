@@ -0,0 +1,30 @@
+// Structured JSON logging with log/slog
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Sets the default slog logger to write JSON lines to stdout at the given level
+//
+// level is one of debug, info, warn or error. The standard log package writes through the same handler
+func Setup(level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: l})))
+	return nil
+}
+
+// Returns a random ID to correlate the log lines of a client stream
+func NewStreamID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
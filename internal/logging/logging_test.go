@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	defer slog.SetDefault(defaultLogger)
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    slog.Level
+		shouldError bool
+	}{
+		{name: "debug", input: "debug", expected: slog.LevelDebug},
+		{name: "case-insensitive", input: "WARN", expected: slog.LevelWarn},
+		{name: "error", input: "error", expected: slog.LevelError},
+		{name: "invalid level", input: "verbose", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup(tt.input)
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			handler := slog.Default().Handler()
+			if !handler.Enabled(context.Background(), tt.expected) || handler.Enabled(context.Background(), tt.expected-1) {
+				t.Errorf("Expected level %v to be the minimum enabled level", tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewStreamID(t *testing.T) {
+	a, b := NewStreamID(), NewStreamID()
+	if len(a) != 16 {
+		t.Errorf("Expected 16 hex characters, got %q", a)
+	}
+	if a == b {
+		t.Errorf("Expected unique stream IDs, got %q twice", a)
+	}
+}
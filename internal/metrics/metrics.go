@@ -0,0 +1,90 @@
+// Prometheus metrics of the exchange connections and client streams
+//
+// The metrics are registered in the default registry, and served by promhttp.Handler
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "candles"
+
+// Reasons a trade is dropped before it is added to a candle
+const (
+	// The subscriber's trade buffer was full
+	DropReasonBufferFull = "buffer_full"
+	// The stream reached MAX_TRADES_PER_INTERVAL
+	DropReasonMaxTrades = "max_trades"
+	// The trade arrived after its candle was final
+	DropReasonLate = "late"
+)
+
+var (
+	TradesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trades_received_total",
+		Help:      "Trades received from the exchanges",
+	}, []string{"exchange", "symbol"})
+
+	MessageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exchange_message_errors_total",
+		Help:      "Exchange messages the adapters failed to handle",
+	}, []string{"exchange"})
+
+	ReconnectAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exchange_reconnect_attempts_total",
+		Help:      "Attempts to reconnect to the exchanges",
+	}, []string{"exchange"})
+
+	CircuitOpens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exchange_circuit_opens_total",
+		Help:      "Times the reconnect circuit of an exchange connection opened after failing to connect repeatedly",
+	}, []string{"exchange"})
+
+	ExchangeConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "exchange_connections",
+		Help:      "Connections currently open to the exchanges, one per shard of a market's symbols",
+	}, []string{"exchange"})
+
+	PongTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exchange_pong_timeouts_total",
+		Help:      "Pings the exchanges did not answer in time",
+	}, []string{"exchange"})
+
+	DroppedTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_trades_total",
+		Help:      "Trades dropped before they were added to a candle",
+	}, []string{"reason"})
+
+	ActiveStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Client streams currently open",
+	}, []string{"rpc"})
+
+	TapeRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tape_records_total",
+		Help:      "Frames and trades written to the trade tape",
+	}, []string{"kind"})
+
+	DroppedTapeRecords = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tape_dropped_records_total",
+		Help:      "Frames and trades dropped because the trade tape could not keep up",
+	})
+
+	CandleEmitLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "candle_emit_latency_seconds",
+		Help:      "Delay between the end of a candle's interval and the candle being sent to the client",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"final"})
+)
@@ -0,0 +1,111 @@
+package tape
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader reads the records of the tape files in a directory, oldest file first
+//
+// Records are read in the order they were written. A file still being written, or cut short by a crash,
+// is read up to its last flushed record
+type Reader struct {
+	files []string
+	file  *os.File
+	gz    *gzip.Reader
+	lines *bufio.Scanner
+}
+
+// Largest record a tape line may hold
+const maxRecordSize = 16 << 20
+
+// Creates a Reader of the tape files in dir
+// Returns an error if dir holds no tape files
+func NewReader(dir string) (*Reader, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no tape files in %s", dir)
+	}
+	return &Reader{files: files}, nil
+}
+
+// Returns the next record, or io.EOF after the last record of the last file
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.lines == nil {
+			if len(r.files) == 0 {
+				return Record{}, io.EOF
+			}
+			if err := r.open(r.files[0]); err != nil {
+				return Record{}, err
+			}
+			r.files = r.files[1:]
+		}
+
+		if r.lines.Scan() {
+			var record Record
+			if err := json.Unmarshal(r.lines.Bytes(), &record); err != nil {
+				return Record{}, fmt.Errorf("invalid record in %s: %w", r.file.Name(), err)
+			}
+			return record, nil
+		}
+
+		err := r.lines.Err()
+		name := r.file.Name()
+		r.closeFile()
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return Record{}, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+}
+
+func (r *Reader) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+
+	r.file, r.gz = file, gz
+	r.lines = bufio.NewScanner(gz)
+	r.lines.Buffer(nil, maxRecordSize)
+	r.lines.Split(scanRecords)
+	return nil
+}
+
+// Splits the lines of a tape file, dropping a last line without a newline, which is a partially written record
+func scanRecords(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
+
+func (r *Reader) closeFile() {
+	if r.file == nil {
+		return
+	}
+	r.gz.Close()
+	r.file.Close()
+	r.file, r.gz, r.lines = nil, nil, nil
+}
+
+// Closes the file being read
+func (r *Reader) Close() {
+	r.closeFile()
+}
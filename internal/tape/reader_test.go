@@ -0,0 +1,56 @@
+package tape
+
+import (
+	"errors"
+	"hermeneutic-candles/internal/exchange"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReader_Next(t *testing.T) {
+	dir := t.TempDir()
+	// Every record starts a new file
+	recorder := NewRecorder(Options{Dir: dir, MaxFileSize: 1, MaxFileAge: time.Hour, DiskBudget: 1 << 20, Frames: true, Trades: true})
+	received := time.UnixMilli(1753453611045).UTC()
+	recorder.RecordFrame("Binance", exchange.MarketSpot, received, []byte(`{"e":"trade"}`))
+	recorder.RecordTrade(received.Add(time.Millisecond), exchange.Trade{Symbol: "btcusdt:perp", Price: 100, Quantity: 1, Timestamp: received, Source: "Bybit"})
+	recorder.Close()
+
+	// A file cut short while it was written is read up to its last flushed record
+	files, err := Files(dir)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %v %v", files, err)
+	}
+	data, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", files[1], err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tape-99990101T000000.000000000Z.jsonl.gz"), data[:len(data)/2], 0o644); err != nil {
+		t.Fatalf("Failed to write truncated file: %v", err)
+	}
+
+	reader, err := NewReader(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	frame, err := reader.Next()
+	if err != nil || frame.Exchange != "Binance" || frame.Frame != `{"e":"trade"}` || !frame.Received.Equal(received) {
+		t.Errorf("Unexpected first record %+v %v", frame, err)
+	}
+	trade, err := reader.Next()
+	if err != nil || trade.Trade == nil || trade.Trade.Symbol != "btcusdt:perp" {
+		t.Errorf("Unexpected second record %+v %v", trade, err)
+	}
+	if record, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF after the last complete record, got %+v %v", record, err)
+	}
+
+	if _, err := NewReader(t.TempDir()); err == nil {
+		t.Errorf("Expected an error for a directory without tape files")
+	}
+}
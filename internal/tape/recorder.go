@@ -0,0 +1,357 @@
+// Trade tape of the frames received from the exchanges and the trades parsed from them
+//
+// The tape is written to rotating gzip-compressed JSON Lines files, one Record per line,
+// and the oldest files are deleted to stay within a disk budget
+package tape
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/metrics"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is a frame received from an exchange, or a trade parsed from the frames of an exchange
+type Record struct {
+	// Time the frame or trade was received
+	Received time.Time `json:"received"`
+	Exchange string    `json:"exchange"`
+	// Market of the connection the frame was received on. Empty for spot
+	Market exchange.Market `json:"market,omitempty"`
+	// Raw websocket frame. Empty for trades
+	Frame string `json:"frame,omitempty"`
+	// Normalized trade. Nil for frames
+	Trade *exchange.Trade `json:"trade,omitempty"`
+}
+
+// Options of a Recorder
+type Options struct {
+	// Directory of the tape files, created on the first record
+	Dir string
+	// Compressed size and age after which a file is closed and a new one is started
+	MaxFileSize int64
+	MaxFileAge  time.Duration
+	// Maximum total size of the tape files. The oldest files are deleted once it is exceeded
+	DiskBudget int64
+	// Record frames and trades from the start
+	Frames bool
+	Trades bool
+	// Clock the files are named, rotated and flushed on. Defaults to the wall clock
+	Clock clock.Clock
+}
+
+const (
+	filePrefix = "tape-"
+	fileSuffix = ".jsonl.gz"
+	// Sortable timestamp of the file names, so the oldest file sorts first
+	fileTimeFormat = "20060102T150405.000000000Z"
+	// Records buffered before they are dropped
+	bufferSize = 4096
+	// Interval at which buffered records are flushed to the current file
+	flushInterval = time.Second
+)
+
+// Recorder writes the tape in the background
+//
+// Recording of frames and trades is switched on and off at runtime with SetRecording, and the current file is closed
+// within a flush interval once both are off. Records are dropped instead of blocking the caller when the disk cannot keep up.
+// The methods of a nil Recorder do nothing
+type Recorder struct {
+	opts   Options
+	frames atomic.Bool
+	trades atomic.Bool
+
+	records  chan Record
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// Fields below are only accessed by the writer goroutine
+	file    *os.File
+	size    *countingWriter
+	gz      *gzip.Writer
+	encoder *json.Encoder
+	opened  time.Time
+	dirty   bool
+}
+
+// Creates a new Recorder and starts writing in the background until it is closed
+func NewRecorder(opts Options) *Recorder {
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	r := &Recorder{
+		opts:    opts,
+		records: make(chan Record, bufferSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.frames.Store(opts.Frames)
+	r.trades.Store(opts.Trades)
+	go r.run()
+	return r
+}
+
+// Switches the recording of frames and trades on or off
+func (r *Recorder) SetRecording(frames, trades bool) {
+	if r == nil {
+		return
+	}
+	r.frames.Store(frames)
+	r.trades.Store(trades)
+	slog.Info("Trade tape recording changed", "frames", frames, "trades", trades, "dir", r.opts.Dir)
+}
+
+// Returns whether frames and trades are recorded
+func (r *Recorder) Recording() (frames, trades bool) {
+	if r == nil {
+		return false, false
+	}
+	return r.frames.Load(), r.trades.Load()
+}
+
+// Records a frame received from the exchange, if frames are recorded
+func (r *Recorder) RecordFrame(exchangeName string, market exchange.Market, received time.Time, frame []byte) {
+	if r == nil || !r.frames.Load() {
+		return
+	}
+	r.record(Record{Received: received, Exchange: exchangeName, Market: market, Frame: string(frame)}, "frame")
+}
+
+// Records a trade parsed from the frames of its source, if trades are recorded
+func (r *Recorder) RecordTrade(received time.Time, trade exchange.Trade) {
+	if r == nil || !r.trades.Load() {
+		return
+	}
+	r.record(Record{Received: received, Exchange: trade.Source, Trade: &trade}, "trade")
+}
+
+func (r *Recorder) record(record Record, kind string) {
+	select {
+	case <-r.stop:
+		return
+	default:
+	}
+
+	select {
+	case r.records <- record:
+		metrics.TapeRecords.WithLabelValues(kind).Inc()
+	default:
+		metrics.DroppedTapeRecords.Inc()
+	}
+}
+
+// Stops recording, and writes the buffered records before closing the current file
+// Closing a closed Recorder does nothing
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// Writes the records until the Recorder is closed
+func (r *Recorder) run() {
+	defer close(r.done)
+	flushTimer := r.opts.Clock.NewTimer(flushInterval)
+	defer flushTimer.Stop()
+
+	for {
+		select {
+		case record := <-r.records:
+			r.write(record)
+		case <-flushTimer.C():
+			flushTimer.Reset(flushInterval)
+			if frames, trades := r.Recording(); !frames && !trades {
+				r.closeFile()
+			} else {
+				r.flush()
+			}
+		case <-r.stop:
+			for {
+				select {
+				case record := <-r.records:
+					r.write(record)
+				default:
+					r.closeFile()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Writes the record to the current file, rotating it once it is too large or too old
+func (r *Recorder) write(record Record) {
+	if r.file != nil && (r.size.n >= r.opts.MaxFileSize || r.opts.Clock.Now().Sub(r.opened) >= r.opts.MaxFileAge) {
+		r.closeFile()
+	}
+	if r.file == nil {
+		if err := r.openFile(); err != nil {
+			slog.Error("Failed to open trade tape file, dropping record", "dir", r.opts.Dir, "error", err)
+			metrics.DroppedTapeRecords.Inc()
+			return
+		}
+	}
+
+	if err := r.encoder.Encode(record); err != nil {
+		slog.Error("Failed to write trade tape record", "file", r.file.Name(), "error", err)
+		metrics.DroppedTapeRecords.Inc()
+		return
+	}
+	r.dirty = true
+}
+
+// Starts a new file, after deleting the oldest files that leave no room for it within the disk budget
+func (r *Recorder) openFile() error {
+	if err := os.MkdirAll(r.opts.Dir, 0o755); err != nil {
+		return err
+	}
+	if err := r.prune(r.opts.DiskBudget - r.opts.MaxFileSize); err != nil {
+		slog.Warn("Failed to delete old trade tape files", "dir", r.opts.Dir, "error", err)
+	}
+
+	now := r.opts.Clock.Now()
+	path := filepath.Join(r.opts.Dir, filePrefix+now.UTC().Format(fileTimeFormat)+fileSuffix)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	r.file, r.opened = file, now
+	r.size = &countingWriter{w: file}
+	r.gz = gzip.NewWriter(r.size)
+	r.encoder = json.NewEncoder(r.gz)
+	slog.Debug("Opened trade tape file", "file", path)
+	return nil
+}
+
+// Flushes the records written since the last flush, so the file can be read while it is written
+func (r *Recorder) flush() {
+	if r.file == nil || !r.dirty {
+		return
+	}
+	if err := r.gz.Flush(); err != nil {
+		slog.Error("Failed to flush trade tape file", "file", r.file.Name(), "error", err)
+	}
+	r.dirty = false
+}
+
+func (r *Recorder) closeFile() {
+	if r.file == nil {
+		return
+	}
+	if err := r.gz.Close(); err != nil {
+		slog.Error("Failed to write trade tape file", "file", r.file.Name(), "error", err)
+	}
+	if err := r.file.Close(); err != nil {
+		slog.Error("Failed to close trade tape file", "file", r.file.Name(), "error", err)
+	}
+	r.file, r.size, r.gz, r.encoder, r.dirty = nil, nil, nil, nil, false
+}
+
+// Deletes the oldest tape files until their total size is at most budget
+func (r *Recorder) prune(budget int64) error {
+	files, err := Files(r.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+
+	for i := 0; i < len(files) && total > max(budget, 0); i++ {
+		if err := os.Remove(files[i]); err != nil {
+			return err
+		}
+		total -= sizes[i]
+		slog.Info("Deleted trade tape file to stay within the disk budget", "file", files[i], "disk_budget", r.opts.DiskBudget)
+	}
+	return nil
+}
+
+// Returns the paths of the tape files in dir, oldest first
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), filePrefix) && strings.HasSuffix(entry.Name(), fileSuffix) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// Responds with whether frames and trades are recorded, and switches them with the frames and trades query parameters of a POST
+//
+// Ex: POST /tape?frames=true&trades=false
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		frames, trades := r.Recording()
+		var err error
+		if value := req.URL.Query().Get("frames"); value != "" {
+			if frames, err = strconv.ParseBool(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid frames: %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+		if value := req.URL.Query().Get("trades"); value != "" {
+			if trades, err = strconv.ParseBool(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid trades: %s", value), http.StatusBadRequest)
+				return
+			}
+		}
+		r.SetRecording(frames, trades)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	frames, trades := r.Recording()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"frames": frames, "trades": trades})
+}
+
+// Counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,174 @@
+package tape
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"hermeneutic-candles/internal/exchange"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the records of a tape file
+func readFile(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s: %v", path, err)
+	}
+
+	var records []Record
+	decoder := json.NewDecoder(gz)
+	for decoder.More() {
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRecorder_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	// Every file is full after its first record
+	recorder := NewRecorder(Options{Dir: dir, MaxFileSize: 1, MaxFileAge: time.Hour, DiskBudget: 1 << 20, Frames: true, Trades: true})
+
+	received := time.UnixMilli(1753453611045).UTC()
+	trade := exchange.Trade{Symbol: "btcusdt", Price: 100, Quantity: 1, Timestamp: received.Add(-time.Millisecond), Source: "Binance"}
+	recorder.RecordFrame("Binance", exchange.MarketSpot, received, []byte(`{"e":"trade","s":"BTCUSDT"}`))
+	recorder.RecordTrade(received, trade)
+	recorder.RecordFrame("Bybit", exchange.MarketPerp, received, []byte(`{"topic":"publicTrade.BTCUSDT"}`))
+	recorder.Close()
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected a file per record, got %v", files)
+	}
+
+	frame := readFile(t, files[0])
+	if len(frame) != 1 || frame[0].Exchange != "Binance" || frame[0].Frame != `{"e":"trade","s":"BTCUSDT"}` || !frame[0].Received.Equal(received) {
+		t.Errorf("Unexpected frame record %+v", frame)
+	}
+	tradeRecord := readFile(t, files[1])
+	if len(tradeRecord) != 1 || tradeRecord[0].Trade == nil || *tradeRecord[0].Trade != trade {
+		t.Errorf("Unexpected trade record %+v", tradeRecord)
+	}
+	perpFrame := readFile(t, files[2])
+	if len(perpFrame) != 1 || perpFrame[0].Market != exchange.MarketPerp {
+		t.Errorf("Unexpected perp frame record %+v", perpFrame)
+	}
+}
+
+func TestRecorder_RotateOnClock(t *testing.T) {
+	dir := t.TempDir()
+	start := time.UnixMilli(1753453611045).UTC()
+	clock := fakeclock.New(start)
+	// Written without the writer goroutine, so the records are written before the clock advances
+	recorder := &Recorder{opts: Options{Dir: dir, MaxFileSize: 1 << 10, MaxFileAge: time.Hour, DiskBudget: 1 << 20, Clock: clock}}
+
+	frame := Record{Received: start, Exchange: "Binance", Frame: `{"e":"trade","s":"BTCUSDT"}`}
+	recorder.write(frame)
+	clock.Advance(time.Hour - time.Millisecond)
+	recorder.write(frame)
+	clock.Advance(time.Millisecond)
+	recorder.write(frame)
+	recorder.closeFile()
+
+	// Files are named after the time they were opened on the clock, and rotated once as old as MaxFileAge on it
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		filePrefix + start.Format(fileTimeFormat) + fileSuffix,
+		filePrefix + start.Add(time.Hour).Format(fileTimeFormat) + fileSuffix,
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != expected[0] || filepath.Base(files[1]) != expected[1] {
+		t.Fatalf("Expected files %v, got %v", expected, files)
+	}
+	if records := readFile(t, files[0]); len(records) != 2 {
+		t.Errorf("Expected 2 records in the first file, got %d", len(records))
+	}
+	if records := readFile(t, files[1]); len(records) != 1 {
+		t.Errorf("Expected 1 record in the second file, got %d", len(records))
+	}
+}
+
+func TestRecorder_DiskBudget(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"tape-20250101T000000.000000000Z.jsonl.gz", "tape-20250102T000000.000000000Z.jsonl.gz", "tape-20250103T000000.000000000Z.jsonl.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 100), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// The new file needs room for 100 bytes, so only one of the old files fits the budget
+	recorder := NewRecorder(Options{Dir: dir, MaxFileSize: 100, MaxFileAge: time.Hour, DiskBudget: 250, Frames: true})
+	recorder.RecordFrame("Binance", exchange.MarketSpot, time.Now(), []byte("{}"))
+	recorder.Close()
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "tape-20250103T000000.000000000Z.jsonl.gz" {
+		t.Errorf("Expected the newest old file and the new file, got %v", files)
+	}
+}
+
+func TestRecorder_ServeHTTP(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewRecorder(Options{Dir: dir, MaxFileSize: 1 << 20, MaxFileAge: time.Hour, DiskBudget: 1 << 20})
+	defer recorder.Close()
+
+	// Nothing is recorded until recording is switched on
+	recorder.RecordFrame("Binance", exchange.MarketSpot, time.Now(), []byte("{}"))
+
+	tests := []struct {
+		method   string
+		target   string
+		status   int
+		expected string
+	}{
+		{method: http.MethodGet, target: "/tape", status: http.StatusOK, expected: `{"frames":false,"trades":false}`},
+		{method: http.MethodPost, target: "/tape?frames=true", status: http.StatusOK, expected: `{"frames":true,"trades":false}`},
+		{method: http.MethodPost, target: "/tape?trades=yes", status: http.StatusBadRequest, expected: "invalid trades: yes"},
+		{method: http.MethodDelete, target: "/tape", status: http.StatusMethodNotAllowed, expected: "method not allowed"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		recorder.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.status || strings.TrimSpace(w.Body.String()) != tt.expected {
+			t.Errorf("%s %s: expected %d %s, got %d %s", tt.method, tt.target, tt.status, tt.expected, w.Code, w.Body.String())
+		}
+	}
+
+	recorder.RecordFrame("Binance", exchange.MarketSpot, time.Now(), []byte(`{"e":"trade"}`))
+	recorder.RecordTrade(time.Now(), exchange.Trade{Symbol: "btcusdt", Source: "Binance"})
+	recorder.Close()
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected a single file, got %v", files)
+	}
+	if records := readFile(t, files[0]); len(records) != 1 || records[0].Frame != `{"e":"trade"}` {
+		t.Errorf("Expected only the frame recorded after switching frames on, got %+v", records)
+	}
+}
@@ -0,0 +1,88 @@
+// OpenTelemetry tracing of the request, exchange and candle pipeline
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "hermeneutic-candles"
+
+// Span exporters selected with TRACE_EXPORTER
+const (
+	// Spans are not recorded
+	ExporterNone = "none"
+	// Spans are written to stdout as JSON
+	ExporterStdout = "stdout"
+	// Spans are appended to TRACE_FILE_PATH as JSON
+	ExporterFile = "file"
+	// Spans are sent to a collector over OTLP/HTTP, configured with the standard OTEL_EXPORTER_OTLP_* environment variables
+	ExporterOTLP = "otlp"
+)
+
+// Returns the tracer of the service's spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(serviceName)
+}
+
+// Sets the global tracer provider and W3C trace context propagator
+//
+// Returns a function that flushes and stops the exporter, which must be called before the process exits
+func Setup(ctx context.Context, exporter string, filePath string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		closeFile    func() error
+		err          error
+	)
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		f, openErr := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return nil, fmt.Errorf("failed to open trace file %s: %w", filePath, openErr)
+		}
+		closeFile = f.Close
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, must be one of %s, %s, %s or %s", exporter, ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}, nil
+}
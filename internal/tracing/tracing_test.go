@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	defaultProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(defaultProvider)
+
+	tests := []struct {
+		name        string
+		exporter    string
+		shouldError bool
+	}{
+		{name: "none", exporter: ExporterNone},
+		{name: "unset", exporter: ""},
+		{name: "stdout", exporter: ExporterStdout},
+		{name: "unknown exporter", exporter: "jaeger", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tt.exporter, "")
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("Unexpected error on shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	defaultProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(defaultProvider)
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), ExporterFile, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, span := Tracer().Start(context.Background(), "test-span")
+	span.End()
+
+	// Shutting down flushes the batched spans to the file
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error on shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"test-span"`) {
+		t.Errorf("Expected trace file to contain the span, got %s", data)
+	}
+}
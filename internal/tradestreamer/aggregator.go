@@ -2,44 +2,150 @@ package tradestreamer
 
 import (
 	"context"
+	"fmt"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"log"
-	"sync"
+	"hermeneutic-candles/internal/tape"
+	"slices"
+	"strings"
 )
 
+// Aggregator groups the hubs of every exchange, so a client stream can subscribe to all of them at once
 type Aggregator struct {
-	TradeStreamers []*TradeStreamer
+	Hubs []*Hub
 }
 
-func NewAggregator(tradeStreamers []*TradeStreamer) *Aggregator {
-	return &Aggregator{TradeStreamers: tradeStreamers}
+func NewAggregator(hubs []*Hub) *Aggregator {
+	return &Aggregator{Hubs: hubs}
 }
 
-func (a *Aggregator) StreamTrades(ctx context.Context, symbols []exchange.SymbolPair) {
-	errCh := make(chan error, len(a.TradeStreamers))
-	var wg sync.WaitGroup
+// Returns an Aggregator of the hubs with the given exchange names, matched case-insensitively
+//
+// Returns the aggregator itself when names is empty, and an error listing the valid names when an exchange is unknown.
+// The hubs are shared with a, so the returned Aggregator must not be closed
+func (a *Aggregator) Select(names []string) (*Aggregator, error) {
+	if len(names) == 0 {
+		return a, nil
+	}
+
+	var hubs []*Hub
+	for _, name := range names {
+		i := slices.IndexFunc(a.Hubs, func(hub *Hub) bool {
+			return strings.EqualFold(hub.Name(), name)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unknown exchange %q, must be one of %v", name, a.Names())
+		}
+		if !slices.Contains(hubs, a.Hubs[i]) {
+			hubs = append(hubs, a.Hubs[i])
+		}
+	}
+	return NewAggregator(hubs), nil
+}
+
+// Returns the names of the exchanges
+func (a *Aggregator) Names() []string {
+	names := make([]string, 0, len(a.Hubs))
+	for _, hub := range a.Hubs {
+		names = append(names, hub.Name())
+	}
+	return names
+}
+
+// Returns the names of the exchanges that support the market
+func (a *Aggregator) MarketNames(market exchange.Market) []string {
+	var names []string
+	for _, hub := range a.Hubs {
+		if slices.Contains(hub.Markets(), market) {
+			names = append(names, hub.Name())
+		}
+	}
+	return names
+}
+
+// Returns whether any of the exchanges supports the market
+func (a *Aggregator) SupportsMarket(market exchange.Market) bool {
+	for _, hub := range a.Hubs {
+		if slices.Contains(hub.Markets(), market) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the liveness of the connection to every exchange
+func (a *Aggregator) Status() []Status {
+	statuses := make([]Status, 0, len(a.Hubs))
+	for _, hub := range a.Hubs {
+		statuses = append(statuses, hub.Status())
+	}
+	return statuses
+}
 
-	for _, tradeStreamer := range a.TradeStreamers {
-		wg.Add(1)
-		go func(tradeStreamer *TradeStreamer) {
-			defer wg.Done()
-			err := tradeStreamer.StreamTrades(ctx, symbols)
-			if err != nil {
-				errCh <- err
-			}
-		}(tradeStreamer)
+// Subscribes to trades of the given symbols on every exchange
+//
+// The clocks of the hubs are held until every exchange subscribed, so a virtual clock does not advance
+// once the first exchange connects, while the others are still subscribing
+func (a *Aggregator) Subscribe(ctx context.Context, symbols []exchange.SymbolPair, sub *Subscriber) {
+	for _, hub := range a.Hubs {
+		hub.holdClock()
 	}
+	for _, hub := range a.Hubs {
+		hub.Subscribe(ctx, symbols, sub)
+	}
+	for _, hub := range a.Hubs {
+		hub.releaseClock()
+	}
+}
+
+// Unsubscribes from trades of the given symbols on every exchange
+func (a *Aggregator) Unsubscribe(symbols []exchange.SymbolPair, sub *Subscriber) {
+	for _, hub := range a.Hubs {
+		hub.Unsubscribe(symbols, sub)
+	}
+}
+
+// Sends the state changes of every exchange to the subscriber, until it is unwatched
+func (a *Aggregator) Watch(sub *Subscriber) {
+	for _, hub := range a.Hubs {
+		hub.Watch(sub)
+	}
+}
+
+// Stops sending the state changes of every exchange to the subscriber
+func (a *Aggregator) Unwatch(sub *Subscriber) {
+	for _, hub := range a.Hubs {
+		hub.Unwatch(sub)
+	}
+}
+
+// Sets the recorder of the frames and trades of every exchange
+func (a *Aggregator) SetRecorder(recorder *tape.Recorder) {
+	for _, hub := range a.Hubs {
+		hub.SetRecorder(recorder)
+	}
+}
 
-	go func() {
-		wg.Wait()
-		close(errCh)
-	}()
+// Sets the clock of every exchange, see Hub.SetClock
+func (a *Aggregator) SetClock(c clock.Clock) {
+	for _, hub := range a.Hubs {
+		hub.SetClock(c)
+	}
+}
 
-	// Handle errors from all adapters
-	for err := range errCh {
-		if err != nil {
-			// Log the error or handle it as needed
-			log.Printf("Adapter disconnected: %v", err)
+// Returns the KlineFetcher of the exchange with the given name, if it supports fetching klines of the market
+func (a *Aggregator) KlineFetcher(name string, market exchange.Market) (exchange.KlineFetcher, bool) {
+	for _, hub := range a.Hubs {
+		if hub.Name() == name {
+			return hub.KlineFetcher(market)
 		}
 	}
+	return nil, false
+}
+
+// Closes the upstream connections of every exchange
+func (a *Aggregator) Close() {
+	for _, hub := range a.Hubs {
+		hub.Close()
+	}
 }
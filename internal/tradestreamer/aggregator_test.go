@@ -0,0 +1,65 @@
+package tradestreamer
+
+import (
+	"hermeneutic-candles/internal/exchange"
+	"slices"
+	"testing"
+)
+
+func TestAggregator_Select(t *testing.T) {
+	newHub := func(name string) *Hub {
+		return NewHub(func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+			return NewMockExchangeAdapter(name, "ws://localhost:18082/ws", tradeChannel)
+		}, 10)
+	}
+	aggregator := NewAggregator([]*Hub{newHub("Binance"), newHub("Bybit"), newHub("Okx")})
+	defer aggregator.Close()
+
+	tests := []struct {
+		name        string
+		input       []string
+		expected    []string
+		shouldError bool
+	}{
+		{
+			name:     "no exchanges selects all",
+			input:    nil,
+			expected: []string{"Binance", "Bybit", "Okx"},
+		},
+		{
+			name:     "names are case-insensitive",
+			input:    []string{"okx", "BINANCE"},
+			expected: []string{"Okx", "Binance"},
+		},
+		{
+			name:     "duplicates are ignored",
+			input:    []string{"bybit", "Bybit"},
+			expected: []string{"Bybit"},
+		},
+		{
+			name:        "unknown exchange",
+			input:       []string{"binance", "bitstamp"},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := aggregator.Select(tt.input)
+
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(result.Names(), tt.expected) {
+				t.Errorf("Expected exchanges %v, got %v", tt.expected, result.Names())
+			}
+		})
+	}
+}
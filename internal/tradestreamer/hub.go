@@ -0,0 +1,575 @@
+package tradestreamer
+
+import (
+	"context"
+	"hermeneutic-candles/internal/clock"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/metrics"
+	"hermeneutic-candles/internal/tape"
+	"hermeneutic-candles/internal/tracing"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Gap is a period in which a hub was disconnected from its exchange, and trades may have been missed
+type Gap struct {
+	Source string
+	// Market of the disconnected upstream, only symbols of the market may have missed trades
+	Market exchange.Market
+	From   time.Time
+	To     time.Time
+}
+
+// Rejection is a symbol an exchange refused to stream, e.g. an unknown pair
+type Rejection struct {
+	Source string
+	// Key of the symbol
+	Symbol string
+	Reason string
+}
+
+// StateChange is a change of the connection state of one market of an exchange
+type StateChange struct {
+	Market exchange.Market
+	Status
+}
+
+// Subscriber receives the trades of the symbols it subscribed to, the gaps of the hubs it subscribed to,
+// the symbols it subscribed to that were rejected, and the state changes of the markets of its symbols
+//
+// Its trades are queued on the clock of the pipeline, see clock.Queue
+type Subscriber struct {
+	Trades       *clock.Queue[exchange.Trade]
+	Gaps         chan Gap
+	Rejections   chan Rejection
+	StateChanges chan StateChange
+}
+
+func NewSubscriber(bufferSize int, c clock.Clock) *Subscriber {
+	return &Subscriber{
+		Trades:       clock.NewQueue[exchange.Trade](c, bufferSize),
+		Gaps:         make(chan Gap, 10),
+		Rejections:   make(chan Rejection, 10),
+		StateChanges: make(chan StateChange, 10),
+	}
+}
+
+// Hub shares a single upstream per market of an exchange between all client streams
+//
+// The upstream of a market is a TradeStreamer, which shards the symbols over several connections
+// when they exceed the limits of the exchange.
+// It keeps a reference-counted set of subscribed symbols, and fans trades out to every
+// subscriber interested in the trade's symbol. The upstream subscription for a symbol is
+// dropped once its last subscriber leaves
+type Hub struct {
+	name         string
+	logger       *slog.Logger
+	newAdapter   exchange.AdapterFactory
+	adapter      exchange.ExchangeAdapter
+	markets      []exchange.Market
+	tradeChannel chan exchange.Trade
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// Symbol key -> subscribed symbol
+	symbols map[string]exchange.SymbolPair
+	// Symbol key -> set of subscribers. The size of the set is the symbol's reference count
+	subscribers map[string]map[*Subscriber]struct{}
+	// Market -> upstream connection of the market. Markets other than spot are created on their first subscription
+	upstreams map[exchange.Market]*upstream
+	// Subscribers receiving the state changes of every market, whether or not they subscribed to symbols
+	watchers map[*Subscriber]struct{}
+	// Held by the trades of the adapters until they are queued to the subscribers, and while an upstream connects, see clock.Hold
+	clock clock.Clock
+	// Time of the last trade received from any market
+	lastTrade time.Time
+
+	// Records the frames and trades of the exchange, nil if no recorder is set
+	recorder atomic.Pointer[tape.Recorder]
+}
+
+// Connection to a single market of the exchange
+type upstream struct {
+	streamer     *TradeStreamer
+	cancelStream context.CancelFunc
+	streamDone   chan struct{}
+	// The clock is held until the stream connects
+	connecting bool
+}
+
+// Creates a new Hub for the adapter returned by newAdapter
+//
+// newAdapter receives the channel the adapter must write trades to.
+// It is called again for every market other than spot the adapter supports, see exchange.MarketAdapter,
+// and for every additional shard of a market, see exchange.SubscriptionLimiter
+func NewHub(newAdapter exchange.AdapterFactory, bufferSize int) *Hub {
+	tradeChannel := make(chan exchange.Trade, bufferSize)
+	adapter := newAdapter(tradeChannel)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	markets := []exchange.Market{exchange.MarketSpot}
+	if marketAdapter, ok := adapter.(exchange.MarketAdapter); ok {
+		markets = append(markets, marketAdapter.Markets()...)
+	}
+
+	h := &Hub{
+		name:         adapter.Name(),
+		logger:       slog.With("exchange", adapter.Name()),
+		newAdapter:   newAdapter,
+		adapter:      adapter,
+		markets:      markets,
+		tradeChannel: tradeChannel,
+		ctx:          ctx,
+		cancel:       cancel,
+		symbols:      map[string]exchange.SymbolPair{},
+		subscribers:  map[string]map[*Subscriber]struct{}{},
+		upstreams:    map[exchange.Market]*upstream{},
+		watchers:     map[*Subscriber]struct{}{},
+		clock:        clock.Real(),
+	}
+	h.upstreams[exchange.MarketSpot] = h.newUpstream(adapter, exchange.MarketSpot)
+	go h.dispatch()
+	return h
+}
+
+// Creates the upstream of the market, whose first shard is streamed by adapter
+func (h *Hub) newUpstream(adapter exchange.ExchangeAdapter, market exchange.Market) *upstream {
+	streamer := NewTradeStreamer(adapter, func() exchange.ExchangeAdapter {
+		return h.newMarketAdapter(market)
+	})
+	streamer.OnGap(func(from, to time.Time) {
+		h.notifyGap(Gap{Source: h.name, Market: market, From: from, To: to})
+	})
+	streamer.OnRejected(h.notifyRejected)
+	streamer.OnStateChange(func(status Status) {
+		h.notifyStateChange(StateChange{Market: market, Status: status})
+	})
+	streamer.OnMessage(func(received time.Time, message []byte) {
+		h.recorder.Load().RecordFrame(h.name, market, received, message)
+	})
+	return &upstream{streamer: streamer}
+}
+
+// Returns the upstream of the market, creating it with a new adapter if needed
+// Returns false if the exchange does not support the market
+// Must be called with the lock held
+func (h *Hub) upstreamLocked(market exchange.Market) (*upstream, bool) {
+	if up, ok := h.upstreams[market]; ok {
+		return up, true
+	}
+	if !slices.Contains(h.markets, market) {
+		return nil, false
+	}
+
+	up := h.newUpstream(h.newMarketAdapter(market), market)
+	h.upstreams[market] = up
+	return up, true
+}
+
+// Creates a new adapter streaming the market
+func (h *Hub) newMarketAdapter(market exchange.Market) exchange.ExchangeAdapter {
+	adapter := h.newAdapter(h.tradeChannel)
+	if market != exchange.MarketSpot {
+		adapter.(exchange.MarketAdapter).SetMarket(market)
+	}
+	return adapter
+}
+
+func (h *Hub) Name() string {
+	return h.name
+}
+
+// Sets the recorder of the frames received from the exchange and the trades parsed from them
+func (h *Hub) SetRecorder(recorder *tape.Recorder) {
+	h.recorder.Store(recorder)
+}
+
+// Sets the clock held for the trades sent to the subscribers, and while an upstream connects
+//
+// With a clock.Holder, the adapters must hold the clock for every trade they send, see clock.Receiver.
+// Must be called before Subscribe
+func (h *Hub) SetClock(c clock.Clock) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clock = c
+}
+
+// Holds the clock, e.g. while several hubs subscribe
+func (h *Hub) holdClock() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clock.Hold(h.clock, 1)
+}
+
+// Releases a hold of holdClock
+func (h *Hub) releaseClock() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clock.Release(h.clock)
+}
+
+// Returns the adapter as a KlineFetcher, if the exchange supports fetching klines of the market
+func (h *Hub) KlineFetcher(market exchange.Market) (exchange.KlineFetcher, bool) {
+	if !slices.Contains(h.markets, market) {
+		return nil, false
+	}
+	fetcher, ok := h.adapter.(exchange.KlineFetcher)
+	return fetcher, ok
+}
+
+// Returns the markets the exchange supports
+func (h *Hub) Markets() []exchange.Market {
+	return h.markets
+}
+
+// Returns the liveness of the upstream connections
+//
+// The exchange is connected when any market is connected. Otherwise its state is the state of the market closest to connected,
+// i.e. connecting, then an open circuit, then idle. Its last message is the latest of every market
+func (h *Hub) Status() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := Status{Exchange: h.name, State: StateIdle, LastTrade: h.lastTrade}
+	for _, market := range h.markets {
+		up, ok := h.upstreams[market]
+		if !ok {
+			continue
+		}
+		upStatus := up.streamer.Status()
+		if hubStatePriority[upStatus.State] > hubStatePriority[status.State] {
+			status.State, status.Failures, status.NextAttempt = upStatus.State, upStatus.Failures, upStatus.NextAttempt
+		}
+		if upStatus.LastMessage.After(status.LastMessage) {
+			status.LastMessage = upStatus.LastMessage
+		}
+	}
+	status.Connected = status.State == StateConnected
+	return status
+}
+
+// Order of the states from idle to connected
+var hubStatePriority = map[ConnectionState]int{
+	StateIdle:        0,
+	StateCircuitOpen: 1,
+	StateConnecting:  2,
+	StateConnected:   3,
+}
+
+// Returns the symbols currently subscribed upstream
+func (h *Hub) Symbols() []exchange.SymbolPair {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.symbolsLocked()
+}
+
+// Subscribes to trades of the given symbols
+//
+// Symbols that have no other subscribers are subscribed upstream over the current connection of their market.
+// Symbols of markets the exchange does not support are skipped.
+// ctx carries the trace of the subscribing request
+func (h *Hub) Subscribe(ctx context.Context, symbols []exchange.SymbolPair, sub *Subscriber) {
+	ctx, span := tracing.Tracer().Start(ctx, "Hub.Subscribe", trace.WithAttributes(
+		attribute.String("exchange", h.name),
+		attribute.StringSlice("symbols", exchange.SymbolKeys(symbols)),
+	))
+	defer span.End()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var added []exchange.SymbolPair
+	for _, symbol := range symbols {
+		if !slices.Contains(h.markets, symbol.Market) {
+			h.logger.Debug("Market not supported, skipping symbol", "symbol", symbol.Key(), "market", symbol.Market.String())
+			continue
+		}
+		key := symbol.Key()
+		if h.subscribers[key] == nil {
+			h.subscribers[key] = map[*Subscriber]struct{}{}
+			h.symbols[key] = symbol
+			added = append(added, symbol)
+		}
+		h.subscribers[key][sub] = struct{}{}
+	}
+
+	span.SetAttributes(attribute.StringSlice("added", exchange.SymbolKeys(added)))
+	for market, marketSymbols := range groupByMarket(added) {
+		up, _ := h.upstreamLocked(market)
+		up.streamer.UpdateSymbols(marketSymbols, nil)
+		h.startLocked(ctx, up)
+	}
+}
+
+// Unsubscribes from trades of the given symbols
+//
+// Symbols that have no subscribers left are unsubscribed upstream,
+// and the upstream connection of a market is closed once no symbols of the market are left
+func (h *Hub) Unsubscribe(symbols []exchange.SymbolPair, sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed []exchange.SymbolPair
+	for _, symbol := range symbols {
+		key := symbol.Key()
+		subscribers, ok := h.subscribers[key]
+		if !ok {
+			continue
+		}
+		delete(subscribers, sub)
+		if len(subscribers) == 0 {
+			delete(h.subscribers, key)
+			delete(h.symbols, key)
+			removed = append(removed, symbol)
+		}
+	}
+
+	for market, marketSymbols := range groupByMarket(removed) {
+		up := h.upstreams[market]
+		up.streamer.UpdateSymbols(nil, marketSymbols)
+		if !h.hasMarketLocked(market) {
+			h.stopLocked(up, market)
+		}
+	}
+}
+
+// Returns whether any symbol of the market is subscribed
+// Must be called with the lock held
+func (h *Hub) hasMarketLocked(market exchange.Market) bool {
+	for _, symbol := range h.symbols {
+		if symbol.Market == market {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends the state changes of every market to the subscriber, until it is unwatched
+func (h *Hub) Watch(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[sub] = struct{}{}
+}
+
+// Stops sending the state changes of the markets without symbols of the subscriber
+func (h *Hub) Unwatch(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, sub)
+}
+
+// Groups the symbols by their market
+func groupByMarket(symbols []exchange.SymbolPair) map[exchange.Market][]exchange.SymbolPair {
+	groups := map[exchange.Market][]exchange.SymbolPair{}
+	for _, symbol := range symbols {
+		groups[symbol.Market] = append(groups[symbol.Market], symbol)
+	}
+	return groups
+}
+
+// Stops the upstream connection and the fan-out
+func (h *Hub) Close() {
+	h.cancel()
+}
+
+// Starts the stream of the upstream if it is not running
+// The first connection of the stream is traced as part of the trace in traceCtx
+// Must be called with the lock held
+func (h *Hub) startLocked(traceCtx context.Context, up *upstream) {
+	if up.cancelStream != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(h.ctx, trace.SpanContextFromContext(traceCtx)))
+	prevDone := up.streamDone
+	done := make(chan struct{})
+	up.cancelStream = cancel
+	up.streamDone = done
+	if !up.connecting {
+		// A virtual clock waits for the connection, so the trades of the first frames are not missed
+		up.connecting = true
+		clock.Hold(h.clock, 1)
+	}
+
+	go func() {
+		defer close(done)
+		// The adapters hold a single connection each, wait for the previous stream to release them
+		if prevDone != nil {
+			<-prevDone
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Blocks until the upstream is stopped, the streamer keeps reconnecting a failing exchange
+		up.streamer.StreamTrades(ctx, nil)
+
+		// Allow the next subscription to start the stream again
+		h.mu.Lock()
+		if up.streamDone == done {
+			up.cancelStream = nil
+			h.connectedLocked(up)
+		}
+		h.mu.Unlock()
+		cancel()
+	}()
+}
+
+// Releases the clock held while the upstream connects
+// Must be called with the lock held
+func (h *Hub) connectedLocked(up *upstream) {
+	if up.connecting {
+		up.connecting = false
+		clock.Release(h.clock)
+	}
+}
+
+// Stops the stream of the upstream
+// Must be called with the lock held
+func (h *Hub) stopLocked(up *upstream, market exchange.Market) {
+	if up.cancelStream == nil {
+		return
+	}
+	h.logger.Info("No subscribers left, closing upstream connection", "market", market.String())
+	up.cancelStream()
+	up.cancelStream = nil
+}
+
+// Must be called with the lock held
+func (h *Hub) symbolsLocked() []exchange.SymbolPair {
+	keys := make([]string, 0, len(h.symbols))
+	for key := range h.symbols {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	symbols := make([]exchange.SymbolPair, 0, len(keys))
+	for _, key := range keys {
+		symbols = append(symbols, h.symbols[key])
+	}
+	return symbols
+}
+
+// Fans trades out to the subscribers of the trade's symbol
+// A slow subscriber drops trades instead of blocking the other subscribers
+//
+// A trade holds the clock until it is queued to every subscriber, see clock.Receiver
+func (h *Hub) dispatch() {
+	trades := clock.NewReceiver[exchange.Trade](h.tradeChannel)
+	for {
+		trade, ok := trades.Next(h.ctx, h.currentClock())
+		if !ok {
+			return
+		}
+		metrics.TradesReceived.WithLabelValues(h.name, trade.Symbol).Inc()
+
+		h.mu.Lock()
+		h.lastTrade = h.clock.Now()
+		h.recorder.Load().RecordTrade(h.lastTrade, trade)
+		for sub := range h.subscribers[trade.Symbol] {
+			if !sub.Trades.TrySend(trade) {
+				h.logger.Warn("Subscriber buffer full, dropping trade", "symbol", trade.Symbol)
+				metrics.DroppedTrades.WithLabelValues(metrics.DropReasonBufferFull).Inc()
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Returns the clock of the hub, see SetClock
+func (h *Hub) currentClock() clock.Clock {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.clock
+}
+
+// Notifies the subscribers of a symbol of the gap's market that trades during the gap may have been missed
+func (h *Hub) notifyGap(gap Gap) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notified := map[*Subscriber]struct{}{}
+	for key, subscribers := range h.subscribers {
+		if h.symbols[key].Market != gap.Market {
+			continue
+		}
+		for sub := range subscribers {
+			if _, ok := notified[sub]; ok {
+				continue
+			}
+			notified[sub] = struct{}{}
+
+			select {
+			case sub.Gaps <- gap:
+			default:
+				h.logger.Warn("Subscriber gap buffer full, dropping gap")
+			}
+		}
+	}
+}
+
+// Notifies the subscribers of the symbols the exchange rejected, and drops the symbols
+//
+// The upstream of a market is closed once none of its symbols are left
+func (h *Hub) notifyRejected(rejections []exchange.Rejection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed []exchange.SymbolPair
+	for _, rejection := range rejections {
+		key := rejection.Symbol.Key()
+		for sub := range h.subscribers[key] {
+			select {
+			case sub.Rejections <- Rejection{Source: h.name, Symbol: key, Reason: rejection.Reason}:
+			default:
+				h.logger.Warn("Subscriber rejection buffer full, dropping rejection", "symbol", key)
+			}
+		}
+		if _, ok := h.symbols[key]; ok {
+			delete(h.subscribers, key)
+			delete(h.symbols, key)
+			removed = append(removed, rejection.Symbol)
+		}
+	}
+
+	for market := range groupByMarket(removed) {
+		if !h.hasMarketLocked(market) {
+			h.stopLocked(h.upstreams[market], market)
+		}
+	}
+}
+
+// Notifies the watchers, and the subscribers of a symbol of the market, that the state of the market changed
+func (h *Hub) notifyStateChange(change StateChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if up, ok := h.upstreams[change.Market]; ok && (change.State == StateConnected || change.State == StateCircuitOpen) {
+		h.connectedLocked(up)
+	}
+
+	recipients := maps.Clone(h.watchers)
+	for key, subscribers := range h.subscribers {
+		if h.symbols[key].Market != change.Market {
+			continue
+		}
+		maps.Copy(recipients, subscribers)
+	}
+
+	for sub := range recipients {
+		select {
+		case sub.StateChanges <- change:
+		default:
+			h.logger.Warn("Subscriber state change buffer full, dropping state change", "market", change.Market.String())
+		}
+	}
+}
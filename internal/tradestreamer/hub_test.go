@@ -0,0 +1,339 @@
+package tradestreamer
+
+import (
+	"context"
+	"encoding/json"
+	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/exchange"
+	"hermeneutic-candles/internal/metrics"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHub_SubscribeAndUnsubscribe(t *testing.T) {
+	cfg := cmd.GetConfig()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+
+	mockServer := startMockServer(t, ":18081")
+
+	hub := NewHub(func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return NewMockExchangeAdapter("MockExchange", "ws://localhost:18081/ws", tradeChannel)
+	}, 100)
+	defer hub.Close()
+	clock := fakeclock.New(time.UnixMilli(1753453611000))
+	hub.SetClock(clock)
+
+	btc := exchange.SymbolPair{First: "btc", Second: "usdt"}
+	eth := exchange.SymbolPair{First: "eth", Second: "usdt"}
+
+	btcOnly := NewSubscriber(10, clock)
+	btcAndEth := NewSubscriber(10, clock)
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{btc}, btcOnly)
+	nextStateChange(t, btcOnly, "spot connecting")
+	nextStateChange(t, btcOnly, "spot connected")
+
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{btc, eth}, btcAndEth)
+
+	if symbols := hub.Symbols(); len(symbols) != 2 {
+		t.Fatalf("Expected 2 upstream symbols, got %d", len(symbols))
+	}
+
+	// A single upstream connection is shared by both subscribers, and eth is subscribed without redialing
+	if clients := mockServer.GetConnectedClients(); clients != 1 {
+		t.Fatalf("Expected 1 upstream connection, got %d", clients)
+	}
+	waitForMessages(t, mockServer, 1)
+	messages := mockServer.GetAllMessages()
+	if len(messages) != 1 || strings.TrimSpace(string(messages[0].Message)) != `{"args":["ethusdt"],"op":"subscribe"}` {
+		t.Fatalf("Expected a single incremental subscribe message for ethusdt, got %v", messages)
+	}
+
+	sendTrade := func(symbol string) {
+		trade, _ := json.Marshal(map[string]interface{}{
+			"symbol":    symbol,
+			"price":     100.0,
+			"quantity":  1.0,
+			"timestamp": 1753453611045,
+			"source":    "mock",
+		})
+		mockServer.SendMessage(trade)
+	}
+
+	// Subscribing and its acknowledgements are messages, but not trades
+	if lastTrade := hub.Status().LastTrade; !lastTrade.IsZero() {
+		t.Errorf("Expected no last trade before trades are sent, got %v", lastTrade)
+	}
+
+	// Trades are timed on the clock of the hub
+	clock.Advance(time.Second)
+	sendTrade("btcusdt")
+	sendTrade("ethusdt")
+
+	// Each trade is sent to every subscriber before the next one, so btcOnly has its trade once btcAndEth has both
+	receiveTrades(t, btcAndEth, 2)
+	if lastTrade := hub.Status().LastTrade; !lastTrade.Equal(clock.Now()) {
+		t.Errorf("Expected the last trade at %v, got %v", clock.Now(), lastTrade)
+	}
+
+	if len(btcOnly.Trades.C()) != 1 {
+		t.Errorf("Expected 1 trade for btc subscriber, got %d", len(btcOnly.Trades.C()))
+	}
+	if len(btcAndEth.Trades.C()) != 0 {
+		t.Errorf("Expected no more trades for btc and eth subscriber, got %d", len(btcAndEth.Trades.C()))
+	}
+	// Trades are counted once per exchange, regardless of the number of subscribers
+	if received := testutil.ToFloat64(metrics.TradesReceived.WithLabelValues("MockExchange", "btcusdt")); received != 1 {
+		t.Errorf("Expected 1 btc trade received, got %v", received)
+	}
+
+	// btc is still referenced by the other subscriber
+	hub.Unsubscribe([]exchange.SymbolPair{btc}, btcOnly)
+	if symbols := hub.Symbols(); len(symbols) != 2 {
+		t.Errorf("Expected 2 upstream symbols after first unsubscribe, got %d", len(symbols))
+	}
+
+	// eth is only referenced by one subscriber, and is unsubscribed upstream
+	mockServer.ClearMessages()
+	hub.Unsubscribe([]exchange.SymbolPair{eth}, btcAndEth)
+	waitForMessages(t, mockServer, 1)
+	messages = mockServer.GetAllMessages()
+	if len(messages) != 1 || strings.TrimSpace(string(messages[0].Message)) != `{"args":["ethusdt"],"op":"unsubscribe"}` {
+		t.Fatalf("Expected a single incremental unsubscribe message for ethusdt, got %v", messages)
+	}
+
+	hub.Unsubscribe([]exchange.SymbolPair{btc}, btcAndEth)
+	if symbols := hub.Symbols(); len(symbols) != 0 {
+		t.Errorf("Expected no upstream symbols after last unsubscribe, got %d", len(symbols))
+	}
+
+	// The upstream connection is closed
+	waitForClients(t, mockServer, 0)
+}
+
+// Mock adapter that streams a perp market in addition to spot
+type mockMarketAdapter struct {
+	*MockExchangeAdapter
+	market exchange.Market
+}
+
+func (m *mockMarketAdapter) Markets() []exchange.Market {
+	return []exchange.Market{exchange.MarketPerp}
+}
+
+func (m *mockMarketAdapter) SetMarket(market exchange.Market) {
+	m.market = market
+}
+
+func TestHub_Markets(t *testing.T) {
+	cfg := cmd.GetConfig()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+
+	mockServer := startMockServer(t, ":18082")
+
+	var adapters []*mockMarketAdapter
+	hub := NewHub(func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		adapter := &mockMarketAdapter{MockExchangeAdapter: NewMockExchangeAdapter("MockMarketExchange", "ws://localhost:18082/ws", tradeChannel)}
+		adapters = append(adapters, adapter)
+		return adapter
+	}, 100)
+	defer hub.Close()
+	fake := fakeclock.New(time.UnixMilli(1753453611000))
+	hub.SetClock(fake)
+
+	spot := exchange.SymbolPair{First: "btc", Second: "usdt"}
+	perp := exchange.SymbolPair{First: "btc", Second: "usdt", Market: exchange.MarketPerp}
+	spotSub := NewSubscriber(10, fake)
+	perpSub := NewSubscriber(10, fake)
+	watcher := NewSubscriber(10, fake)
+	hub.Watch(watcher)
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{spot}, spotSub)
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{perp}, perpSub)
+
+	// Subscribers receive the state changes of the markets of their symbols, and the watcher of every market
+	nextStateChange(t, spotSub, "spot connecting")
+	nextStateChange(t, spotSub, "spot connected")
+	nextStateChange(t, perpSub, "perp connecting")
+	nextStateChange(t, perpSub, "perp connected")
+	if changes := receiveStateChanges(t, watcher, 4); len(drainStateChanges(watcher)) != 0 {
+		t.Errorf("Expected 4 state changes of the watcher, got more than %v", changes)
+	}
+	if changes := drainStateChanges(spotSub); len(changes) != 0 {
+		t.Errorf("Unexpected state changes of the spot subscriber %v", changes)
+	}
+
+	// The perp market is streamed by its own adapter over its own connection
+	if len(adapters) != 2 || adapters[1].market != exchange.MarketPerp {
+		t.Fatalf("Expected a second adapter for the perp market, got %d adapters", len(adapters))
+	}
+	if clients := mockServer.GetConnectedClients(); clients != 2 {
+		t.Fatalf("Expected 2 upstream connections, got %d", clients)
+	}
+
+	trade, _ := json.Marshal(map[string]interface{}{
+		"symbol":    "btcusdt:perp",
+		"price":     100.0,
+		"quantity":  1.0,
+		"timestamp": 1753453611045,
+		"source":    "mock",
+	})
+	mockServer.SendMessage(trade)
+
+	// Both connections receive the trade, and only the perp subscriber is interested in it
+	receiveTrades(t, perpSub, 2)
+	if len(spotSub.Trades.C()) != 0 {
+		t.Errorf("Expected no trades for spot subscriber, got %d", len(spotSub.Trades.C()))
+	}
+
+	// Closing the perp market leaves the spot connection open
+	hub.Unsubscribe([]exchange.SymbolPair{perp}, perpSub)
+	nextStateChange(t, watcher, "perp idle")
+	waitForClients(t, mockServer, 1)
+}
+
+// Receives n trades sent to the subscriber, failing the test if they are not sent in time
+func receiveTrades(t *testing.T, sub *Subscriber, n int) []exchange.Trade {
+	t.Helper()
+	var trades []exchange.Trade
+	timeout := time.After(5 * time.Second)
+	for len(trades) < n {
+		select {
+		case trade := <-sub.Trades.C():
+			trades = append(trades, trade)
+		case <-timeout:
+			t.Fatalf("Expected %d trades, got %v", n, trades)
+		}
+	}
+	return trades
+}
+
+// Receives n state changes sent to the subscriber, and returns their markets and states
+func receiveStateChanges(t *testing.T, sub *Subscriber, n int) []string {
+	t.Helper()
+	var changes []string
+	timeout := time.After(5 * time.Second)
+	for len(changes) < n {
+		select {
+		case change := <-sub.StateChanges:
+			changes = append(changes, change.Market.String()+" "+change.State.String())
+		case <-timeout:
+			t.Fatalf("Expected %d state changes, got %v", n, changes)
+		}
+	}
+	return changes
+}
+
+// Receives the next state change sent to the subscriber, failing the test unless it is change, e.g. "spot connected"
+func nextStateChange(t *testing.T, sub *Subscriber, change string) {
+	t.Helper()
+	if changes := receiveStateChanges(t, sub, 1); changes[0] != change {
+		t.Fatalf("Expected state change %s, got %s", change, changes[0])
+	}
+}
+
+// Returns the markets and states of the state changes received by the subscriber
+func drainStateChanges(sub *Subscriber) []string {
+	var changes []string
+	for {
+		select {
+		case change := <-sub.StateChanges:
+			changes = append(changes, change.Market.String()+" "+change.State.String())
+		default:
+			return changes
+		}
+	}
+}
+
+// Mock adapter of an exchange that rejects symbols with {"rejected": "<symbol key>"} messages
+type mockAcknowledgingAdapter struct {
+	*MockExchangeAdapter
+	onRejected func([]exchange.Rejection)
+
+	mu      sync.Mutex
+	symbols map[string]exchange.SymbolPair
+}
+
+func (m *mockAcknowledgingAdapter) OnRejected(handler func([]exchange.Rejection)) {
+	m.onRejected = handler
+}
+
+func (m *mockAcknowledgingAdapter) WaitForAcks(c *websocket.Conn, handle func(message []byte)) error {
+	return nil
+}
+
+func (m *mockAcknowledgingAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, symbol := range symbols {
+		m.symbols[symbol.Key()] = symbol
+	}
+	return m.MockExchangeAdapter.Subscribe(symbols)
+}
+
+func (m *mockAcknowledgingAdapter) HandleMessage(message []byte) error {
+	var rejection struct {
+		Rejected string `json:"rejected"`
+	}
+	if err := json.Unmarshal(message, &rejection); err == nil && rejection.Rejected != "" {
+		m.mu.Lock()
+		symbol := m.symbols[rejection.Rejected]
+		m.mu.Unlock()
+		m.onRejected([]exchange.Rejection{{Symbol: symbol, Reason: "unknown pair"}})
+		return nil
+	}
+	return m.MockExchangeAdapter.HandleMessage(message)
+}
+
+func TestHub_Rejected(t *testing.T) {
+	cfg := cmd.GetConfig()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+
+	mockServer := startMockServer(t, ":18084")
+
+	hub := NewHub(func(tradeChannel chan<- exchange.Trade) exchange.ExchangeAdapter {
+		return &mockAcknowledgingAdapter{
+			MockExchangeAdapter: NewMockExchangeAdapter("MockExchange", "ws://localhost:18084/ws", tradeChannel),
+			symbols:             map[string]exchange.SymbolPair{},
+		}
+	}, 100)
+	defer hub.Close()
+	fake := fakeclock.New(time.UnixMilli(1753453611000))
+	hub.SetClock(fake)
+
+	btc := exchange.SymbolPair{First: "btc", Second: "usdt"}
+	foo := exchange.SymbolPair{First: "foo", Second: "usdt"}
+	sub := NewSubscriber(10, fake)
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{btc}, sub)
+	nextStateChange(t, sub, "spot connecting")
+	nextStateChange(t, sub, "spot connected")
+
+	// The symbol is subscribed in the background, and rejected once its subscribe message arrives
+	hub.Subscribe(context.Background(), []exchange.SymbolPair{foo}, sub)
+	waitForMessages(t, mockServer, 1)
+	mockServer.SendMessage([]byte(`{"rejected": "foousdt"}`))
+
+	select {
+	case rejection := <-sub.Rejections:
+		if rejection.Source != "MockExchange" || rejection.Symbol != "foousdt" || rejection.Reason != "unknown pair" {
+			t.Errorf("Unexpected rejection %+v", rejection)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a rejection of foousdt")
+	}
+
+	// The rejected symbol is dropped, and the other symbols keep streaming
+	if symbols := hub.Symbols(); len(symbols) != 1 || symbols[0] != btc {
+		t.Errorf("Expected only btcusdt to be subscribed, got %v", symbols)
+	}
+	if clients := mockServer.GetConnectedClients(); clients != 1 {
+		t.Errorf("Expected 1 upstream connection, got %d", clients)
+	}
+}
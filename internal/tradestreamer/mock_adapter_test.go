@@ -12,6 +12,7 @@ import (
 
 // MockExchangeAdapter implements the ExchangeAdapter interface for testing
 type MockExchangeAdapter struct {
+	name         string
 	wsURL        string
 	tradeChannel chan<- exchange.Trade
 	conn         *websocket.Conn
@@ -26,11 +27,11 @@ type MockTrade struct {
 }
 
 func NewMockExchangeAdapter(name, wsURL string, tradeChannel chan<- exchange.Trade) *MockExchangeAdapter {
-	return &MockExchangeAdapter{wsURL: wsURL, tradeChannel: tradeChannel}
+	return &MockExchangeAdapter{name: name, wsURL: wsURL, tradeChannel: tradeChannel}
 }
 
 func (m *MockExchangeAdapter) Name() string {
-	return "Mock"
+	return m.name
 }
 
 func (m *MockExchangeAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair) (*websocket.Conn, error) {
@@ -39,6 +40,25 @@ func (m *MockExchangeAdapter) ConnectAndSubscribe(symbols []exchange.SymbolPair)
 	return conn, err
 }
 
+func (m *MockExchangeAdapter) Subscribe(symbols []exchange.SymbolPair) error {
+	return m.sendSubscription("subscribe", symbols)
+}
+
+func (m *MockExchangeAdapter) Unsubscribe(symbols []exchange.SymbolPair) error {
+	return m.sendSubscription("unsubscribe", symbols)
+}
+
+func (m *MockExchangeAdapter) sendSubscription(op string, symbols []exchange.SymbolPair) error {
+	if m.conn == nil {
+		return fmt.Errorf("no connection")
+	}
+	var args []string
+	for _, symbol := range symbols {
+		args = append(args, symbol.Key())
+	}
+	return m.conn.WriteJSON(map[string]interface{}{"op": op, "args": args})
+}
+
 func (m *MockExchangeAdapter) HandleMessage(message []byte) error {
 	log.Printf("Received message: %s", message)
 	var trade MockTrade
@@ -0,0 +1,86 @@
+package tradestreamer
+
+import (
+	"hermeneutic-candles/cmd"
+	"math"
+	"time"
+)
+
+// State of the connections to an exchange
+type ConnectionState int
+
+const (
+	// Not streaming, e.g. no symbols of the exchange are subscribed
+	StateIdle ConnectionState = iota
+	// Connecting, or waiting to reconnect after a failed attempt or a lost connection
+	StateConnecting
+	StateConnected
+	// Failed to connect MaxRetries times in a row. The exchange is probed at the probe interval until it connects again
+	StateCircuitOpen
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateCircuitOpen:
+		return "circuit_open"
+	default:
+		return "unknown"
+	}
+}
+
+// Reconnect policy of the connections to an exchange
+//
+// Failed attempts are retried after an exponential backoff with jitter, capped at MaxDelay.
+// Once MaxRetries attempts failed in a row the circuit opens, and the exchange is probed every ProbeInterval instead.
+// The exchange is never abandoned, and a successful attempt closes the circuit again
+type ReconnectPolicy struct {
+	// Consecutive failed attempts after which the circuit opens. Zero never opens the circuit
+	MaxRetries   int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Factor the delay grows by after each failed attempt
+	Multiplier float64
+	// Fraction of the delay randomized in both directions, e.g. 0.2 spreads a 10s delay over [8s, 12s]
+	Jitter        float64
+	ProbeInterval time.Duration
+}
+
+// Creates the ReconnectPolicy of an exchange from its config, see cmd.Config.Reconnect
+func NewReconnectPolicy(cfg cmd.ReconnectConfig) ReconnectPolicy {
+	return ReconnectPolicy{
+		MaxRetries:    cfg.MaxRetries,
+		InitialDelay:  time.Duration(cfg.InitialDelay) * time.Millisecond,
+		MaxDelay:      time.Duration(cfg.MaxDelay) * time.Millisecond,
+		Multiplier:    cfg.Multiplier,
+		Jitter:        cfg.Jitter,
+		ProbeInterval: time.Duration(cfg.ProbeInterval) * time.Millisecond,
+	}
+}
+
+// Returns the delay before the next attempt after the given number of consecutive failures, and whether the circuit is open
+//
+// random returns a number in [0, 1) to jitter the delay, e.g. rand.Float64
+func (p ReconnectPolicy) Delay(failures int, random func() float64) (time.Duration, bool) {
+	if failures <= 0 {
+		return 0, false
+	}
+
+	open := p.MaxRetries > 0 && failures >= p.MaxRetries
+	delay := float64(p.ProbeInterval)
+	if !open {
+		delay = float64(p.InitialDelay) * math.Pow(max(p.Multiplier, 1), float64(failures-1))
+		if p.MaxDelay > 0 {
+			delay = min(delay, float64(p.MaxDelay))
+		}
+	}
+
+	jitter := min(max(p.Jitter, 0), 1)
+	delay *= 1 + jitter*(2*random()-1)
+	return time.Duration(delay), open
+}
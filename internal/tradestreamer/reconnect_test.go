@@ -0,0 +1,46 @@
+package tradestreamer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicy_Delay(t *testing.T) {
+	policy := ReconnectPolicy{
+		MaxRetries:    5,
+		InitialDelay:  time.Second,
+		MaxDelay:      5 * time.Second,
+		Multiplier:    2,
+		Jitter:        0.2,
+		ProbeInterval: time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		random   float64
+		expected time.Duration
+		open     bool
+	}{
+		{name: "no failures", failures: 0, random: 0.5, expected: 0},
+		{name: "first failure", failures: 1, random: 0.5, expected: time.Second},
+		{name: "grows exponentially", failures: 3, random: 0.5, expected: 4 * time.Second},
+		{name: "capped at max delay", failures: 4, random: 0.5, expected: 5 * time.Second},
+		{name: "jittered down", failures: 2, random: 0, expected: 1600 * time.Millisecond},
+		{name: "jittered up", failures: 2, random: 1, expected: 2400 * time.Millisecond},
+		{name: "circuit open", failures: 5, random: 0.5, expected: time.Minute, open: true},
+		{name: "circuit stays open", failures: 50, random: 0.5, expected: time.Minute, open: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, open := policy.Delay(tt.failures, func() float64 { return tt.random })
+			if delay != tt.expected {
+				t.Errorf("Expected delay %s, got %s", tt.expected, delay)
+			}
+			if open != tt.open {
+				t.Errorf("Expected circuit open %v, got %v", tt.open, open)
+			}
+		})
+	}
+}
@@ -4,87 +4,741 @@ import (
 	"context"
 	"fmt"
 	"hermeneutic-candles/cmd"
+	"hermeneutic-candles/internal/clock"
 	"hermeneutic-candles/internal/exchange"
-	"log"
+	"hermeneutic-candles/internal/metrics"
+	"hermeneutic-candles/internal/tracing"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Liveness of the connection to an exchange
+type Status struct {
+	Exchange  string
+	Connected bool
+	State     ConnectionState
+	// Consecutive failed connection attempts
+	Failures int
+	// Time of the next connection attempt. Zero unless waiting to reconnect
+	NextAttempt time.Time
+	// Time of the last message received from the exchange. Zero if no message was received yet
+	LastMessage time.Time
+	// Time of the last trade received from the exchange, on the clock of its hub. Zero if no trade was received yet.
+	// Unlike messages, which include heartbeats, pongs and acknowledgements, only trades show the exchange delivers data
+	LastTrade time.Time
+}
+
+// TradeStreamer streams trades of a symbol set from an exchange
+//
+// Symbol sets over the limits of the adapter, see exchange.SubscriptionLimiter, are split into shards.
+// Each shard is streamed over its own connection, and reconnects and checks its liveness independently of the others.
+// Connections are reconnected with the ReconnectPolicy of the exchange
 type TradeStreamer struct {
+	name       string
+	logger     *slog.Logger
+	newAdapter func() exchange.ExchangeAdapter
+	limits     exchange.SubscriptionLimits
+	policy     ReconnectPolicy
+	onGap      func(from, to time.Time)
+	onRejected func(rejections []exchange.Rejection)
+	onState    func(status Status)
+	onMessage  func(received time.Time, message []byte)
+	clock      clock.Clock
+
+	mu sync.Mutex
+	// State of the exchange last reported to the state handler
+	reportedState ConnectionState
+	// Shards of the symbol set. The first shard is kept even when it has no symbols
+	shards      []*shard
+	nextShardID int
+	// State of the running StreamTrades, nil while not streaming
+	streamCtx context.Context
+	streamWg  *sync.WaitGroup
+}
+
+// Part of the symbol set streamed over a single connection
+type shard struct {
+	id      int
 	adapter exchange.ExchangeAdapter
+	logger  *slog.Logger
+	// Time of the last message received from the exchange
+	lastMessageTs atomic.Value
+
+	// Fields below are guarded by the lock of the TradeStreamer
+	// Symbol key -> symbol subscribed on the next connect
+	symbols map[string]exchange.SymbolPair
+	// Keys of the symbols rejected by the exchange since the last connect
+	rejected map[string]bool
+	state    ConnectionState
+	// Consecutive failed connection attempts, and the time of the next attempt while waiting to reconnect
+	failures    int
+	nextAttempt time.Time
+	// Earliest time of the next subscribe or unsubscribe message within the message rate of the exchange
+	nextMessage time.Time
+	// Subscription updates waiting to be sent over the current connection, see sendUpdates
+	pending []subscriptionUpdate
+	// Signals the sender of the current connection that updates are pending
+	wake chan struct{}
+	// Stops the stream of the shard, nil while not streaming
+	cancel context.CancelFunc
+}
+
+// Symbols to subscribe to and unsubscribe from over the connection of a shard
+type subscriptionUpdate struct {
+	add    []exchange.SymbolPair
+	remove []exchange.SymbolPair
+}
+
+// Creates a new TradeStreamer streaming the first shard with adapter
+//
+// newAdapter creates the adapters of the other shards, once the symbols exceed the connection limit of adapter.
+// When it is nil, every symbol is subscribed over the connection of adapter
+func NewTradeStreamer(adapter exchange.ExchangeAdapter, newAdapter func() exchange.ExchangeAdapter) *TradeStreamer {
+	var limits exchange.SubscriptionLimits
+	if limiter, ok := adapter.(exchange.SubscriptionLimiter); ok {
+		limits = limiter.SubscriptionLimits()
+	}
+
+	ts := &TradeStreamer{
+		name:       adapter.Name(),
+		logger:     slog.With("exchange", adapter.Name()),
+		newAdapter: newAdapter,
+		limits:     limits,
+		policy:     NewReconnectPolicy(cmd.GetConfig().Reconnect(adapter.Name())),
+		clock:      clock.Real(),
+	}
+	ts.addShardLocked(adapter)
+	return ts
+}
+
+// Registers a handler that is called once a connection is re-established,
+// with the period between the last message received and the reconnection
+//
+// Must be called before StreamTrades
+func (ts *TradeStreamer) OnGap(handler func(from, to time.Time)) {
+	ts.onGap = handler
+}
+
+// Registers a handler that is called with the symbols the exchange rejected, e.g. unknown pairs
+//
+// The rejected symbols are dropped from the subscription before the handler is called.
+// Must be called before StreamTrades
+func (ts *TradeStreamer) OnRejected(handler func(rejections []exchange.Rejection)) {
+	ts.onRejected = handler
+}
+
+// Registers a handler that is called with the status of the exchange whenever its state changes,
+// e.g. when it connects, loses its connection or its circuit opens
+//
+// Must be called before StreamTrades
+func (ts *TradeStreamer) OnStateChange(handler func(status Status)) {
+	ts.onState = handler
+}
+
+// Registers a handler that is called with every message received from the exchange, before the adapter handles it
+//
+// The handler is called from the goroutines reading the connections, and must not block.
+// Must be called before StreamTrades
+func (ts *TradeStreamer) OnMessage(handler func(received time.Time, message []byte)) {
+	ts.onMessage = handler
+}
+
+// Sets the clock the connections are timed on, i.e. their reconnect delays, liveness checks and message timestamps.
+// It is passed on to the adapters that implement exchange.ClockSetter
+//
+// The streamer never releases the events of a clock.Holder, which must not be used.
+// Must be called before StreamTrades, the default is the wall clock
+func (ts *TradeStreamer) SetClock(c clock.Clock) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.clock = c
+	for _, s := range ts.shards {
+		if setter, ok := s.adapter.(exchange.ClockSetter); ok {
+			setter.SetClock(c)
+		}
+	}
 }
 
-func NewTradeStreamer(adapter exchange.ExchangeAdapter) *TradeStreamer {
-	return &TradeStreamer{adapter: adapter}
+// Must be called with the lock held
+func (ts *TradeStreamer) addShardLocked(adapter exchange.ExchangeAdapter) *shard {
+	s := &shard{
+		id:       ts.nextShardID,
+		adapter:  adapter,
+		logger:   ts.logger.With("shard", ts.nextShardID),
+		symbols:  map[string]exchange.SymbolPair{},
+		rejected: map[string]bool{},
+		wake:     make(chan struct{}, 1),
+	}
+	if setter, ok := adapter.(exchange.ClockSetter); ok {
+		setter.SetClock(ts.clock)
+	}
+	if acknowledger, ok := adapter.(exchange.SubscriptionAcknowledger); ok {
+		acknowledger.OnRejected(func(rejections []exchange.Rejection) {
+			ts.rejected(s, rejections)
+		})
+	}
+	ts.nextShardID++
+	ts.shards = append(ts.shards, s)
+	return s
 }
 
+// Drops the symbols the exchange rejected from the shard, so they are not subscribed again on reconnect
+func (ts *TradeStreamer) rejected(s *shard, rejections []exchange.Rejection) {
+	ts.mu.Lock()
+	for _, rejection := range rejections {
+		key := rejection.Symbol.Key()
+		delete(s.symbols, key)
+		s.rejected[key] = true
+		s.logger.Warn("Symbol rejected by the exchange", "symbol", key, "reason", rejection.Reason)
+	}
+	ts.mu.Unlock()
+
+	// The handler is called without the lock, so it may update the symbols
+	if ts.onRejected != nil {
+		ts.onRejected(rejections)
+	}
+}
+
+// Returns the shard a symbol is subscribed on, nil if it is not subscribed
+// Must be called with the lock held
+func (ts *TradeStreamer) shardOfLocked(key string) *shard {
+	for _, s := range ts.shards {
+		if _, ok := s.symbols[key]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Returns the first shard with room for another symbol, adding a shard if every shard is full
+// Must be called with the lock held
+func (ts *TradeStreamer) shardWithRoomLocked() *shard {
+	limit := ts.limits.SymbolsPerConnection
+	if limit <= 0 || ts.newAdapter == nil {
+		return ts.shards[0]
+	}
+	for _, s := range ts.shards {
+		if len(s.symbols) < limit {
+			return s
+		}
+	}
+	s := ts.addShardLocked(ts.newAdapter())
+	ts.logger.Info("Symbols exceed the connection limit, adding a shard", "shard", s.id, "limit", limit)
+	return s
+}
+
+// Adds and removes symbols from the subscription
+//
+// Added symbols are assigned to the first shard with room for them.
+// While a shard is connected, its changes are queued as incremental subscribe and unsubscribe messages over its connection,
+// which are sent in the background within the message rate of the adapter, see sendUpdates.
+// Otherwise they are applied on its next connect. Shards other than the first are closed once they have no symbols left
+func (ts *TradeStreamer) UpdateSymbols(add []exchange.SymbolPair, remove []exchange.SymbolPair) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	added := map[*shard][]exchange.SymbolPair{}
+	for _, symbol := range add {
+		key := symbol.Key()
+		if ts.shardOfLocked(key) != nil {
+			continue
+		}
+		s := ts.shardWithRoomLocked()
+		s.symbols[key] = symbol
+		added[s] = append(added[s], symbol)
+	}
+	removed := map[*shard][]exchange.SymbolPair{}
+	for _, symbol := range remove {
+		key := symbol.Key()
+		s := ts.shardOfLocked(key)
+		if s == nil {
+			continue
+		}
+		delete(s.symbols, key)
+		removed[s] = append(removed[s], symbol)
+	}
+
+	for _, s := range slices.Clone(ts.shards) {
+		if s != ts.shards[0] && len(s.symbols) == 0 {
+			ts.removeShardLocked(s)
+			continue
+		}
+		if s.state != StateConnected {
+			ts.startShardLocked(s)
+			continue
+		}
+		ts.queueUpdateLocked(s, subscriptionUpdate{add: added[s], remove: removed[s]})
+	}
+}
+
+// Queues the update to be sent over the current connection of the shard
+// Must be called with the lock held
+func (ts *TradeStreamer) queueUpdateLocked(s *shard, update subscriptionUpdate) {
+	if len(update.add) == 0 && len(update.remove) == 0 {
+		return
+	}
+	s.pending = append(s.pending, update)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Closes the connection of the shard and removes it
+// Must be called with the lock held
+func (ts *TradeStreamer) removeShardLocked(s *shard) {
+	s.logger.Info("No symbols left, closing shard")
+	if s.cancel != nil {
+		s.cancel()
+	}
+	ts.shards = slices.DeleteFunc(ts.shards, func(other *shard) bool {
+		return other == s
+	})
+}
+
+// Goroutine sending the queued subscription updates of the shard over its current connection, until ctx is canceled
+//
+// Updates are sent in the order they were queued, so the messages are paced without holding the lock,
+// and neither UpdateSymbols nor its callers wait for the message rate of the adapter
+func (ts *TradeStreamer) sendUpdates(ctx context.Context, s *shard) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+
+		ts.mu.Lock()
+		updates := s.pending
+		s.pending = nil
+		ts.mu.Unlock()
+
+		for _, update := range updates {
+			s.logger.Debug("Updating subscription", "add", exchange.SymbolKeys(update.add), "remove", exchange.SymbolKeys(update.remove))
+			if err := ts.sendBatches(ctx, s, update.add, s.adapter.Subscribe); err != nil {
+				s.logger.Error("Failed to subscribe to symbols", "symbols", exchange.SymbolKeys(update.add), "error", err)
+				metrics.MessageErrors.WithLabelValues(ts.name).Inc()
+			}
+			if err := ts.sendBatches(ctx, s, update.remove, s.adapter.Unsubscribe); err != nil {
+				s.logger.Error("Failed to unsubscribe from symbols", "symbols", exchange.SymbolKeys(update.remove), "error", err)
+				metrics.MessageErrors.WithLabelValues(ts.name).Inc()
+			}
+		}
+	}
+}
+
+// Sends the symbols over the connection of the shard in batches within the message limits of the adapter
+func (ts *TradeStreamer) sendBatches(ctx context.Context, s *shard, symbols []exchange.SymbolPair, send func([]exchange.SymbolPair) error) error {
+	for _, batch := range batches(symbols, ts.limits.SymbolsPerMessage) {
+		if len(batch) == 0 {
+			continue
+		}
+		if err := ts.pace(ctx, s); err != nil {
+			return err
+		}
+		if err := send(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waits until the shard may send its next message within the message rate of the adapter
+// The message is booked with the lock held, and waited for without it. Returns the error of ctx if it is canceled first
+func (ts *TradeStreamer) pace(ctx context.Context, s *shard) error {
+	ts.mu.Lock()
+	wait := ts.bookMessageLocked(s)
+	ts.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	s.logger.Debug("Pacing subscription message", "wait", wait)
+	timer := ts.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Books the next message of the shard within the message rate of the adapter, and returns how long to wait before sending it
+// Must be called with the lock held
+func (ts *TradeStreamer) bookMessageLocked(s *shard) time.Duration {
+	if ts.limits.MessagesPerSecond <= 0 {
+		return 0
+	}
+	now := ts.clock.Now()
+	sendAt := now
+	if s.nextMessage.After(now) {
+		sendAt = s.nextMessage
+	}
+	s.nextMessage = sendAt.Add(time.Second / time.Duration(ts.limits.MessagesPerSecond))
+	return sendAt.Sub(now)
+}
+
+// Splits the symbols into batches of at most size symbols. A size of zero is unlimited
+// Always returns at least one batch, which is empty when symbols is
+func batches(symbols []exchange.SymbolPair, size int) [][]exchange.SymbolPair {
+	if size <= 0 || len(symbols) <= size {
+		return [][]exchange.SymbolPair{symbols}
+	}
+	return slices.Collect(slices.Chunk(symbols, size))
+}
+
+// Returns the liveness of the connections to the exchange
+//
+// The exchange is connected when every shard is connected. Otherwise its state is the state of the shard furthest from connected,
+// i.e. an open circuit, then connecting, then idle. Its last message is the latest of every shard
+func (ts *TradeStreamer) Status() Status {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.statusLocked()
+}
+
+// Must be called with the lock held
+func (ts *TradeStreamer) statusLocked() Status {
+	status := Status{Exchange: ts.name, State: StateConnected}
+	for _, s := range ts.shards {
+		if stateSeverity[s.state] > stateSeverity[status.State] {
+			status.State, status.Failures, status.NextAttempt = s.state, s.failures, s.nextAttempt
+		}
+		if lastMessage, ok := s.lastMessageTs.Load().(time.Time); ok && lastMessage.After(status.LastMessage) {
+			status.LastMessage = lastMessage
+		}
+	}
+	status.Connected = status.State == StateConnected
+	return status
+}
+
+// Order of the states from connected to furthest from connected
+var stateSeverity = map[ConnectionState]int{
+	StateConnected:   0,
+	StateIdle:        1,
+	StateConnecting:  2,
+	StateCircuitOpen: 3,
+}
+
+// Returns the number of shards, i.e. the number of connections used while streaming
+func (ts *TradeStreamer) Shards() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return len(ts.shards)
+}
+
+// Returns the symbols subscribed on the next connect
+func (ts *TradeStreamer) Symbols() []exchange.SymbolPair {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var symbols []exchange.SymbolPair
+	for _, s := range ts.shards {
+		symbols = append(symbols, s.symbolsLocked()...)
+	}
+	slices.SortFunc(symbols, func(a, b exchange.SymbolPair) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+	return symbols
+}
+
+// Must be called with the lock of the TradeStreamer held
+func (s *shard) symbolsLocked() []exchange.SymbolPair {
+	keys := slices.Sorted(maps.Keys(s.symbols))
+	symbols := make([]exchange.SymbolPair, 0, len(keys))
+	for _, key := range keys {
+		symbols = append(symbols, s.symbols[key])
+	}
+	return symbols
+}
+
+// Connects to the exchange and streams trades of the given symbols, in addition to the symbols added with UpdateSymbols
+//
+// Every shard is streamed over its own connection, and reconnects with the ReconnectPolicy of the exchange when its connection is lost.
+// Blocks until the context is canceled, a failing exchange is never abandoned.
+// The first connections are traced as part of the trace in parent, and reconnections in new traces linked to it
 func (ts *TradeStreamer) StreamTrades(parent context.Context, symbols []exchange.SymbolPair) error {
-	cfg := cmd.GetConfig()
-	connectionMaxRetries := cfg.WSConnectionMaxRetries
+	ts.UpdateSymbols(symbols, nil)
 
 	// Create a context that cancels on interrupt signal
 	ctx, cancel := signal.NotifyContext(parent, os.Interrupt)
 	defer cancel()
 
-	retries := 0
-	for retries = range connectionMaxRetries {
-		if retries > 0 {
-			delay := time.Duration(retries) * time.Second
-			log.Printf("Reconnecting in %v... (attempt %d/%d)", delay, retries+1, connectionMaxRetries)
+	var wg sync.WaitGroup
+
+	ts.mu.Lock()
+	ts.streamCtx, ts.streamWg = ctx, &wg
+	for _, s := range ts.shards {
+		ts.startShardLocked(s)
+	}
+	ts.mu.Unlock()
+
+	<-ctx.Done()
 
+	// Wait for the shards to release their connections
+	ts.mu.Lock()
+	ts.streamCtx, ts.streamWg = nil, nil
+	ts.mu.Unlock()
+	wg.Wait()
+
+	ts.mu.Lock()
+	for _, s := range ts.shards {
+		s.cancel = nil
+	}
+	ts.mu.Unlock()
+	return fmt.Errorf("%s: %w", ts.name, ctx.Err())
+}
+
+// Starts the stream of the shard if StreamTrades is running and the shard is not streaming yet
+// Must be called with the lock held
+func (ts *TradeStreamer) startShardLocked(s *shard) {
+	if ts.streamCtx == nil || s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ts.streamCtx)
+	s.cancel = cancel
+	wg := ts.streamWg
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer cancel()
+
+		ts.streamShard(ctx, s)
+		ts.setState(s, StateIdle, 0, time.Time{})
+	}()
+}
+
+// Connects the shard and reconnects it when the connection is lost or connecting fails
+// Blocks until the context is canceled
+func (ts *TradeStreamer) streamShard(ctx context.Context, s *shard) {
+	cfg := cmd.GetConfig()
+
+	for failures := 0; ; {
+		if failures > 0 {
+			delay, open := ts.policy.Delay(failures, rand.Float64)
+			state := StateConnecting
+			if open {
+				state = StateCircuitOpen
+			}
+			if ts.setState(s, state, failures, ts.clock.Now().Add(delay)) != state && open {
+				s.logger.Error("Circuit open, probing the exchange at the probe interval", "failures", failures, "probe_interval", ts.policy.ProbeInterval)
+				metrics.CircuitOpens.WithLabelValues(ts.name).Inc()
+			}
+			s.logger.Info("Reconnecting", "delay", delay, "attempt", failures+1, "state", state.String())
+			metrics.ReconnectAttempts.WithLabelValues(ts.name).Inc()
+
+			timer := ts.clock.NewTimer(delay)
 			select {
-			case <-time.After(delay):
+			case <-timer.C():
 			case <-ctx.Done():
-				return ctx.Err()
+				timer.Stop()
+				return
 			}
+		} else {
+			ts.setState(s, StateConnecting, 0, time.Time{})
+		}
+
+		spanOptions := []trace.SpanStartOption{trace.WithAttributes(
+			attribute.String("exchange", ts.name),
+			attribute.Int("shard", s.id),
+			attribute.Int("attempt", failures+1),
+		)}
+		if s.lastMessageTs.Load() != nil {
+			spanOptions = append(spanOptions, trace.WithNewRoot(), trace.WithLinks(trace.LinkFromContext(ctx)))
 		}
+		connCtx, span := tracing.Tracer().Start(ctx, "TradeStreamer.connection", spanOptions...)
 
-		c, err := ts.adapter.ConnectAndSubscribe(symbols)
+		c, err := ts.connect(connCtx, s)
 		if err != nil {
-			log.Printf("Failed to connect (attempt %d/%d): %v", retries+1, connectionMaxRetries, err)
+			failures++
+			s.logger.Warn("Failed to connect", "attempt", failures, "error", err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			if ctx.Err() != nil {
+				return
+			}
 			continue
 		}
+		metrics.ExchangeConnections.WithLabelValues(ts.name).Inc()
 
-		// Connection successful, reset retry counter
-		retries = 0
+		// Trades between the last message and now were missed
+		if lastMessage, ok := s.lastMessageTs.Load().(time.Time); ok && ts.onGap != nil {
+			ts.onGap(lastMessage, ts.clock.Now())
+		}
 
 		// Handle the connection
 		// This will block until the connection is closed or an error occurs
-		err = ts.handleConnection(ctx, cfg, c)
+		err = ts.handleConnection(connCtx, cfg, s, c)
 		c.Close()
+		metrics.ExchangeConnections.WithLabelValues(ts.name).Dec()
+		span.End()
+
+		// If context was canceled, don't retry
+		if ctx.Err() != nil {
+			return
+		}
 
-		// If context was canceled, don't retry and don't return an error
+		// The lost connection counts as a failure, so the next attempt waits for the initial delay
+		s.logger.Warn("Connection lost", "error", err)
+		failures = 1
+	}
+}
+
+// Connects the shard and subscribes to its current symbols, in batches within the message limit of the adapter
+// Symbols updated while connecting are queued incrementally once connected.
+// The acknowledgement of the first batch is waited for with adapters that implement exchange.SubscriptionAcknowledger.
+// The messages read while waiting are handled like the messages of the connection, see handleMessage
+func (ts *TradeStreamer) connect(ctx context.Context, s *shard) (*websocket.Conn, error) {
+	ts.mu.Lock()
+	symbols := s.symbolsLocked()
+	clear(s.rejected)
+	// Updates left from the previous connection are covered by the symbols subscribed on connect
+	s.pending = nil
+	ts.mu.Unlock()
+
+	_, span := tracing.Tracer().Start(ctx, "ExchangeAdapter.ConnectAndSubscribe", trace.WithAttributes(
+		attribute.String("exchange", ts.name),
+		attribute.Int("shard", s.id),
+		attribute.StringSlice("symbols", exchange.SymbolKeys(symbols)),
+	))
+	defer span.End()
+
+	symbolBatches := batches(symbols, ts.limits.SymbolsPerMessage)
+	if err := ts.pace(ctx, s); err != nil {
+		return nil, err
+	}
+	c, err := s.adapter.ConnectAndSubscribe(symbolBatches[0])
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if acknowledger, ok := s.adapter.(exchange.SubscriptionAcknowledger); ok {
+		err := acknowledger.WaitForAcks(c, func(message []byte) {
+			ts.handleMessage(s, message)
+		})
 		if err != nil {
-			return fmt.Errorf("%s: %w", ts.adapter.Name(), err)
+			span.SetStatus(codes.Error, err.Error())
+			c.Close()
+			return nil, err
 		}
+	}
+	for _, batch := range symbolBatches[1:] {
+		err := ts.pace(ctx, s)
+		if err == nil {
+			err = s.adapter.Subscribe(batch)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			c.Close()
+			return nil, err
+		}
+	}
+	s.logger.Info("Connected", "symbols", exchange.SymbolKeys(symbols))
 
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("%s: %w", ts.adapter.Name(), ctx.Err())
-		default:
-			log.Printf("Connection to %s lost: %v", ts.adapter.Name(), err)
+	ts.mu.Lock()
+	s.state, s.failures, s.nextAttempt = StateConnected, 0, time.Time{}
+
+	var add, remove []exchange.SymbolPair
+	subscribed := map[string]bool{}
+	for _, symbol := range symbols {
+		subscribed[symbol.Key()] = true
+		// Symbols rejected while connecting were never subscribed
+		if _, ok := s.symbols[symbol.Key()]; !ok && !s.rejected[symbol.Key()] {
+			remove = append(remove, symbol)
+		}
+	}
+	for key, symbol := range s.symbols {
+		if !subscribed[key] {
+			add = append(add, symbol)
 		}
 	}
+	ts.queueUpdateLocked(s, subscriptionUpdate{add: add, remove: remove})
+	status, changed := ts.stateChangeLocked()
+	ts.mu.Unlock()
+
+	if changed {
+		ts.reportState(status)
+	}
+	return c, nil
+}
+
+// Sets the state of the shard, and returns its previous state
+func (ts *TradeStreamer) setState(s *shard, state ConnectionState, failures int, nextAttempt time.Time) ConnectionState {
+	ts.mu.Lock()
+	previous := s.state
+	s.state, s.failures, s.nextAttempt = state, failures, nextAttempt
+	status, changed := ts.stateChangeLocked()
+	ts.mu.Unlock()
+
+	if changed {
+		ts.reportState(status)
+	}
+	return previous
+}
 
-	return fmt.Errorf("failed to establish stable connection to %s after %d attempts", ts.adapter.Name(), connectionMaxRetries)
+// Returns the status of the exchange, and whether its state changed since it was last reported
+// Must be called with the lock held
+func (ts *TradeStreamer) stateChangeLocked() (Status, bool) {
+	status := ts.statusLocked()
+	if status.State == ts.reportedState {
+		return status, false
+	}
+	ts.reportedState = status.State
+	return status, true
 }
 
-func (ts *TradeStreamer) handleConnection(ctx context.Context, cfg *cmd.Config, c *websocket.Conn) error {
+// Must be called without the lock held, so the handler may read the status
+func (ts *TradeStreamer) reportState(status Status) {
+	ts.logger.Debug("Connection state changed", "state", status.State.String(), "failures", status.Failures)
+	if ts.onState != nil {
+		ts.onState(status)
+	}
+}
+
+func (ts *TradeStreamer) handleConnection(ctx context.Context, cfg *cmd.Config, s *shard, c *websocket.Conn) error {
+	ctx, span := tracing.Tracer().Start(ctx, "TradeStreamer.handleConnection", trace.WithAttributes(
+		attribute.String("exchange", ts.name),
+		attribute.Int("shard", s.id),
+	))
+	defer span.End()
+
 	var wg sync.WaitGroup
 	// Channel to signal when connection should be terminated or retried
 	done := make(chan error, 1)
 
-	var lastTs atomic.Value
-	lastTs.Store(time.Now())
+	s.lastMessageTs.Store(ts.clock.Now())
+
+	// The sender stops with the connection, unlike the goroutines below, which stop once it fails
+	sendCtx, stopSending := context.WithCancel(ctx)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		ts.sendUpdates(sendCtx, s)
+	}()
+	defer func() {
+		stopSending()
+		<-sent
+	}()
 
 	wg.Add(2)
-	go ts.handleMessages(c, &lastTs, done, &wg)
-	go ts.checkLiveness(cfg, &lastTs, done, &wg)
+	go ts.handleMessages(span, s, c, done, &wg)
+	go ts.checkLiveness(cfg, s, done, &wg)
 
 	// Wait for all goroutines to finish to close the channel
 	go func() {
@@ -96,19 +750,25 @@ func (ts *TradeStreamer) handleConnection(ctx context.Context, cfg *cmd.Config,
 		select {
 		case <-ctx.Done():
 			// Close the connection gracefully
-			log.Printf("Closing connection due to context cancellation")
+			s.logger.Info("Closing connection due to context cancellation")
+			// The sender stops with ctx, and must not write concurrently
+			<-sent
 			c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 			return ctx.Err()
 		case err := <-done:
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
 			return err
 		}
 	}
 }
 
 // Goroutine to handle the incoming messages from the WebSocket connection
-func (ts *TradeStreamer) handleMessages(c *websocket.Conn, lastTs *atomic.Value, done chan<- error, wg *sync.WaitGroup) {
+// The first message is recorded as an event of the connection's span
+func (ts *TradeStreamer) handleMessages(span trace.Span, s *shard, c *websocket.Conn, done chan<- error, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for {
+	for first := true; ; first = false {
 		_, message, err := c.ReadMessage()
 		if err != nil {
 			select {
@@ -119,33 +779,68 @@ func (ts *TradeStreamer) handleMessages(c *websocket.Conn, lastTs *atomic.Value,
 			return
 		}
 
-		lastTs.Store(time.Now())
-		err = ts.adapter.HandleMessage(message)
-		if err != nil {
-			log.Printf("Failed to handle message: %v", err)
-			continue
+		if first {
+			span.AddEvent("first message")
 		}
+		ts.handleMessage(s, message)
 	}
 }
 
+// Passes a message received from the exchange to the message handler and to the adapter of the shard
+func (ts *TradeStreamer) handleMessage(s *shard, message []byte) {
+	received := ts.clock.Now()
+	s.lastMessageTs.Store(received)
+	if ts.onMessage != nil {
+		ts.onMessage(received, message)
+	}
+	if err := s.adapter.HandleMessage(message); err != nil {
+		s.logger.Warn("Failed to handle message", "error", err)
+		metrics.MessageErrors.WithLabelValues(ts.name).Inc()
+	}
+}
+
+// Default interval between liveness checks, and time to wait for a pong after sending a ping
+const (
+	livenessCheckInterval = 10 * time.Second
+	pongTimeout           = 10 * time.Second
+)
+
 // Goroutine to periodically check the liveness of the connection
 // If no message is received within the configured timeout,
 // it sends a ping and waits for a pong response
-func (ts *TradeStreamer) checkLiveness(cfg *cmd.Config, lastTs *atomic.Value, done chan<- error, wg *sync.WaitGroup) {
+//
+// Adapters that implement exchange.PingIntervalProvider are pinged at the interval provided by the exchange instead,
+// whether or not messages are received
+func (ts *TradeStreamer) checkLiveness(cfg *cmd.Config, s *shard, done chan<- error, wg *sync.WaitGroup) {
 	defer wg.Done()
-	ticker := time.NewTicker(10 * time.Second)
+
+	interval, timeout, pingAlways := livenessCheckInterval, pongTimeout, false
+	if provider, ok := s.adapter.(exchange.PingIntervalProvider); ok {
+		if providedInterval, providedTimeout := provider.PingInterval(); providedInterval > 0 {
+			interval, pingAlways = providedInterval, true
+			if providedTimeout > 0 {
+				timeout = providedTimeout
+			}
+			s.logger.Debug("Pinging at the interval provided by the exchange", "interval", interval, "timeout", timeout)
+		}
+	}
+
+	ticker := ts.clock.NewTimer(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		tsAtomic := lastTs.Load()
+	for range ticker.C() {
+		// The timer is reset as it fires, so it keeps the pace of a ticker while waiting for a pong
+		ticker.Reset(interval)
+
+		tsAtomic := s.lastMessageTs.Load()
 		timestamp, ok := tsAtomic.(time.Time)
 		if !ok {
 			continue
 		}
 
-		if time.Since(timestamp) > time.Duration(cfg.WSConnectionTimeout)*time.Millisecond {
-			log.Printf("No message in %dms, sending ping", cfg.WSConnectionTimeout)
-			if err := ts.adapter.Ping(); err != nil {
+		if pingAlways || ts.clock.Now().Sub(timestamp) > time.Duration(cfg.WSConnectionTimeout)*time.Millisecond {
+			s.logger.Debug("Sending ping", "timeout_ms", cfg.WSConnectionTimeout)
+			if err := s.adapter.Ping(); err != nil {
 				select {
 				case done <- err:
 				default:
@@ -157,11 +852,14 @@ func (ts *TradeStreamer) checkLiveness(cfg *cmd.Config, lastTs *atomic.Value, do
 			continue
 		}
 
+		pongTimer := ts.clock.NewTimer(timeout)
 		select {
-		case <-ts.adapter.GetPongChan():
+		case <-s.adapter.GetPongChan():
+			pongTimer.Stop()
 			continue
-		case <-time.After(10 * time.Second):
-			log.Printf("Pong not received after 10 seconds of sending a ping. Reconnect.")
+		case <-pongTimer.C():
+			s.logger.Warn("Pong not received after sending a ping, reconnecting", "timeout", timeout)
+			metrics.PongTimeouts.WithLabelValues(ts.name).Inc()
 			select {
 			case done <- nil:
 			default:
@@ -6,47 +6,31 @@ import (
 	"errors"
 	"hermeneutic-candles/cmd"
 	"hermeneutic-candles/internal/exchange"
+	fakeclock "hermeneutic-candles/tests/fake_clock"
 	tests "hermeneutic-candles/tests/mock_servers"
 	"sync"
 	"testing"
 	"time"
 )
 
-// TODO:
-// The test is not perfect, it is a primitive way to test the TradeStreamer.
-// Ideally we have testing helpers to poll / wait for messages to be sent or received
-// So we don't have to set time.Sleep()s when we want to make assertions
-
-// Also only happy paths are tested. We can also add tests for connection errors, etc.
-
-func setupWSServer(t *testing.T) *tests.MockWebSocketServer {
-	// Get config (it will be initialized automatically)
+func TestTradeStreamer_StreamTrades(t *testing.T) {
 	cfg := cmd.GetConfig()
-	// Override for testing
 	cfg.WSConnectionMaxRetries = 3
-	cfg.WSConnectionTimeout = 5000 // 5 seconds
+	cfg.WSConnectionTimeout = 5000
 
-	// Start mock WebSocket server
-	mockServer := tests.NewMockWebSocketServer(":18080")
-	go func() {
-		if err := mockServer.Start(); err != nil {
-			t.Logf("Mock server error: %v", err)
-		}
-	}()
-	return mockServer
-}
-
-func TestTradeStreamer_StreamTrades(t *testing.T) {
-	mockServer := setupWSServer(t)
-	defer mockServer.Stop()
-
-	// Primitive way to wait for server to start. Can improve next time
-	time.Sleep(100 * time.Millisecond)
+	mockServer := startMockServer(t, ":18080")
 
 	// Set up entities
 	tradeChannel := make(chan exchange.Trade, 100)
 	adapter := NewMockExchangeAdapter("MockExchange", "ws://localhost:18080/ws", tradeChannel)
-	streamer := NewTradeStreamer(adapter)
+	streamer := NewTradeStreamer(adapter, nil)
+	clock := fakeclock.New(time.UnixMilli(1753453611000))
+	streamer.SetClock(clock)
+
+	states := make(chan Status, 10)
+	streamer.OnStateChange(func(status Status) {
+		states <- status
+	})
 
 	symbols := []exchange.SymbolPair{
 		{First: "btc", Second: "usdt"},
@@ -65,14 +49,17 @@ func TestTradeStreamer_StreamTrades(t *testing.T) {
 		streamErr = streamer.StreamTrades(ctx, symbols)
 	}()
 
-	// Primitive way to wait for connection to establish
-	time.Sleep(500 * time.Millisecond)
+	nextState(t, states, StateConnecting)
+	nextState(t, states, StateConnected)
 
 	// Check that client connected to mock server
 	if mockServer.GetConnectedClients() == 0 {
 		t.Fatal("No clients connected to mock server")
 	}
 
+	// Messages are timed on the clock of the streamer
+	clock.Advance(time.Second)
+
 	// Send mock trade data
 	tradeData1 := map[string]interface{}{
 		"symbol":    "BTCUSDT",
@@ -96,12 +83,9 @@ func TestTradeStreamer_StreamTrades(t *testing.T) {
 	mockServer.SendMessage(trade1Bytes)
 	mockServer.SendMessage(trade2Bytes)
 
-	// Primitive way to wait for trades to be processed
-	time.Sleep(200 * time.Millisecond)
-
 	// Collect received trades
 	var receivedTrades []exchange.Trade
-	timeout := time.After(2 * time.Second)
+	timeout := time.After(5 * time.Second)
 
 collectTrades:
 	for len(receivedTrades) < 2 {
@@ -140,6 +124,9 @@ collectTrades:
 	if ethTrade.Quantity != 1.0 {
 		t.Errorf("Expected quantity 1.0, got %f", ethTrade.Quantity)
 	}
+	if lastMessage := streamer.Status().LastMessage; !lastMessage.Equal(clock.Now()) {
+		t.Errorf("Expected the last message at %v, got %v", clock.Now(), lastMessage)
+	}
 
 	cancel()
 	wg.Wait()
@@ -151,3 +138,387 @@ collectTrades:
 
 	t.Logf("Test completed successfully. Received %d trades", len(receivedTrades))
 }
+
+// Mock adapter of an exchange that limits the symbols of a connection and a subscribe message
+type limitedMockAdapter struct {
+	*MockExchangeAdapter
+	limits exchange.SubscriptionLimits
+}
+
+func (m *limitedMockAdapter) SubscriptionLimits() exchange.SubscriptionLimits {
+	return m.limits
+}
+
+func TestTradeStreamer_Shards(t *testing.T) {
+	cfg := cmd.GetConfig()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+
+	mockServer := startMockServer(t, ":18083")
+
+	tradeChannel := make(chan exchange.Trade, 100)
+	newAdapter := func() exchange.ExchangeAdapter {
+		return &limitedMockAdapter{
+			MockExchangeAdapter: NewMockExchangeAdapter("MockExchange", "ws://localhost:18083/ws", tradeChannel),
+			limits:              exchange.SubscriptionLimits{SymbolsPerConnection: 2, SymbolsPerMessage: 1},
+		}
+	}
+	streamer := NewTradeStreamer(newAdapter(), newAdapter)
+	streamer.SetClock(fakeclock.New(time.UnixMilli(1753453611000)))
+	states := make(chan Status, 100)
+	streamer.OnStateChange(func(status Status) {
+		states <- status
+	})
+
+	var symbols []exchange.SymbolPair
+	for _, first := range []string{"ada", "btc", "eth", "sol", "xrp"} {
+		symbols = append(symbols, exchange.SymbolPair{First: first, Second: "usdt"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamer.StreamTrades(ctx, symbols)
+	}()
+
+	// 5 symbols at 2 per connection are streamed over 3 shards
+	waitConnected(t, states)
+	waitForMessages(t, mockServer, 2)
+	if shards := streamer.Shards(); shards != 3 {
+		t.Fatalf("Expected 3 shards, got %d", shards)
+	}
+	if clients := mockServer.GetConnectedClients(); clients != 3 {
+		t.Fatalf("Expected 3 upstream connections, got %d", clients)
+	}
+	if !streamer.Status().Connected {
+		t.Errorf("Expected every shard to be connected")
+	}
+	// The first symbol of a shard is subscribed on connect, and the second in its own subscribe message
+	if messages := mockServer.GetAllMessages(); len(messages) != 2 {
+		t.Errorf("Expected 2 subscribe messages, got %v", messages)
+	}
+
+	// The second shard has no symbols left and is closed
+	streamer.UpdateSymbols(nil, symbols[2:4])
+	waitForClients(t, mockServer, 2)
+	if shards := streamer.Shards(); shards != 2 {
+		t.Errorf("Expected 2 shards after removing symbols, got %d", shards)
+	}
+	if clients := mockServer.GetConnectedClients(); clients != 2 {
+		t.Errorf("Expected 2 upstream connections after removing symbols, got %d", clients)
+	}
+	if symbols := streamer.Symbols(); len(symbols) != 3 {
+		t.Errorf("Expected 3 symbols, got %d", len(symbols))
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestTradeStreamer_Pacing(t *testing.T) {
+	cfg := cmd.GetConfig()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+
+	mockServer := startMockServer(t, ":18087")
+
+	tradeChannel := make(chan exchange.Trade, 100)
+	adapter := &limitedMockAdapter{
+		MockExchangeAdapter: NewMockExchangeAdapter("MockExchange", "ws://localhost:18087/ws", tradeChannel),
+		limits:              exchange.SubscriptionLimits{SymbolsPerMessage: 1, MessagesPerSecond: 10},
+	}
+	streamer := NewTradeStreamer(adapter, nil)
+	clock := fakeclock.New(time.UnixMilli(1753453611000))
+	streamer.SetClock(clock)
+	states := make(chan Status, 10)
+	streamer.OnStateChange(func(status Status) {
+		states <- status
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamer.StreamTrades(ctx, []exchange.SymbolPair{{First: "btc", Second: "usdt"}, {First: "eth", Second: "usdt"}, {First: "sol", Second: "usdt"}})
+	}()
+
+	// The connect is the first message, and each subscribe message waits a tenth of a second after the previous one
+	nextState(t, states, StateConnecting)
+	for sent := 1; sent <= 2; sent++ {
+		waitForTimers(t, clock, 1)
+		if messages := mockServer.GetAllMessages(); len(messages) != sent-1 {
+			t.Fatalf("Expected %d subscribe messages before the pace elapses, got %v", sent-1, messages)
+		}
+		clock.Advance(100 * time.Millisecond)
+		waitForMessages(t, mockServer, sent)
+	}
+	nextState(t, states, StateConnected)
+
+	// Updates are paced in the background, without holding the streamer while they wait
+	streamer.UpdateSymbols([]exchange.SymbolPair{{First: "ada", Second: "usdt"}, {First: "xrp", Second: "usdt"}}, nil)
+	for sent := 3; sent <= 4; sent++ {
+		waitForTimers(t, clock, 1)
+		if !streamer.Status().Connected {
+			t.Errorf("Expected the streamer to stay connected while pacing")
+		}
+		if messages := mockServer.GetAllMessages(); len(messages) != sent-1 {
+			t.Fatalf("Expected %d subscribe messages before the pace elapses, got %v", sent-1, messages)
+		}
+		clock.Advance(100 * time.Millisecond)
+		waitForMessages(t, mockServer, sent)
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestBatches(t *testing.T) {
+	symbols := []exchange.SymbolPair{{First: "btc"}, {First: "eth"}, {First: "sol"}}
+
+	tests := []struct {
+		name     string
+		symbols  []exchange.SymbolPair
+		size     int
+		expected []int
+	}{
+		{"unlimited", symbols, 0, []int{3}},
+		{"within limit", symbols, 3, []int{3}},
+		{"split", symbols, 2, []int{2, 1}},
+		{"empty", nil, 2, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := batches(tt.symbols, tt.size)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d batches, got %d", len(tt.expected), len(result))
+			}
+			for i, expected := range tt.expected {
+				if len(result[i]) != expected {
+					t.Errorf("Expected batch %d of %d symbols, got %d", i, expected, len(result[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestTradeStreamer_CircuitBreaker(t *testing.T) {
+	cfg := cmd.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.WSConnectionMaxRetries = 2
+	cfg.WSReconnectInitialDelay = 10
+	cfg.WSReconnectMaxDelay = 20
+	cfg.WSReconnectJitter = 0
+	cfg.WSCircuitProbeInterval = 200
+
+	// Nothing listens on the port until the exchange recovers
+	tradeChannel := make(chan exchange.Trade, 100)
+	adapter := NewMockExchangeAdapter("MockExchange", "ws://localhost:18085/ws", tradeChannel)
+	streamer := NewTradeStreamer(adapter, nil)
+	clock := fakeclock.New(time.UnixMilli(1753453611000))
+	streamer.SetClock(clock)
+
+	states := make(chan Status, 10)
+	streamer.OnStateChange(func(status Status) {
+		states <- status
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamer.StreamTrades(ctx, []exchange.SymbolPair{{First: "btc", Second: "usdt"}})
+	}()
+
+	// The first attempt fails and waits for the initial delay, the second one opens the circuit
+	nextState(t, states, StateConnecting)
+	waitForTimers(t, clock, 1)
+	clock.Advance(10 * time.Millisecond)
+	status := nextState(t, states, StateCircuitOpen)
+	if status.Connected || status.Failures != 2 || !status.NextAttempt.Equal(clock.Now().Add(200*time.Millisecond)) {
+		t.Errorf("Expected 2 failures and a probe after the probe interval, got %d failures and next attempt %v", status.Failures, status.NextAttempt)
+	}
+
+	// The exchange recovers and the next probe closes the circuit
+	startMockServer(t, ":18085")
+
+	waitForTimers(t, clock, 1)
+	clock.Advance(200 * time.Millisecond)
+	status = nextState(t, states, StateConnected)
+	if !status.Connected || status.Failures != 0 || !status.NextAttempt.IsZero() {
+		t.Errorf("Expected the failures to reset, got %d failures and next attempt %v", status.Failures, status.NextAttempt)
+	}
+
+	cancel()
+	wg.Wait()
+	nextState(t, states, StateIdle)
+	if state := streamer.Status().State; state != StateIdle {
+		t.Errorf("Expected the stream to be idle once canceled, got %s", state)
+	}
+}
+
+func TestTradeStreamer_Liveness(t *testing.T) {
+	cfg := cmd.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.WSConnectionMaxRetries = 3
+	cfg.WSConnectionTimeout = 5000
+	cfg.WSReconnectInitialDelay = 10
+	cfg.WSReconnectJitter = 0
+
+	startMockServer(t, ":18086")
+
+	// The mock adapter never receives a pong
+	tradeChannel := make(chan exchange.Trade, 100)
+	adapter := NewMockExchangeAdapter("MockExchange", "ws://localhost:18086/ws", tradeChannel)
+	streamer := NewTradeStreamer(adapter, nil)
+	start := time.UnixMilli(1753453611000)
+	clock := fakeclock.New(start)
+	streamer.SetClock(clock)
+
+	states := make(chan Status, 10)
+	streamer.OnStateChange(func(status Status) {
+		states <- status
+	})
+	gaps := make(chan [2]time.Time, 1)
+	streamer.OnGap(func(from, to time.Time) {
+		gaps <- [2]time.Time{from, to}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamer.StreamTrades(ctx, []exchange.SymbolPair{{First: "btc", Second: "usdt"}})
+	}()
+
+	nextState(t, states, StateConnecting)
+	nextState(t, states, StateConnected)
+
+	// Without messages past the connection timeout, the next liveness check pings and waits for the pong
+	waitForTimers(t, clock, 1)
+	clock.Advance(livenessCheckInterval)
+	waitForTimers(t, clock, 2)
+	select {
+	case status := <-states:
+		t.Fatalf("Expected the connection to wait for the pong, got state %s", status.State)
+	default:
+	}
+
+	// The pong times out, and the lost connection is reconnected after the initial delay
+	clock.Advance(pongTimeout)
+	status := nextState(t, states, StateConnecting)
+	if status.Failures != 1 || !status.NextAttempt.Equal(clock.Now().Add(10*time.Millisecond)) {
+		t.Errorf("Expected 1 failure and a next attempt after the initial delay, got %d failures and next attempt %v", status.Failures, status.NextAttempt)
+	}
+	waitForTimers(t, clock, 1)
+	clock.Advance(10 * time.Millisecond)
+	nextState(t, states, StateConnected)
+
+	// Trades were missed from the connect, the last time the connection was known to be alive
+	select {
+	case gap := <-gaps:
+		if to := start.Add(livenessCheckInterval + pongTimeout + 10*time.Millisecond); !gap[0].Equal(start) || !gap[1].Equal(to) {
+			t.Errorf("Expected a gap from %v to %v, got %v to %v", start, to, gap[0], gap[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a gap once reconnected")
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+// Returns the next state change reported on states, failing the test unless it is state
+func nextState(t *testing.T, states <-chan Status, state ConnectionState) Status {
+	t.Helper()
+	select {
+	case status := <-states:
+		if status.State != state {
+			t.Fatalf("Expected state %s, got %s", state, status.State)
+		}
+		return status
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected state %s, got no state change", state)
+		return Status{}
+	}
+}
+
+// Waits until a state change on states reports the exchange connected, e.g. once every shard connected
+func waitConnected(t *testing.T, states <-chan Status) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-states:
+			if status.Connected {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the exchange to connect")
+		}
+	}
+}
+
+// Waits until the streamer waits on at least n timers of the clock
+func waitForTimers(t *testing.T, clock *fakeclock.Clock, n int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := clock.WaitForTimers(ctx, n); err != nil {
+		t.Fatalf("Expected %d timers, got %d", n, clock.Timers())
+	}
+}
+
+// Starts a mock server on addr and waits until it listens. The server is stopped once the test ends
+func startMockServer(t *testing.T, addr string) *tests.MockWebSocketServer {
+	t.Helper()
+	mockServer := tests.NewMockWebSocketServer(addr)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- mockServer.Start()
+	}()
+	t.Cleanup(func() { mockServer.Stop() })
+
+	select {
+	case <-mockServer.Listening():
+		return mockServer
+	case err := <-errs:
+		t.Fatalf("Mock server failed to start on %s: %v", addr, err)
+		return nil
+	}
+}
+
+// Waits until n clients are connected to the mock server
+func waitForClients(t *testing.T, mockServer *tests.MockWebSocketServer, n int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mockServer.WaitForClients(ctx, n); err != nil {
+		t.Fatalf("Expected %d upstream connections, got %d", n, mockServer.GetConnectedClients())
+	}
+}
+
+// Waits until the mock server received at least n messages
+func waitForMessages(t *testing.T, mockServer *tests.MockWebSocketServer, n int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mockServer.WaitForMessages(ctx, n); err != nil {
+		t.Fatalf("Expected %d messages, got %v", n, mockServer.GetAllMessages())
+	}
+}
@@ -0,0 +1,142 @@
+// Fake clock for tests, advanced by hand
+//
+// Unlike clock.Virtual, it does not wait for the events it fires to be processed, so it drives code that never
+// releases the clock, e.g. the reconnect delays and liveness checks of a TradeStreamer
+package fakeclock
+
+import (
+	"context"
+	"hermeneutic-candles/internal/clock"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+	// Closed and replaced whenever a timer is started or stopped
+	changed chan struct{}
+}
+
+// Creates a Clock set to start
+func New(start time.Time) *Clock {
+	return &Clock{now: start, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	t := &timer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advances the clock by d, and fires the timers expiring by then in the order of their deadlines
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	slices.SortStableFunc(c.timers, func(a, b *timer) int {
+		return a.deadline.Compare(b.deadline)
+	})
+	i := 0
+	for ; i < len(c.timers) && !c.timers[i].deadline.After(c.now); i++ {
+		// Like a time.Timer, a fired timer does not block when its previous time was not received
+		select {
+		case c.timers[i].c <- c.now:
+		default:
+		}
+	}
+	if i > 0 {
+		c.timers = slices.Delete(c.timers, 0, i)
+		c.changedLocked()
+	}
+}
+
+// Blocks until at least n timers are active, e.g. until the code under test waits on a timer before advancing.
+// Returns the error of ctx if it is done first
+func (c *Clock) WaitForTimers(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		active, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if active >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Returns the number of active timers
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Must be called with the lock held
+func (c *Clock) changedLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+type timer struct {
+	clock    *Clock
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := t.stopLocked()
+	t.deadline = c.now.Add(d)
+	if d <= 0 {
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		return active
+	}
+	c.timers = append(c.timers, t)
+	c.changedLocked()
+	return active
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return t.stopLocked()
+}
+
+// Removes the timer from the active timers, and returns whether it was active
+// Must be called with the lock of the clock held
+func (t *timer) stopLocked() bool {
+	c := t.clock
+	i := slices.Index(c.timers, t)
+	if i < 0 {
+		return false
+	}
+	c.timers = slices.Delete(c.timers, i, i+1)
+	c.changedLocked()
+	return true
+}
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -24,13 +26,20 @@ type MockWebSocketServer struct {
 	messagesMu sync.RWMutex
 	upgrader   websocket.Upgrader
 	server     *http.Server
+	// Closed once the server listens
+	listening chan struct{}
+	// Closed and replaced whenever a client connects or disconnects, or a message is received
+	changed   chan struct{}
+	changedMu sync.Mutex
 }
 
 func NewMockWebSocketServer(addr string) *MockWebSocketServer {
 	return &MockWebSocketServer{
-		addr:     addr,
-		clients:  make(map[*websocket.Conn]bool),
-		messages: make([]ClientMessage, 0),
+		addr:      addr,
+		clients:   make(map[*websocket.Conn]bool),
+		messages:  make([]ClientMessage, 0),
+		listening: make(chan struct{}),
+		changed:   make(chan struct{}),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for testing
@@ -49,7 +58,52 @@ func (m *MockWebSocketServer) Start() error {
 	}
 
 	log.Printf("Mock WebSocket server starting on %s", m.addr)
-	return m.server.ListenAndServe()
+	listener, err := net.Listen("tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	close(m.listening)
+	return m.server.Serve(listener)
+}
+
+// Listening returns a channel that is closed once the server listens
+func (m *MockWebSocketServer) Listening() <-chan struct{} {
+	return m.listening
+}
+
+// WaitForClients blocks until n clients are connected, or returns the error of ctx if it is done first
+func (m *MockWebSocketServer) WaitForClients(ctx context.Context, n int) error {
+	return m.waitFor(ctx, func() bool { return m.GetConnectedClients() == n })
+}
+
+// WaitForMessages blocks until at least n messages were received, or returns the error of ctx if it is done first
+func (m *MockWebSocketServer) WaitForMessages(ctx context.Context, n int) error {
+	return m.waitFor(ctx, func() bool { return len(m.GetAllMessages()) >= n })
+}
+
+func (m *MockWebSocketServer) waitFor(ctx context.Context, done func() bool) error {
+	for {
+		// Taken before checking, so a change in between is not missed
+		m.changedMu.Lock()
+		changed := m.changed
+		m.changedMu.Unlock()
+		if done() {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *MockWebSocketServer) notifyChanged() {
+	m.changedMu.Lock()
+	defer m.changedMu.Unlock()
+	close(m.changed)
+	m.changed = make(chan struct{})
 }
 
 func (m *MockWebSocketServer) Stop() error {
@@ -71,6 +125,7 @@ func (m *MockWebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Req
 	m.clientsMu.Lock()
 	m.clients[conn] = true
 	m.clientsMu.Unlock()
+	m.notifyChanged()
 
 	log.Printf("Client connected from %s", conn.RemoteAddr())
 
@@ -79,6 +134,7 @@ func (m *MockWebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Req
 		m.clientsMu.Lock()
 		delete(m.clients, conn)
 		m.clientsMu.Unlock()
+		m.notifyChanged()
 		log.Printf("Client disconnected: %s", conn.RemoteAddr())
 	}()
 
@@ -103,6 +159,7 @@ func (m *MockWebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Req
 			Type:      messageType,
 		})
 		m.messagesMu.Unlock()
+		m.notifyChanged()
 
 		// Handle ping messages
 		if messageType == websocket.PingMessage {
@@ -125,6 +182,7 @@ func (m *MockWebSocketServer) SendMessage(message []byte) {
 				m.clientsMu.Lock()
 				delete(m.clients, c)
 				m.clientsMu.Unlock()
+				m.notifyChanged()
 				c.Close()
 			}(conn)
 		}